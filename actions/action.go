@@ -20,6 +20,7 @@ type Actor interface {
 	// name is the monitor name.
 	// v is the returned value from the probe (or a value from the filter).
 	// Non-nil error is logged, but will not stop the monitor.
+	// The call is retried later if retrying is enabled in the server.
 	Fail(name string, v float64) error
 
 	// Recover is called when a probe is recovered from failure.
@@ -27,15 +28,38 @@ type Actor interface {
 	// name is the monitor name.
 	// d is the failure duration.
 	// Non-nil error is logged, but will not stop the monitor.
+	// The call is retried later if retrying is enabled in the server.
 	//
 	// Note that this may not always be called if cr-monitor is stopped
-	// during failure.  Init is the good place to correct such status.
+	// during failure and no state store is configured.  Init is the good
+	// place to correct such status.
 	Recover(name string, d time.Duration) error
 
 	// String returns a descriptive string for this action.
 	String() string
 }
 
+// Recipient is an optional interface for actors.
+//
+// If actors implement Recipient, notifications to the same recipient
+// share a rate limit of the server.
+type Recipient interface {
+	// Recipient returns the identity of the person or channel that
+	// receives notifications, e.g. "alarm:lkong".
+	Recipient() string
+}
+
+// Acker is an optional interface for actors.
+//
+// If actors implement Acker, Ack is called when a failing monitor is
+// acknowledged so that integrations can mirror it.
+type Acker interface {
+	// Ack is called when a failure of the named monitor is acknowledged.
+	//
+	// Non-nil error is logged, but does not cancel the acknowledgement.
+	Ack(name, author, comment string) error
+}
+
 // Constructor is a function to create an action.
 //
 // params are configuration options for the action.
@@ -18,6 +18,15 @@ import (
 const (
 	defaultTimeout  = 30  // second
 	defaultInterval = 240 // minute
+
+	defaultTitle = `{{if eq .Type "init"}}cr-monitor初始化通知` +
+		`{{else if eq .Type "recover"}}cr-monitor插件恢复正常通知` +
+		`{{else}}cr-monitor插件运行失败告警！{{end}}`
+	defaultMessage = `{{.Name}}@{{.Host}} {{.Type}}` +
+		`{{if or (eq .Type "fail") (eq .Type "repeat")}}: severity={{.Severity}} value={{.Value}} since {{datetime .FailedAt}}` +
+		`{{else if eq .Type "recover"}}: failed for {{.Duration}}` +
+		`{{else if eq .Type "unknown"}}: {{.Error}}{{end}}` +
+		`{{if .Message}} ({{.Message}}){{end}}`
 )
 
 var (
@@ -28,11 +37,13 @@ type action struct {
 	urlInit    *url.URL
 	urlFail    *url.URL
 	urlRecover *url.URL
+	urlUnknown *url.URL
 	uuid       string
 	module     string
 	method     int
 	interval   int
-	message    string
+	title      *actions.Template
+	message    *actions.Template
 	receiver   string
 	timeout    time.Duration
 }
@@ -97,57 +108,77 @@ func (a *action) request(u *url.URL, al *alarm) error {
 	return processResponse(u, resp)
 }
 
-func (a *action) Init(name string) error {
-	if a.urlInit == nil {
+func (a *action) send(u *url.URL, e *actions.Event) error {
+	if u == nil {
 		return nil
 	}
 
+	title, err := a.title.Execute(e)
+	if err != nil {
+		return err
+	}
+	message, err := a.message.Execute(e)
+	if err != nil {
+		return err
+	}
+
 	al := alarm{
 		Uuid:     a.uuid,
 		Module:   a.module,
-		Title:    "cr-monitor初始化通知",
-		Message:  a.message,
+		Title:    title,
+		Message:  message,
 		Method:   a.method,
 		Receiver: a.receiver,
 		Interval: a.interval,
 	}
+	return a.request(u, &al)
+}
 
-	return a.request(a.urlInit, &al)
+func (a *action) Init(name string) error {
+	return a.send(a.urlInit, &actions.Event{
+		Monitor: name,
+		Type:    actions.EventInit,
+		Time:    time.Now(),
+	})
 }
 
 func (a *action) Fail(name string, v float64) error {
-	if a.urlFail == nil {
-		return nil
-	}
-
-	al := alarm{
-		Uuid:     a.uuid,
-		Module:   a.module,
-		Title:    "cr-monitor插件运行失败告警！",
-		Message:  a.message,
-		Method:   a.method,
-		Receiver: a.receiver,
-		Interval: a.interval,
-	}
-	return a.request(a.urlFail, &al)
+	return a.Notify(&actions.Event{
+		Monitor:  name,
+		Type:     actions.EventFail,
+		Severity: actions.SeverityCritical,
+		Previous: actions.SeverityOK,
+		Value:    v,
+		Time:     time.Now(),
+	})
 }
 
 func (a *action) Recover(name string, d time.Duration) error {
-	if a.urlRecover == nil {
-		return nil
-	}
+	return a.Notify(&actions.Event{
+		Monitor:  name,
+		Type:     actions.EventRecover,
+		Severity: actions.SeverityOK,
+		Previous: actions.SeverityCritical,
+		Duration: d,
+		Time:     time.Now(),
+	})
+}
 
-	al := alarm{
-		Uuid:     a.uuid,
-		Module:   a.module,
-		Title:    "cr-monitor插件恢复正常通知",
-		Message:  a.message,
-		Method:   a.method,
-		Receiver: a.receiver,
-		Interval: a.interval,
+func (a *action) Notify(e *actions.Event) error {
+	switch e.Type {
+	case actions.EventFail, actions.EventRepeat:
+		return a.send(a.urlFail, e)
+	case actions.EventRecover:
+		return a.send(a.urlRecover, e)
+	case actions.EventUnknown:
+		return a.send(a.urlUnknown, e)
 	}
+	return nil
+}
 
-	return a.request(a.urlRecover, &al)
+// Recipient implements actions.Recipient.
+func (a *action) Recipient() string {
+	return "alarm:" + a.receiver
 }
 
 func (a *action) String() string {
@@ -156,7 +187,7 @@ func (a *action) String() string {
 }
 
 func construct(params map[string]interface{}) (actions.Actor, error) {
-	var uI, uF, uR *url.URL
+	var uI, uF, uR, uU *url.URL
 	urlInit, err := nightwatch.GetString("url_init", params)
 	switch err {
 	case nil:
@@ -191,6 +222,18 @@ func construct(params map[string]interface{}) (actions.Actor, error) {
 		return nil, err
 	}
 
+	urlUnknown, err := nightwatch.GetString("url_unknown", params)
+	switch err {
+	case nil:
+		uU, err = url.Parse(urlUnknown)
+		if err != nil {
+			return nil, err
+		}
+	case nightwatch.ErrNoKey:
+	default:
+		return nil, err
+	}
+
 	uuid, err := nightwatch.GetString("uuid", params)
 	switch err {
 	case nil:
@@ -227,14 +270,31 @@ func construct(params map[string]interface{}) (actions.Actor, error) {
 		return nil, err
 	}
 
+	title, err := nightwatch.GetString("title", params)
+	switch err {
+	case nil:
+	case nightwatch.ErrNoKey:
+		title = defaultTitle
+	default:
+		return nil, err
+	}
+	titleTmpl, err := actions.NewTemplate("title", title)
+	if err != nil {
+		return nil, fmt.Errorf("invalid title template: %v", err)
+	}
+
 	message, err := nightwatch.GetString("message", params)
 	switch err {
 	case nil:
 	case nightwatch.ErrNoKey:
-		message = "cr-monitor plugin fail"
+		message = defaultMessage
 	default:
 		return nil, err
 	}
+	messageTmpl, err := actions.NewTemplate("message", message)
+	if err != nil {
+		return nil, fmt.Errorf("invalid message template: %v", err)
+	}
 
 	receiver, err := nightwatch.GetString("receiver", params)
 	switch err {
@@ -258,11 +318,13 @@ func construct(params map[string]interface{}) (actions.Actor, error) {
 		urlInit:    uI,
 		urlFail:    uF,
 		urlRecover: uR,
+		urlUnknown: uU,
 		uuid:       uuid,
 		module:     module,
 		method:     method,
 		interval:   interval,
-		message:    message,
+		title:      titleTmpl,
+		message:    messageTmpl,
 		receiver:   receiver,
 		timeout:    time.Duration(timeout) * time.Second,
 	}, nil
@@ -0,0 +1,63 @@
+package alarm
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nightwatch/actions"
+)
+
+type recorder struct {
+	lock  sync.Mutex
+	paths []string
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.paths = append(r.paths, req.URL.Path)
+}
+
+func (r *recorder) calls() string {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return strings.Join(r.paths, ",")
+}
+
+func TestUnknownRecover(t *testing.T) {
+	t.Parallel()
+
+	r := new(recorder)
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	a, err := construct(map[string]interface{}{
+		"url_fail":    s.URL + "/fail",
+		"url_recover": s.URL + "/recover",
+		"url_unknown": s.URL + "/unknown",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// events for critical -> unknown -> ok.
+	now := time.Now()
+	events := []*actions.Event{
+		{Monitor: "alarm", Type: actions.EventFail, Severity: actions.SeverityCritical, Previous: actions.SeverityOK, Time: now},
+		{Monitor: "alarm", Type: actions.EventUnknown, Severity: actions.SeverityUnknown, Previous: actions.SeverityCritical, FailNotified: true, Time: now},
+		{Monitor: "alarm", Type: actions.EventRecover, Severity: actions.SeverityOK, Previous: actions.SeverityCritical, FailNotified: true, Time: now},
+	}
+	for _, e := range events {
+		if err := actions.Notify(a, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if calls := r.calls(); calls != "/fail,/unknown,/recover" {
+		t.Error("unexpected calls:", calls)
+	}
+}
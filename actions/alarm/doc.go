@@ -1,34 +1,41 @@
 /*
-Package http implements "http" action type that send events to HTTP(S) server.
+Package alarm implements "alarm" action type that send events to an alarm server.
 
-GET or POST form variables are automatically appended as follows:
+Events are sent as a JSON object by POST:
 
-    Name           Description
-    monitor        The monitor name.
-    host           Hostname where nightwatch.server is running.
-    event          One of "init", "fail", or "recover".
-    value          The probe(filter) value.  Appended on failure.
-    duration       Failure duration in seconds.  Appended on recovery.
-    version        nightwatch.version such as "0.1".
+    Name      Description
+    uuid      The uuid parameter.
+    module    The module parameter.
+    title     Rendered title template.
+    message   Rendered message template.
+    method    The method parameter.
+    receiver  The receiver parameter.
+    interval  The interval parameter.
 
 The constructor takes these parameters:
 
-    Name         Type               Default  Description
-    url_init     string                      URL to access on monitor startup.  Optional.
-    url_fail     string                      URL to access on monitor failure.  Optional.
-    url_recover  string                      URL to access on monitor recovery.  Optional.
-    method       string             GET      HTTP method to use.
-    agent        string             nightwatch.0.1 User-Agent string.
-    header       map[string]string  nil      HTTP headers.
-    params       map[string]string  nil      Additional form parameters.
-    timeout      int                30       Timeout seconds for requests.
-                                             Zero means the default timeout.
+    Name         Type    Default  Description
+    url_init     string           URL to access on monitor startup.  Optional.
+    url_fail     string           URL to access on monitor failure.  Optional.
+    url_recover  string           URL to access on monitor recovery.  Optional.
+    url_unknown  string           URL to access when the probe fails.  Optional.
+    uuid         string           Alarm uuid.
+    module       string  ccs      Alarm module.
+    method       int     15       Alarm method.
+    interval     int     240      Minutes between alarms on the alarm server.
+    title        string           Title template.
+    message      string           Message template.
+    receiver     string  lkong    Alarm receiver.
+    timeout      int     30       Timeout seconds for requests.
 
-If URL is not given for an event type, no request is sent for the event.
+title and message are text/template templates rendered with
+actions.TemplateData, for example:
 
-Proxy can be specified through environment variables.
-See net.http.ProxyFromEnvironment for details.
+    title: "{{.Monitor}} is {{.Severity}} on {{.Host}}"
+    message: "value {{.Value}} is out of [{{.Crit.Min}}, {{.Crit.Max}}] since {{datetime .FailedAt}}"
 
-Basic authentication can be used by embedding user:password in URLs.
+If URL is not given for an event type, no request is sent for the event.
+url_fail is also accessed when the severity of a failing monitor changes,
+and for re-notifications and escalations configured in the monitor.
 */
 package alarm
@@ -4,5 +4,11 @@ package all
 import (
 	// import all actions
 	_ "nightwatch/actions/alarm"
+	_ "nightwatch/actions/chat"
+	_ "nightwatch/actions/email"
+	_ "nightwatch/actions/exec"
 	_ "nightwatch/actions/http"
+	_ "nightwatch/actions/journald"
+	_ "nightwatch/actions/pagerduty"
+	_ "nightwatch/actions/syslog"
 )
@@ -0,0 +1,304 @@
+package chat
+
+import (
+	"fmt"
+	"net/url"
+	"sync"
+	"time"
+
+	"nightwatch"
+	"nightwatch/actions"
+)
+
+const (
+	defaultTimeout = 30 // second
+
+	defaultTitle = `{{.Name}}@{{.Host}} ` +
+		`{{if eq .Type "init"}}started` +
+		`{{else if eq .Type "recover"}}recovered` +
+		`{{else if eq .Type "unknown"}}is unknown` +
+		`{{else if eq .Type "repeat"}}is still {{.Severity}}` +
+		`{{else}}is {{.Severity}}{{end}}`
+	defaultMessage = `{{if or (eq .Type "fail") (eq .Type "repeat")}}value {{.Value}} since {{datetime .FailedAt}}` +
+		`{{else if eq .Type "recover"}}failed for {{.Duration}}` +
+		`{{else if eq .Type "unknown"}}{{.Error}}` +
+		`{{else}}monitor started{{end}}` +
+		`{{if .Message}} ({{.Message}}){{end}}`
+
+	defaultGroupTitle = `{{with .Failing}}{{len .}} monitors failing{{end}}` +
+		`{{if and .Failing .Recovered}}, {{end}}` +
+		`{{with .Recovered}}{{len .}} recovered{{end}}` +
+		`{{if .Labels}} on {{labels .Labels}}{{end}}`
+	defaultGroupMessage = `{{range .Events}}- {{.Name}}: ` +
+		`{{if eq .Type "recover"}}recovered after {{.Duration}}` +
+		`{{else if eq .Type "unknown"}}unknown ({{.Error}})` +
+		`{{else}}{{.Severity}}, value {{.Value}}{{end}}` + "\n" +
+		`{{end}}`
+)
+
+// message is a rendered notification.
+//
+// For grouped notifications, event is a summary of the group and
+// group is true.
+type message struct {
+	event *actions.Event
+	title string
+	text  string
+	group bool
+}
+
+// color returns the RGB color for the event.
+func (m *message) color() string {
+	if m.event.Type == actions.EventInit {
+		return "#439fe0"
+	}
+	switch m.event.Severity {
+	case actions.SeverityOK:
+		return "#2eb886"
+	case actions.SeverityWarning:
+		return "#f2c744"
+	case actions.SeverityCritical:
+		return "#d00000"
+	}
+	return "#808080"
+}
+
+// fields returns key-value pairs to be shown in the message.
+func (m *message) fields() [][2]string {
+	e := m.event
+	if e.Type == actions.EventInit || m.group {
+		return nil
+	}
+
+	f := [][2]string{{"Severity", string(e.Severity)}}
+	if len(e.Labels) > 0 {
+		f = append(f, [2]string{"Labels", actions.FormatLabels(e.Labels)})
+	}
+	switch e.Type {
+	case actions.EventFail, actions.EventRepeat:
+		f = append(f, [2]string{"Value", fmt.Sprintf("%g", e.Value)})
+	case actions.EventRecover:
+		f = append(f, [2]string{"Duration", e.Duration.String()})
+	}
+	return f
+}
+
+// platform sends messages to a chat service.
+type platform interface {
+	// post sends m.  If parent is not empty, m should be posted as a
+	// reply to parent.  post returns the ID of the posted message if
+	// the platform supports threading, or an empty string.
+	post(m *message, parent string, timeout time.Duration) (string, error)
+
+	// String returns a description of the platform.
+	String() string
+}
+
+type action struct {
+	platform     platform
+	title        *actions.Template
+	message      *actions.Template
+	groupTitle   *actions.GroupTemplate
+	groupMessage *actions.GroupTemplate
+	init         bool
+	thread       bool
+	timeout      time.Duration
+
+	lock    sync.Mutex
+	threads map[string]string // Event.Name() -> ID of the fail message
+}
+
+func (a *action) send(e *actions.Event) error {
+	title, err := a.title.Execute(e)
+	if err != nil {
+		return err
+	}
+	text, err := a.message.Execute(e)
+	if err != nil {
+		return err
+	}
+	m := &message{event: e, title: title, text: text}
+
+	var parent string
+	key := e.Name()
+	if a.thread {
+		a.lock.Lock()
+		parent = a.threads[key]
+		a.lock.Unlock()
+	}
+
+	id, err := a.platform.post(m, parent, a.timeout)
+	if err != nil {
+		return fmt.Errorf("action:%s: %v", a.platform, err)
+	}
+
+	if !a.thread {
+		return nil
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	switch {
+	case e.Type == actions.EventRecover:
+		delete(a.threads, key)
+	case len(parent) == 0 && len(id) > 0:
+		a.threads[key] = id
+	}
+	return nil
+}
+
+func (a *action) Init(name string) error {
+	if !a.init {
+		return nil
+	}
+	return a.send(&actions.Event{
+		Monitor: name,
+		Type:    actions.EventInit,
+		Time:    time.Now(),
+	})
+}
+
+func (a *action) Fail(name string, v float64) error {
+	return a.Notify(&actions.Event{
+		Monitor:  name,
+		Type:     actions.EventFail,
+		Severity: actions.SeverityCritical,
+		Previous: actions.SeverityOK,
+		Value:    v,
+		Time:     time.Now(),
+	})
+}
+
+func (a *action) Recover(name string, d time.Duration) error {
+	return a.Notify(&actions.Event{
+		Monitor:  name,
+		Type:     actions.EventRecover,
+		Severity: actions.SeverityOK,
+		Previous: actions.SeverityCritical,
+		Duration: d,
+		Time:     time.Now(),
+	})
+}
+
+func (a *action) Notify(e *actions.Event) error {
+	switch e.Type {
+	case actions.EventFail, actions.EventRepeat, actions.EventRecover, actions.EventUnknown:
+		return a.send(e)
+	}
+	return nil
+}
+
+// NotifyGroup implements actions.GroupNotifier.
+//
+// Grouped notifications are never threaded.
+func (a *action) NotifyGroup(g *actions.Group) error {
+	title, err := a.groupTitle.Execute(g)
+	if err != nil {
+		return err
+	}
+	text, err := a.groupMessage.Execute(g)
+	if err != nil {
+		return err
+	}
+
+	e := &actions.Event{
+		Monitor:  g.Receiver,
+		Type:     actions.EventFail,
+		Severity: g.Severity(),
+		Time:     g.Time(),
+	}
+	if e.Severity == actions.SeverityOK {
+		e.Type = actions.EventRecover
+	}
+	m := &message{event: e, title: title, text: text, group: true}
+	if _, err := a.platform.post(m, "", a.timeout); err != nil {
+		return fmt.Errorf("action:%s: %v", a.platform, err)
+	}
+	return nil
+}
+
+func (a *action) String() string {
+	return "action:" + a.platform.String()
+}
+
+func getURL(key string, params map[string]interface{}) (*url.URL, error) {
+	s, err := nightwatch.GetString(key, params)
+	if err != nil {
+		return nil, err
+	}
+	return url.Parse(s)
+}
+
+func getOptionalString(key string, params map[string]interface{}) (string, error) {
+	s, err := nightwatch.GetString(key, params)
+	if err != nil && err != nightwatch.ErrNoKey {
+		return "", err
+	}
+	return s, nil
+}
+
+// newAction constructs an action with parameters common to platforms.
+// threading tells if p supports threading.
+func newAction(p platform, threading bool, params map[string]interface{}) (actions.Actor, error) {
+	title, err := actions.TemplateParam("title", defaultTitle, params)
+	if err != nil {
+		return nil, err
+	}
+	message, err := actions.TemplateParam("message", defaultMessage, params)
+	if err != nil {
+		return nil, err
+	}
+	groupTitle, err := actions.GroupTemplateParam("group_title", defaultGroupTitle, params)
+	if err != nil {
+		return nil, err
+	}
+	groupMessage, err := actions.GroupTemplateParam("group_message", defaultGroupMessage, params)
+	if err != nil {
+		return nil, err
+	}
+	init, err := nightwatch.GetBool("init", params)
+	if err != nil && err != nightwatch.ErrNoKey {
+		return nil, err
+	}
+	thread, err := nightwatch.GetBool("thread", params)
+	switch err {
+	case nil:
+		if thread && !threading {
+			return nil, fmt.Errorf("%s does not support threading", p)
+		}
+	case nightwatch.ErrNoKey:
+		thread = threading
+	default:
+		return nil, err
+	}
+	timeout, err := nightwatch.GetInt("timeout", params)
+	switch err {
+	case nil:
+		if timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout: %d", timeout)
+		}
+	case nightwatch.ErrNoKey:
+		timeout = defaultTimeout
+	default:
+		return nil, err
+	}
+
+	return &action{
+		platform:     p,
+		title:        title,
+		message:      message,
+		groupTitle:   groupTitle,
+		groupMessage: groupMessage,
+		init:         init,
+		thread:       thread,
+		timeout:      time.Duration(timeout) * time.Second,
+		threads:      make(map[string]string),
+	}, nil
+}
+
+func init() {
+	actions.Register("slack", constructSlack)
+	actions.Register("mattermost", constructMattermost)
+	actions.Register("dingtalk", constructDingTalk)
+	actions.Register("wecom", constructWeCom)
+	actions.Register("feishu", constructFeishu)
+}
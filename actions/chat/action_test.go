@@ -0,0 +1,242 @@
+package chat
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nightwatch/actions"
+)
+
+type recorder struct {
+	lock     sync.Mutex
+	requests []map[string]interface{}
+	response string
+}
+
+func (r *recorder) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	data, err := ioutil.ReadAll(req.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	var v map[string]interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	v["_query"] = req.URL.RawQuery
+	v["_auth"] = req.Header.Get("Authorization")
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	r.requests = append(r.requests, v)
+	w.Header().Set("Content-Type", "application/json")
+	w.Write([]byte(r.response))
+}
+
+func (r *recorder) last() map[string]interface{} {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if len(r.requests) == 0 {
+		return nil
+	}
+	return r.requests[len(r.requests)-1]
+}
+
+func TestSlackThread(t *testing.T) {
+	t.Parallel()
+
+	r := &recorder{response: `{"ok":true,"ts":"1234.5678"}`}
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	a, err := constructSlack(map[string]interface{}{
+		"token":   "xoxb-test",
+		"channel": "#ops",
+		"api_url": s.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Fail("test", 3); err != nil {
+		t.Fatal(err)
+	}
+	v := r.last()
+	if v["_auth"] != "Bearer xoxb-test" {
+		t.Error("unexpected authorization:", v["_auth"])
+	}
+	if _, ok := v["thread_ts"]; ok {
+		t.Error("fail message should not be a reply")
+	}
+	att := v["attachments"].([]interface{})[0].(map[string]interface{})
+	if att["color"] != "#d00000" {
+		t.Error("unexpected color:", att["color"])
+	}
+
+	if err := a.Recover("test", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+	v = r.last()
+	if v["thread_ts"] != "1234.5678" {
+		t.Error("recover message is not threaded:", v["thread_ts"])
+	}
+
+	// the thread is closed on recovery.
+	if err := a.Fail("test", 3); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := r.last()["thread_ts"]; ok {
+		t.Error("new failure should start a new thread")
+	}
+
+	r.lock.Lock()
+	r.response = `{"ok":false,"error":"channel_not_found"}`
+	r.lock.Unlock()
+	err = a.Fail("test", 3)
+	if err == nil || !strings.Contains(err.Error(), "channel_not_found") {
+		t.Error("API error is not reported:", err)
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	t.Parallel()
+
+	r := &recorder{response: `{"errcode":0,"errmsg":"ok"}`}
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	cases := []struct {
+		construct func(map[string]interface{}) (actions.Actor, error)
+		check     func(v map[string]interface{}) bool
+	}{
+		{
+			constructMattermost,
+			func(v map[string]interface{}) bool {
+				return len(v["attachments"].([]interface{})) == 1
+			},
+		},
+		{
+			func(p map[string]interface{}) (actions.Actor, error) {
+				p["secret"] = "SEC"
+				return constructDingTalk(p)
+			},
+			func(v map[string]interface{}) bool {
+				md := v["markdown"].(map[string]interface{})
+				return v["msgtype"] == "markdown" &&
+					strings.Contains(md["text"].(string), "#d00000") &&
+					strings.Contains(v["_query"].(string), "sign=")
+			},
+		},
+		{
+			constructWeCom,
+			func(v map[string]interface{}) bool {
+				md := v["markdown"].(map[string]interface{})
+				return strings.Contains(md["content"].(string), `color="warning"`)
+			},
+		},
+		{
+			func(p map[string]interface{}) (actions.Actor, error) {
+				p["secret"] = "SEC"
+				return constructFeishu(p)
+			},
+			func(v map[string]interface{}) bool {
+				card := v["card"].(map[string]interface{})
+				header := card["header"].(map[string]interface{})
+				return v["msg_type"] == "interactive" &&
+					header["template"] == "red" && len(v["sign"].(string)) > 0
+			},
+		},
+	}
+
+	for i, c := range cases {
+		a, err := c.construct(map[string]interface{}{"url": s.URL})
+		if err != nil {
+			t.Fatal(i, err)
+		}
+		if err := a.Fail("test", 3); err != nil {
+			t.Fatal(i, err)
+		}
+		if !c.check(r.last()) {
+			t.Errorf("%d: unexpected request: %#v", i, r.last())
+		}
+	}
+
+	// errors returned with status 200.
+	r.lock.Lock()
+	r.response = `{"errcode":310000,"errmsg":"sign not match"}`
+	r.lock.Unlock()
+	a, err := constructDingTalk(map[string]interface{}{"url": s.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Fail("test", 3); err == nil {
+		t.Error("error response is not reported")
+	}
+}
+
+func TestGroup(t *testing.T) {
+	t.Parallel()
+
+	r := &recorder{response: `{"ok":true}`}
+	s := httptest.NewServer(r)
+	defer s.Close()
+
+	a, err := constructSlack(map[string]interface{}{
+		"url": s.URL,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	g := &actions.Group{
+		Receiver: "ops",
+		Labels:   map[string]string{"host": "db1"},
+		Events: []*actions.Event{
+			{Monitor: "ping", Type: actions.EventFail, Severity: actions.SeverityCritical, Value: 1},
+			{Monitor: "disk", Type: actions.EventFail, Severity: actions.SeverityWarning, Value: 2},
+			{Monitor: "load", Type: actions.EventRecover, Severity: actions.SeverityOK, Duration: time.Minute},
+		},
+	}
+	if err := actions.NotifyGroup(a, g); err != nil {
+		t.Fatal(err)
+	}
+
+	r.lock.Lock()
+	n := len(r.requests)
+	r.lock.Unlock()
+	if n != 1 {
+		t.Fatal("group is not posted as one message:", n)
+	}
+	att := r.last()["attachments"].([]interface{})[0].(map[string]interface{})
+	if att["title"] != "2 monitors failing, 1 recovered on host=db1" {
+		t.Error("unexpected title:", att["title"])
+	}
+	if att["color"] != "#d00000" {
+		t.Error("unexpected color:", att["color"])
+	}
+	text := att["text"].(string)
+	if !strings.Contains(text, "- disk: warning, value 2\n") || !strings.Contains(text, "- load: recovered after 1m0s\n") {
+		t.Error("unexpected text:", text)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	t.Parallel()
+
+	for _, timeout := range []int{0, -1} {
+		_, err := constructMattermost(map[string]interface{}{
+			"url":     "http://localhost/hooks/test",
+			"timeout": timeout,
+		})
+		if err == nil {
+			t.Error("invalid timeout is accepted:", timeout)
+		}
+	}
+}
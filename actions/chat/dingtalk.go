@@ -0,0 +1,90 @@
+package chat
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"nightwatch"
+	"nightwatch/actions"
+	nwhttp "nightwatch/actions/http"
+)
+
+type dingTalkMessage struct {
+	MsgType  string `json:"msgtype"`
+	Markdown struct {
+		Title string `json:"title"`
+		Text  string `json:"text"`
+	} `json:"markdown"`
+	At struct {
+		AtMobiles []string `json:"atMobiles,omitempty"`
+		IsAtAll   bool     `json:"isAtAll"`
+	} `json:"at"`
+}
+
+// dingTalk posts messages to a DingTalk group robot.
+type dingTalk struct {
+	url       *url.URL
+	secret    string
+	atMobiles []string
+	atAll     bool
+}
+
+func (d *dingTalk) post(m *message, parent string, timeout time.Duration) (string, error) {
+	msg := new(dingTalkMessage)
+	msg.MsgType = "markdown"
+	msg.Markdown.Title = m.title
+
+	text := fmt.Sprintf("#### <font color=%s>%s</font>\n\n%s", m.color(), m.title, markdown(m))
+	if len(d.atMobiles) > 0 {
+		// mobiles must appear in the text to be notified.
+		text += "\n\n@" + strings.Join(d.atMobiles, " @")
+	}
+	msg.Markdown.Text = text
+	msg.At.AtMobiles = d.atMobiles
+	msg.At.IsAtAll = d.atAll
+
+	u := *d.url
+	if len(d.secret) > 0 {
+		ts := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+		q := u.Query()
+		q.Set("timestamp", ts)
+		q.Set("sign", sign(d.secret, ts+"\n"+d.secret))
+		u.RawQuery = q.Encode()
+	}
+
+	data, err := nwhttp.PostJSON(&u, nil, msg, timeout)
+	if err != nil {
+		return "", err
+	}
+	return "", checkResponse(data)
+}
+
+func (d *dingTalk) String() string {
+	return "dingtalk:" + d.url.Host
+}
+
+func constructDingTalk(params map[string]interface{}) (actions.Actor, error) {
+	d := new(dingTalk)
+
+	var err error
+	d.url, err = getURL("url", params)
+	if err != nil {
+		return nil, err
+	}
+	d.secret, err = getOptionalString("secret", params)
+	if err != nil {
+		return nil, err
+	}
+	d.atMobiles, err = nightwatch.GetStringList("at_mobiles", params)
+	if err != nil && err != nightwatch.ErrNoKey {
+		return nil, err
+	}
+	d.atAll, err = nightwatch.GetBool("at_all", params)
+	if err != nil && err != nightwatch.ErrNoKey {
+		return nil, err
+	}
+	return newAction(d, false, params)
+}
@@ -0,0 +1,86 @@
+/*
+Package chat implements actions that post events to chat services
+through their webhooks.
+
+These action types are registered:
+
+    Type        Service
+    slack       Slack incoming webhooks or chat.postMessage API
+    mattermost  Mattermost incoming webhooks or REST API
+    dingtalk    DingTalk group robots
+    wecom       WeCom (WeChat Work) group robots
+    feishu      Feishu (Lark) group bots
+
+Messages are formatted as attachments, markdown or cards of each service,
+colored by the severity of the event.
+
+All types take these parameters:
+
+    Name           Type    Default  Description
+    title          string           Title template.
+    message        string           Message template.
+    group_title    string           Title template for grouped events.
+    group_message  string           Message template for grouped events.
+    init           bool    false    Post a message on monitor startup.
+    thread         bool             Post following messages as replies.  See below.
+    timeout        int     30       Timeout seconds for requests.
+
+title and message are text/template templates rendered with
+actions.TemplateData, for example:
+
+    title: "{{.Monitor}} is {{.Severity}} on {{.Host}}"
+    message: "value {{.Value}} is out of [{{.Crit.Min}}, {{.Crit.Max}}]"
+
+Events grouped by the router are posted as one message.  group_title
+and group_message are rendered with actions.GroupTemplateData, for example:
+
+    group_title: "{{len .Failing}} monitors failing on {{labels .Labels}}"
+    group_message: "{{range .Events}}{{.Name}} is {{.Severity}}\n{{end}}"
+
+"slack" takes these parameters:
+
+    Name        Type    Default  Description
+    url         string           Incoming webhook URL.  Required without token.
+    token       string           Bot token to use chat.postMessage.  Optional.
+    channel     string           Channel.  Required with token.
+    api_url     string           URL of chat.postMessage.  Optional.
+    username    string           Username to post as.  Optional.
+    icon_emoji  string           Icon emoji.  Optional.
+
+"mattermost" takes these parameters:
+
+    Name        Type    Default  Description
+    url         string           Incoming webhook URL.  Required without token.
+    token       string           Access token to use the REST API.  Optional.
+    server      string           Server URL.  Required with token.
+    channel_id  string           Channel ID.  Required with token.
+    channel     string           Channel name for webhooks.  Optional.
+    username    string           Username for webhooks.  Optional.
+    icon_url    string           Icon URL for webhooks.  Optional.
+
+"dingtalk" takes these parameters:
+
+    Name        Type      Default  Description
+    url         string             Webhook URL with access_token.
+    secret      string             Secret to sign requests.  Optional.
+    at_mobiles  []string           Mobile numbers to mention.  Optional.
+    at_all      bool      false    Mention everyone.
+
+"wecom" takes these parameters:
+
+    Name  Type    Default  Description
+    url   string           Webhook URL with key.
+
+"feishu" takes these parameters:
+
+    Name    Type    Default  Description
+    url     string           Webhook URL.
+    secret  string           Secret to sign requests.  Optional.
+
+Threading is available for slack and mattermost with tokens, because
+incoming webhooks do not return IDs of posted messages.  It is enabled
+by default in that case.  While a series is failing, re-notifications,
+severity changes and the recovery are posted as replies to the message
+of the failure.  Threads are not kept across restarts of nightwatch.
+*/
+package chat
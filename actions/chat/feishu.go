@@ -0,0 +1,98 @@
+package chat
+
+import (
+	"net/url"
+	"strconv"
+	"time"
+
+	"nightwatch/actions"
+	nwhttp "nightwatch/actions/http"
+)
+
+type feishuText struct {
+	Tag     string `json:"tag"`
+	Content string `json:"content"`
+}
+
+type feishuElement struct {
+	Tag  string     `json:"tag"`
+	Text feishuText `json:"text"`
+}
+
+type feishuCard struct {
+	Header struct {
+		Title    feishuText `json:"title"`
+		Template string     `json:"template"`
+	} `json:"header"`
+	Elements []feishuElement `json:"elements"`
+}
+
+type feishuMessage struct {
+	Timestamp string     `json:"timestamp,omitempty"`
+	Sign      string     `json:"sign,omitempty"`
+	MsgType   string     `json:"msg_type"`
+	Card      feishuCard `json:"card"`
+}
+
+// feishuTemplate returns the header color of cards.
+func feishuTemplate(m *message) string {
+	if m.event.Type == actions.EventInit {
+		return "blue"
+	}
+	switch m.event.Severity {
+	case actions.SeverityOK:
+		return "green"
+	case actions.SeverityWarning:
+		return "orange"
+	case actions.SeverityCritical:
+		return "red"
+	}
+	return "grey"
+}
+
+// feishu posts messages to a Feishu (Lark) group bot.
+type feishu struct {
+	url    *url.URL
+	secret string
+}
+
+func (f *feishu) post(m *message, parent string, timeout time.Duration) (string, error) {
+	msg := &feishuMessage{MsgType: "interactive"}
+	msg.Card.Header.Title = feishuText{"plain_text", m.title}
+	msg.Card.Header.Template = feishuTemplate(m)
+	msg.Card.Elements = []feishuElement{
+		{Tag: "div", Text: feishuText{"lark_md", markdown(m)}},
+	}
+
+	if len(f.secret) > 0 {
+		ts := strconv.FormatInt(time.Now().Unix(), 10)
+		msg.Timestamp = ts
+		// Feishu uses the string to sign as the key.
+		msg.Sign = sign(ts+"\n"+f.secret, "")
+	}
+
+	data, err := nwhttp.PostJSON(f.url, nil, msg, timeout)
+	if err != nil {
+		return "", err
+	}
+	return "", checkResponse(data)
+}
+
+func (f *feishu) String() string {
+	return "feishu:" + f.url.Host
+}
+
+func constructFeishu(params map[string]interface{}) (actions.Actor, error) {
+	f := new(feishu)
+
+	var err error
+	f.url, err = getURL("url", params)
+	if err != nil {
+		return nil, err
+	}
+	f.secret, err = getOptionalString("secret", params)
+	if err != nil {
+		return nil, err
+	}
+	return newAction(f, false, params)
+}
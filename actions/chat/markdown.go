@@ -0,0 +1,54 @@
+package chat
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// markdown formats m as a markdown text for DingTalk and Feishu.
+func markdown(m *message) string {
+	var b strings.Builder
+	b.WriteString(m.text)
+	for _, f := range m.fields() {
+		fmt.Fprintf(&b, "\n\n**%s**: %s", f[0], f[1])
+	}
+	return b.String()
+}
+
+// sign computes the HMAC-SHA256 signature used by DingTalk and Feishu.
+func sign(key, data string) string {
+	h := hmac.New(sha256.New, []byte(key))
+	h.Write([]byte(data))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+// errorResponse is the response of DingTalk, WeCom and Feishu webhooks.
+// These return errors with status 200.
+type errorResponse struct {
+	ErrCode       *int   `json:"errcode"`
+	ErrMsg        string `json:"errmsg"`
+	Code          *int   `json:"code"`
+	Msg           string `json:"msg"`
+	StatusCode    *int   `json:"StatusCode"`
+	StatusMessage string `json:"StatusMessage"`
+}
+
+func checkResponse(data []byte) error {
+	var resp errorResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return fmt.Errorf("invalid response: %v", err)
+	}
+	switch {
+	case resp.ErrCode != nil && *resp.ErrCode != 0:
+		return fmt.Errorf("error %d: %s", *resp.ErrCode, resp.ErrMsg)
+	case resp.Code != nil && *resp.Code != 0:
+		return fmt.Errorf("error %d: %s", *resp.Code, resp.Msg)
+	case resp.StatusCode != nil && *resp.StatusCode != 0:
+		return fmt.Errorf("error %d: %s", *resp.StatusCode, resp.StatusMessage)
+	}
+	return nil
+}
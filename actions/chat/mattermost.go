@@ -0,0 +1,125 @@
+package chat
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"nightwatch/actions"
+	nwhttp "nightwatch/actions/http"
+)
+
+type mattermostPost struct {
+	ChannelID string                 `json:"channel_id"`
+	Message   string                 `json:"message"`
+	RootID    string                 `json:"root_id,omitempty"`
+	Props     map[string]interface{} `json:"props"`
+}
+
+type mattermostResponse struct {
+	ID string `json:"id"`
+}
+
+// mattermost posts messages through an incoming webhook, or through
+// the REST API if a token is given.
+type mattermost struct {
+	url       *url.URL
+	token     string
+	channel   string
+	channelID string
+	username  string
+	iconURL   string
+}
+
+func (mm *mattermost) post(m *message, parent string, timeout time.Duration) (string, error) {
+	if len(mm.token) == 0 {
+		// incoming webhooks accept Slack compatible messages.
+		msg := map[string]interface{}{
+			"text":        m.title,
+			"attachments": slackAttachments(m),
+		}
+		if len(mm.channel) > 0 {
+			msg["channel"] = mm.channel
+		}
+		if len(mm.username) > 0 {
+			msg["username"] = mm.username
+		}
+		if len(mm.iconURL) > 0 {
+			msg["icon_url"] = mm.iconURL
+		}
+		_, err := nwhttp.PostJSON(mm.url, nil, msg, timeout)
+		return "", err
+	}
+
+	p := &mattermostPost{
+		ChannelID: mm.channelID,
+		Message:   m.title,
+		RootID:    parent,
+		Props: map[string]interface{}{
+			"attachments": slackAttachments(m),
+		},
+	}
+	header := map[string]string{"Authorization": "Bearer " + mm.token}
+	data, err := nwhttp.PostJSON(mm.url, header, p, timeout)
+	if err != nil {
+		return "", err
+	}
+	var resp mattermostResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return "", err
+	}
+	return resp.ID, nil
+}
+
+func (mm *mattermost) String() string {
+	return "mattermost:" + mm.url.Host
+}
+
+func constructMattermost(params map[string]interface{}) (actions.Actor, error) {
+	mm := new(mattermost)
+
+	var err error
+	mm.token, err = getOptionalString("token", params)
+	if err != nil {
+		return nil, err
+	}
+	mm.channel, err = getOptionalString("channel", params)
+	if err != nil {
+		return nil, err
+	}
+	mm.username, err = getOptionalString("username", params)
+	if err != nil {
+		return nil, err
+	}
+	mm.iconURL, err = getOptionalString("icon_url", params)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(mm.token) == 0 {
+		mm.url, err = getURL("url", params)
+		if err != nil {
+			return nil, err
+		}
+		return newAction(mm, false, params)
+	}
+
+	mm.channelID, err = getOptionalString("channel_id", params)
+	if err != nil {
+		return nil, err
+	}
+	if len(mm.channelID) == 0 {
+		return nil, fmt.Errorf("channel_id is required with token")
+	}
+	server, err := getURL("server", params)
+	if err != nil {
+		return nil, err
+	}
+	mm.url, err = server.Parse(strings.TrimSuffix(server.Path, "/") + "/api/v4/posts")
+	if err != nil {
+		return nil, err
+	}
+	return newAction(mm, true, params)
+}
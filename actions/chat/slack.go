@@ -0,0 +1,153 @@
+package chat
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"time"
+
+	"nightwatch"
+	"nightwatch/actions"
+	nwhttp "nightwatch/actions/http"
+)
+
+const (
+	defaultSlackAPI = "https://slack.com/api/chat.postMessage"
+)
+
+type slackField struct {
+	Title string `json:"title"`
+	Value string `json:"value"`
+	Short bool   `json:"short"`
+}
+
+type slackAttachment struct {
+	Fallback string       `json:"fallback"`
+	Color    string       `json:"color"`
+	Title    string       `json:"title"`
+	Text     string       `json:"text"`
+	Fields   []slackField `json:"fields,omitempty"`
+	Ts       int64        `json:"ts"`
+}
+
+// slackAttachments builds attachments also understood by Mattermost.
+func slackAttachments(m *message) []slackAttachment {
+	var fields []slackField
+	for _, f := range m.fields() {
+		fields = append(fields, slackField{f[0], f[1], true})
+	}
+	return []slackAttachment{{
+		Fallback: m.title + ": " + m.text,
+		Color:    m.color(),
+		Title:    m.title,
+		Text:     m.text,
+		Fields:   fields,
+		Ts:       m.event.Time.Unix(),
+	}}
+}
+
+type slackMessage struct {
+	Channel     string            `json:"channel,omitempty"`
+	Username    string            `json:"username,omitempty"`
+	IconEmoji   string            `json:"icon_emoji,omitempty"`
+	Text        string            `json:"text"`
+	Attachments []slackAttachment `json:"attachments"`
+	ThreadTs    string            `json:"thread_ts,omitempty"`
+}
+
+type slackResponse struct {
+	OK    bool   `json:"ok"`
+	Error string `json:"error"`
+	Ts    string `json:"ts"`
+}
+
+// slack posts messages through an incoming webhook, or through
+// chat.postMessage API if a token is given.
+type slack struct {
+	url       *url.URL
+	token     string
+	channel   string
+	username  string
+	iconEmoji string
+}
+
+func (s *slack) post(m *message, parent string, timeout time.Duration) (string, error) {
+	msg := &slackMessage{
+		Channel:     s.channel,
+		Username:    s.username,
+		IconEmoji:   s.iconEmoji,
+		Text:        m.title,
+		Attachments: slackAttachments(m),
+		ThreadTs:    parent,
+	}
+
+	if len(s.token) == 0 {
+		_, err := nwhttp.PostJSON(s.url, nil, msg, timeout)
+		return "", err
+	}
+
+	header := map[string]string{"Authorization": "Bearer " + s.token}
+	data, err := nwhttp.PostJSON(s.url, header, msg, timeout)
+	if err != nil {
+		return "", err
+	}
+	var resp slackResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return "", err
+	}
+	if !resp.OK {
+		return "", errors.New(resp.Error)
+	}
+	return resp.Ts, nil
+}
+
+func (s *slack) String() string {
+	if len(s.token) > 0 {
+		return "slack:" + s.channel
+	}
+	return "slack:" + s.url.Host
+}
+
+func constructSlack(params map[string]interface{}) (actions.Actor, error) {
+	s := new(slack)
+
+	var err error
+	s.token, err = getOptionalString("token", params)
+	if err != nil {
+		return nil, err
+	}
+	s.channel, err = getOptionalString("channel", params)
+	if err != nil {
+		return nil, err
+	}
+	s.username, err = getOptionalString("username", params)
+	if err != nil {
+		return nil, err
+	}
+	s.iconEmoji, err = getOptionalString("icon_emoji", params)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(s.token) == 0 {
+		s.url, err = getURL("url", params)
+		if err != nil {
+			return nil, err
+		}
+		return newAction(s, false, params)
+	}
+
+	if len(s.channel) == 0 {
+		return nil, fmt.Errorf("channel is required with token")
+	}
+	s.url, err = getURL("api_url", params)
+	switch err {
+	case nil:
+	case nightwatch.ErrNoKey:
+		s.url, _ = url.Parse(defaultSlackAPI)
+	default:
+		return nil, err
+	}
+	return newAction(s, true, params)
+}
@@ -0,0 +1,67 @@
+package chat
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"nightwatch/actions"
+	nwhttp "nightwatch/actions/http"
+)
+
+type weComMessage struct {
+	MsgType  string `json:"msgtype"`
+	Markdown struct {
+		Content string `json:"content"`
+	} `json:"markdown"`
+}
+
+// weComColor returns one of the font colors WeCom supports.
+func weComColor(m *message) string {
+	if m.event.Type == actions.EventInit {
+		return "comment"
+	}
+	switch m.event.Severity {
+	case actions.SeverityOK:
+		return "info"
+	case actions.SeverityWarning, actions.SeverityCritical:
+		return "warning"
+	}
+	return "comment"
+}
+
+// weCom posts messages to a WeCom (WeChat Work) group robot.
+type weCom struct {
+	url *url.URL
+}
+
+func (w *weCom) post(m *message, parent string, timeout time.Duration) (string, error) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "**<font color=\"%s\">%s</font>**\n%s", weComColor(m), m.title, m.text)
+	for _, f := range m.fields() {
+		fmt.Fprintf(&b, "\n>%s: <font color=\"comment\">%s</font>", f[0], f[1])
+	}
+
+	msg := new(weComMessage)
+	msg.MsgType = "markdown"
+	msg.Markdown.Content = b.String()
+
+	data, err := nwhttp.PostJSON(w.url, nil, msg, timeout)
+	if err != nil {
+		return "", err
+	}
+	return "", checkResponse(data)
+}
+
+func (w *weCom) String() string {
+	return "wecom:" + w.url.Host
+}
+
+func constructWeCom(params map[string]interface{}) (actions.Actor, error) {
+	u, err := getURL("url", params)
+	if err != nil {
+		return nil, err
+	}
+	return newAction(&weCom{u}, false, params)
+}
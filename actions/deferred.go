@@ -0,0 +1,46 @@
+package actions
+
+import (
+	"sync"
+)
+
+// Flusher is an optional interface for actors that accept notifications
+// and deliver them later, e.g. in digests.
+//
+// Such actors report notifications that fail after being accepted
+// with Failed.
+type Flusher interface {
+	// Flush delivers held notifications immediately.
+	// This is called when monitors or the router stop.
+	Flush()
+}
+
+// FailedFunc handles a notification that a failed to deliver after
+// accepting it.  Either e or g is set.
+type FailedFunc func(a Actor, e *Event, g *Group, err error)
+
+var (
+	failedLock sync.Mutex
+	failedFunc FailedFunc
+)
+
+// SetFailedFunc sets f to handle notifications reported by Failed.
+// This function is used internally in cr-monitor.
+func SetFailedFunc(f FailedFunc) {
+	failedLock.Lock()
+	defer failedLock.Unlock()
+
+	failedFunc = f
+}
+
+// Failed reports that a failed to deliver e or g after Notify or
+// NotifyGroup returned nil.  If no FailedFunc is set, this does nothing.
+func Failed(a Actor, e *Event, g *Group, err error) {
+	failedLock.Lock()
+	f := failedFunc
+	failedLock.Unlock()
+
+	if f != nil {
+		f(a, e, g, err)
+	}
+}
@@ -0,0 +1,545 @@
+package email
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"nightwatch"
+	"nightwatch/actions"
+	"nightwatch/util/log"
+)
+
+const (
+	defaultTimeout = 30 // second
+
+	defaultSubject = `[nightwatch] {{.Name}}@{{.Host}} ` +
+		`{{if eq .Type "init"}}started` +
+		`{{else if eq .Type "recover"}}recovered` +
+		`{{else if eq .Type "unknown"}}is unknown` +
+		`{{else}}is {{.Severity}}{{end}}`
+	defaultBody = `Monitor:  {{.Name}}
+Host:     {{.Host}}
+Event:    {{.Type}}
+Time:     {{datetime .Time}}
+{{- if ne .Type "init"}}
+Severity: {{.Previous}} -> {{.Severity}}
+{{- end}}
+{{- if or (eq .Type "fail") (eq .Type "repeat")}}
+Value:    {{.Value}}
+Since:    {{datetime .FailedAt}}
+{{- else if eq .Type "recover"}}
+Duration: {{.Duration}}
+{{- else if eq .Type "unknown"}}
+Error:    {{.Error}}
+{{- end}}
+{{- if .Message}}
+Message:  {{.Message}}
+{{- end}}
+`
+
+	defaultGroupSubject = `[nightwatch] ` +
+		`{{with .Failing}}{{len .}} monitors failing{{end}}` +
+		`{{if and .Failing .Recovered}}, {{end}}` +
+		`{{with .Recovered}}{{len .}} recovered{{end}}` +
+		`{{if .Labels}} on {{labels .Labels}}{{end}}`
+	defaultGroupBody = `Host:     {{.Host}}
+Receiver: {{.Receiver}}
+{{- if .Labels}}
+Group:    {{labels .Labels}}
+{{- end}}
+{{range .Events}}
+{{datetime .Time}}  {{.Name}}  {{.Type}}
+{{- if eq .Type "recover"}} after {{.Duration}}
+{{- else if eq .Type "unknown"}} ({{.Error}})
+{{- else}} {{.Severity}}, value {{.Value}}{{end}}
+{{- end}}
+`
+)
+
+var (
+	errNoRecipients = errors.New("no recipients")
+	errNoAuth       = errors.New("server does not support AUTH")
+	errNoStartTLS   = errors.New("server does not support STARTTLS")
+)
+
+type action struct {
+	server     string
+	host       string
+	username   string
+	password   string
+	from       string
+	to         map[string][]string
+	startTLS   bool
+	skipVerify bool
+	subject    *actions.Template
+	body       *actions.Template
+	gSubject   *actions.GroupTemplate
+	gBody      *actions.GroupTemplate
+	digest     time.Duration
+	timeout    time.Duration
+}
+
+// message is a rendered notification.
+type message struct {
+	subject string
+	body    string
+
+	// the origin of the message to report failed digests.
+	actor *action
+	event *actions.Event
+	group *actions.Group
+}
+
+func encodeHeader(s string) string {
+	return mime.QEncoding.Encode("utf-8", s)
+}
+
+// compose builds an RFC 5322 message.
+func (a *action) compose(to []string, m *message) []byte {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", a.from)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(to, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", encodeHeader(m.subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "X-Mailer: nightwatch.%s\r\n", nightwatch.Version)
+	buf.WriteString("MIME-Version: 1.0\r\n")
+	buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	buf.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	buf.WriteString("\r\n")
+	body := strings.Replace(m.body, "\r\n", "\n", -1)
+	buf.WriteString(strings.Replace(body, "\n", "\r\n", -1))
+	return buf.Bytes()
+}
+
+// sendMail sends m to the recipients through the SMTP server.
+func (a *action) sendMail(to []string, m *message) error {
+	conn, err := net.DialTimeout("tcp", a.server, a.timeout)
+	if err != nil {
+		return err
+	}
+	conn.SetDeadline(time.Now().Add(a.timeout))
+
+	c, err := smtp.NewClient(conn, a.host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	hname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+	if err := c.Hello(hname); err != nil {
+		return err
+	}
+
+	if a.startTLS {
+		if ok, _ := c.Extension("STARTTLS"); !ok {
+			return errNoStartTLS
+		}
+		err = c.StartTLS(&tls.Config{
+			ServerName:         a.host,
+			InsecureSkipVerify: a.skipVerify,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(a.username) > 0 {
+		if ok, _ := c.Extension("AUTH"); !ok {
+			return errNoAuth
+		}
+		auth := smtp.PlainAuth("", a.username, a.password, a.host)
+		if err := c.Auth(auth); err != nil {
+			return err
+		}
+	}
+
+	if err := c.Mail(a.from); err != nil {
+		return err
+	}
+	for _, rcpt := range to {
+		if err := c.Rcpt(rcpt); err != nil {
+			return err
+		}
+	}
+	w, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := w.Write(a.compose(to, m)); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+func (a *action) render(e *actions.Event) (*message, error) {
+	subject, err := a.subject.Execute(e)
+	if err != nil {
+		return nil, err
+	}
+	body, err := a.body.Execute(e)
+	if err != nil {
+		return nil, err
+	}
+	return &message{subject: subject, body: body, event: e}, nil
+}
+
+func (a *action) send(to []string, e *actions.Event) error {
+	if len(to) == 0 {
+		return nil
+	}
+
+	m, err := a.render(e)
+	if err != nil {
+		return err
+	}
+	return a.deliver(to, m)
+}
+
+// deliver sends m, or adds it to the digest.
+func (a *action) deliver(to []string, m *message) error {
+	if a.digest > 0 {
+		m.actor = a
+		getDigest(a, to).add(m)
+		return nil
+	}
+
+	err := a.sendMail(to, m)
+	if err != nil {
+		return fmt.Errorf("action:email:%s: %v", a.server, err)
+	}
+	return nil
+}
+
+// groupRecipients returns recipients of all events in g.
+func (a *action) groupRecipients(g *actions.Group) []string {
+	var to []string
+	seen := make(map[string]bool)
+	for _, e := range g.Events {
+		t := e.Type
+		if t == actions.EventRepeat {
+			t = actions.EventFail
+		}
+		for _, rcpt := range a.to[t] {
+			if !seen[rcpt] {
+				seen[rcpt] = true
+				to = append(to, rcpt)
+			}
+		}
+	}
+	return to
+}
+
+// NotifyGroup implements actions.GroupNotifier.
+func (a *action) NotifyGroup(g *actions.Group) error {
+	to := a.groupRecipients(g)
+	if len(to) == 0 {
+		return nil
+	}
+
+	subject, err := a.gSubject.Execute(g)
+	if err != nil {
+		return err
+	}
+	body, err := a.gBody.Execute(g)
+	if err != nil {
+		return err
+	}
+	return a.deliver(to, &message{subject: subject, body: body, group: g})
+}
+
+func (a *action) Init(name string) error {
+	return a.send(a.to[actions.EventInit], &actions.Event{
+		Monitor: name,
+		Type:    actions.EventInit,
+		Time:    time.Now(),
+	})
+}
+
+func (a *action) Fail(name string, v float64) error {
+	return a.Notify(&actions.Event{
+		Monitor:  name,
+		Type:     actions.EventFail,
+		Severity: actions.SeverityCritical,
+		Previous: actions.SeverityOK,
+		Value:    v,
+		Time:     time.Now(),
+	})
+}
+
+func (a *action) Recover(name string, d time.Duration) error {
+	return a.Notify(&actions.Event{
+		Monitor:  name,
+		Type:     actions.EventRecover,
+		Severity: actions.SeverityOK,
+		Previous: actions.SeverityCritical,
+		Duration: d,
+		Time:     time.Now(),
+	})
+}
+
+func (a *action) Notify(e *actions.Event) error {
+	switch e.Type {
+	case actions.EventFail, actions.EventRepeat:
+		return a.send(a.to[actions.EventFail], e)
+	case actions.EventRecover:
+		return a.send(a.to[actions.EventRecover], e)
+	case actions.EventUnknown:
+		return a.send(a.to[actions.EventUnknown], e)
+	}
+	return nil
+}
+
+// Flush implements actions.Flusher.
+// It sends all pending digests.
+func (a *action) Flush() {
+	digestsLock.Lock()
+	l := make([]*digest, 0, len(digests))
+	for _, d := range digests {
+		l = append(l, d)
+	}
+	digestsLock.Unlock()
+
+	for _, d := range l {
+		d.flush()
+	}
+}
+
+// Recipient implements actions.Recipient.
+func (a *action) Recipient() string {
+	return "email:" + strings.Join(a.to[actions.EventFail], ",")
+}
+
+func (a *action) String() string {
+	return fmt.Sprintf("action:email:%s:%s",
+		a.server, strings.Join(a.to[actions.EventFail], ","))
+}
+
+// digest batches messages to the same recipients through the same
+// server into one email.
+type digest struct {
+	a  *action
+	to []string
+
+	lock     sync.Mutex
+	messages []*message
+	timer    *time.Timer
+}
+
+var (
+	digestsLock sync.Mutex
+	digests     = make(map[string]*digest)
+)
+
+func getDigest(a *action, to []string) *digest {
+	key := strings.Join([]string{
+		a.server, a.username, a.from, strings.Join(to, ","), a.digest.String(),
+	}, "\x00")
+
+	digestsLock.Lock()
+	defer digestsLock.Unlock()
+
+	d, ok := digests[key]
+	if !ok {
+		d = &digest{a: a, to: to}
+		digests[key] = d
+	}
+	return d
+}
+
+func (d *digest) add(m *message) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.messages = append(d.messages, m)
+	if len(d.messages) == 1 {
+		d.timer = time.AfterFunc(d.a.digest, d.flush)
+	}
+}
+
+func (d *digest) flush() {
+	d.lock.Lock()
+	messages := d.messages
+	d.messages = nil
+	if d.timer != nil {
+		d.timer.Stop()
+		d.timer = nil
+	}
+	d.lock.Unlock()
+
+	if len(messages) == 0 {
+		return
+	}
+
+	m := messages[0]
+	if len(messages) > 1 {
+		hname, _ := os.Hostname()
+		bodies := make([]string, len(messages))
+		for i, t := range messages {
+			bodies[i] = t.subject + "\n\n" + t.body
+		}
+		m = &message{
+			subject: fmt.Sprintf("[nightwatch] %d notifications from %s", len(messages), hname),
+			body:    strings.Join(bodies, "\n----------------------------------------\n\n"),
+		}
+	}
+
+	err := d.a.sendMail(d.to, m)
+	if err == nil {
+		return
+	}
+	log.Error("action:email: failed to send digest", map[string]interface{}{
+		"server":   d.a.server,
+		"to":       d.to,
+		"messages": len(messages),
+		"error":    err.Error(),
+	})
+
+	// notifications are retried one by one.
+	err = fmt.Errorf("action:email:%s: %v", d.a.server, err)
+	for _, t := range messages {
+		if t.event != nil && t.event.Type == actions.EventInit {
+			continue
+		}
+		actions.Failed(t.actor, t.event, t.group, err)
+	}
+}
+
+func getRecipients(key string, params map[string]interface{}, def []string) ([]string, error) {
+	to, err := nightwatch.GetStringList(key, params)
+	switch err {
+	case nil:
+		return to, nil
+	case nightwatch.ErrNoKey:
+		return def, nil
+	default:
+		return nil, err
+	}
+}
+
+func construct(params map[string]interface{}) (actions.Actor, error) {
+	server, err := nightwatch.GetString("server", params)
+	if err != nil {
+		return nil, err
+	}
+	host, _, err := net.SplitHostPort(server)
+	if err != nil {
+		return nil, err
+	}
+	from, err := nightwatch.GetString("from", params)
+	if err != nil {
+		return nil, err
+	}
+
+	username, err := nightwatch.GetString("username", params)
+	if err != nil && err != nightwatch.ErrNoKey {
+		return nil, err
+	}
+	password, err := nightwatch.GetString("password", params)
+	if err != nil && err != nightwatch.ErrNoKey {
+		return nil, err
+	}
+	startTLS, err := nightwatch.GetBool("starttls", params)
+	switch err {
+	case nil:
+	case nightwatch.ErrNoKey:
+		startTLS = true
+	default:
+		return nil, err
+	}
+	skipVerify, err := nightwatch.GetBool("insecure_skip_verify", params)
+	if err != nil && err != nightwatch.ErrNoKey {
+		return nil, err
+	}
+
+	defTo, err := getRecipients("to", params, nil)
+	if err != nil {
+		return nil, err
+	}
+	to := make(map[string][]string)
+	for _, t := range []string{actions.EventInit, actions.EventFail, actions.EventRecover, actions.EventUnknown} {
+		to[t], err = getRecipients("to_"+t, params, defTo)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(to[actions.EventInit])+len(to[actions.EventFail])+
+		len(to[actions.EventRecover])+len(to[actions.EventUnknown]) == 0 {
+		return nil, errNoRecipients
+	}
+
+	subject, err := actions.TemplateParam("subject", defaultSubject, params)
+	if err != nil {
+		return nil, err
+	}
+	body, err := actions.TemplateParam("body", defaultBody, params)
+	if err != nil {
+		return nil, err
+	}
+	gSubject, err := actions.GroupTemplateParam("group_subject", defaultGroupSubject, params)
+	if err != nil {
+		return nil, err
+	}
+	gBody, err := actions.GroupTemplateParam("group_body", defaultGroupBody, params)
+	if err != nil {
+		return nil, err
+	}
+
+	dig, err := nightwatch.GetInt("digest", params)
+	switch err {
+	case nil:
+		if dig < 0 {
+			return nil, fmt.Errorf("invalid digest: %d", dig)
+		}
+	case nightwatch.ErrNoKey:
+	default:
+		return nil, err
+	}
+	timeout, err := nightwatch.GetInt("timeout", params)
+	switch err {
+	case nil:
+		if timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout: %d", timeout)
+		}
+	case nightwatch.ErrNoKey:
+		timeout = defaultTimeout
+	default:
+		return nil, err
+	}
+
+	return &action{
+		server:     server,
+		host:       host,
+		username:   username,
+		password:   password,
+		from:       from,
+		to:         to,
+		startTLS:   startTLS,
+		skipVerify: skipVerify,
+		subject:    subject,
+		body:       body,
+		gSubject:   gSubject,
+		gBody:      gBody,
+		digest:     time.Duration(dig) * time.Second,
+		timeout:    time.Duration(timeout) * time.Second,
+	}, nil
+}
+
+func init() {
+	actions.Register("email", construct)
+}
@@ -0,0 +1,371 @@
+package email
+
+import (
+	"bufio"
+	"net"
+	"net/textproto"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"nightwatch/actions"
+)
+
+type mail struct {
+	from string
+	to   []string
+	data string
+}
+
+// smtpServer is a minimal SMTP server for tests.
+type smtpServer struct {
+	l net.Listener
+
+	lock  sync.Mutex
+	mails []*mail
+	auth  string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpServer{l: l}
+	go s.serve()
+	return s
+}
+
+func (s *smtpServer) serve() {
+	for {
+		conn, err := s.l.Accept()
+		if err != nil {
+			return
+		}
+		go s.handle(conn)
+	}
+}
+
+func (s *smtpServer) handle(conn net.Conn) {
+	defer conn.Close()
+	tc := textproto.NewConn(conn)
+	tc.PrintfLine("220 localhost ESMTP test")
+
+	m := new(mail)
+	for {
+		line, err := tc.ReadLine()
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.SplitN(line, " ", 2)[0])
+		switch cmd {
+		case "EHLO":
+			tc.PrintfLine("250-localhost")
+			tc.PrintfLine("250 AUTH PLAIN")
+		case "AUTH":
+			s.lock.Lock()
+			s.auth = line
+			s.lock.Unlock()
+			tc.PrintfLine("235 2.7.0 Authentication successful")
+		case "MAIL":
+			m.from = line
+			tc.PrintfLine("250 OK")
+		case "RCPT":
+			m.to = append(m.to, line)
+			tc.PrintfLine("250 OK")
+		case "DATA":
+			tc.PrintfLine("354 Go ahead")
+			data, err := tc.ReadDotBytes()
+			if err != nil {
+				return
+			}
+			m.data = string(data)
+			s.lock.Lock()
+			s.mails = append(s.mails, m)
+			s.lock.Unlock()
+			m = new(mail)
+			tc.PrintfLine("250 OK")
+		case "QUIT":
+			tc.PrintfLine("221 Bye")
+			return
+		default:
+			tc.PrintfLine("250 OK")
+		}
+	}
+}
+
+func (s *smtpServer) received() []*mail {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.mails
+}
+
+func (s *smtpServer) Close() {
+	s.l.Close()
+}
+
+func subjectOf(m *mail) string {
+	r := textproto.NewReader(bufio.NewReader(strings.NewReader(m.data)))
+	h, err := r.ReadMIMEHeader()
+	if err != nil {
+		return ""
+	}
+	return h.Get("Subject")
+}
+
+func TestEmail(t *testing.T) {
+	t.Parallel()
+
+	s := newSMTPServer(t)
+	defer s.Close()
+
+	a, err := construct(map[string]interface{}{
+		"server":     s.l.Addr().String(),
+		"from":       "nightwatch@example.com",
+		"to":         []interface{}{"ops@example.com"},
+		"to_recover": []interface{}{"ops@example.com", "dev@example.com"},
+		"starttls":   false,
+		"to_init":    []interface{}{},
+		"username":   "user",
+		"password":   "pass",
+		"subject":    "{{.Monitor}} {{.Type}}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Init("test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Fail("test", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Recover("test", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	mails := s.received()
+	if len(mails) != 2 {
+		t.Fatal("unexpected number of mails:", len(mails))
+	}
+	if subjectOf(mails[0]) != "test fail" {
+		t.Error("unexpected subject:", subjectOf(mails[0]))
+	}
+	if len(mails[0].to) != 1 {
+		t.Error("unexpected recipients:", mails[0].to)
+	}
+	if subjectOf(mails[1]) != "test recover" {
+		t.Error("unexpected subject:", subjectOf(mails[1]))
+	}
+	if len(mails[1].to) != 2 {
+		t.Error("unexpected recipients:", mails[1].to)
+	}
+	if !strings.Contains(mails[1].data, "Duration: 1m0s") {
+		t.Error("unexpected body:", mails[1].data)
+	}
+	s.lock.Lock()
+	auth := s.auth
+	s.lock.Unlock()
+	if !strings.HasPrefix(auth, "AUTH PLAIN") {
+		t.Error("not authenticated:", auth)
+	}
+}
+
+func TestStartTLS(t *testing.T) {
+	t.Parallel()
+
+	s := newSMTPServer(t)
+	defer s.Close()
+
+	// the test server does not support STARTTLS.
+	a, err := construct(map[string]interface{}{
+		"server":   s.l.Addr().String(),
+		"from":     "nightwatch@example.com",
+		"to":       []interface{}{"ops@example.com"},
+		"username": "user",
+		"password": "pass",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Fail("test", 1); err == nil {
+		t.Error("email is sent without STARTTLS")
+	}
+	if len(s.received()) != 0 {
+		t.Error("unexpected mails:", len(s.received()))
+	}
+	s.lock.Lock()
+	auth := s.auth
+	s.lock.Unlock()
+	if len(auth) > 0 {
+		t.Error("credentials are sent without TLS:", auth)
+	}
+}
+
+func TestCompose(t *testing.T) {
+	t.Parallel()
+
+	a := &action{from: "nightwatch@example.com"}
+	data := string(a.compose([]string{"ops@example.com"}, &message{
+		subject: "test",
+		body:    "line1\nline2\r\nline3\n",
+	}))
+	if !strings.HasSuffix(data, "\r\n\r\nline1\r\nline2\r\nline3\r\n") {
+		t.Errorf("unexpected line endings: %q", data)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	t.Parallel()
+
+	for _, timeout := range []int{0, -1} {
+		_, err := construct(map[string]interface{}{
+			"server":  "localhost:25",
+			"from":    "nightwatch@example.com",
+			"to":      []interface{}{"ops@example.com"},
+			"timeout": timeout,
+		})
+		if err == nil {
+			t.Error("invalid timeout is accepted:", timeout)
+		}
+	}
+}
+
+func TestDigest(t *testing.T) {
+	t.Parallel()
+
+	s := newSMTPServer(t)
+	defer s.Close()
+
+	params := map[string]interface{}{
+		"server":   s.l.Addr().String(),
+		"from":     "nightwatch@example.com",
+		"to":       []interface{}{"digest@example.com"},
+		"digest":   float64(1),
+		"starttls": false,
+	}
+	a1, err := construct(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a2, err := construct(params)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a1.Fail("test1", 1); err != nil {
+		t.Fatal(err)
+	}
+	if err := a2.Fail("test2", 2); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.received()) != 0 {
+		t.Fatal("digest is sent too early")
+	}
+
+	time.Sleep(2 * time.Second)
+	mails := s.received()
+	if len(mails) != 1 {
+		t.Fatal("unexpected number of mails:", len(mails))
+	}
+	if !strings.Contains(subjectOf(mails[0]), "2 notifications") {
+		t.Error("unexpected subject:", subjectOf(mails[0]))
+	}
+	if !strings.Contains(mails[0].data, "test1") || !strings.Contains(mails[0].data, "test2") {
+		t.Error("unexpected body:", mails[0].data)
+	}
+}
+
+func TestDigestFailure(t *testing.T) {
+	// not parallel as this sets the global FailedFunc and flushes
+	// all digests.
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := l.Addr().String()
+	l.Close()
+
+	type failure struct {
+		a   actions.Actor
+		e   *actions.Event
+		err error
+	}
+	var failures []failure
+	actions.SetFailedFunc(func(a actions.Actor, e *actions.Event, g *actions.Group, err error) {
+		failures = append(failures, failure{a, e, err})
+	})
+	defer actions.SetFailedFunc(nil)
+
+	a, err := construct(map[string]interface{}{
+		"server":   server,
+		"from":     "nightwatch@example.com",
+		"to":       []interface{}{"digest-failure@example.com"},
+		"digest":   float64(60),
+		"starttls": false,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.Fail("test", 1); err != nil {
+		t.Fatal(err)
+	}
+	if len(failures) != 0 {
+		t.Fatal("digest is sent too early")
+	}
+
+	a.(actions.Flusher).Flush()
+	if len(failures) != 1 {
+		t.Fatal("failed digest is not reported:", len(failures))
+	}
+	f := failures[0]
+	if f.a != a || f.e == nil || f.e.Type != actions.EventFail || f.err == nil {
+		t.Errorf("unexpected failure: %+v", f)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	t.Parallel()
+
+	s := newSMTPServer(t)
+	defer s.Close()
+
+	a, err := construct(map[string]interface{}{
+		"server":     s.l.Addr().String(),
+		"from":       "nightwatch@example.com",
+		"to":         []interface{}{"ops@example.com"},
+		"to_recover": []interface{}{"dev@example.com"},
+		"starttls":   false,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = actions.NotifyGroup(a, &actions.Group{
+		Receiver: "ops",
+		Labels:   map[string]string{"host": "db1"},
+		Events: []*actions.Event{
+			{Monitor: "ping", Type: actions.EventFail, Severity: actions.SeverityCritical},
+			{Monitor: "disk", Type: actions.EventUnknown, Severity: actions.SeverityUnknown, Error: "timeout"},
+			{Monitor: "load", Type: actions.EventRecover, Severity: actions.SeverityOK},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mails := s.received()
+	if len(mails) != 1 {
+		t.Fatal("unexpected number of mails:", len(mails))
+	}
+	if subjectOf(mails[0]) != "[nightwatch] 2 monitors failing, 1 recovered on host=db1" {
+		t.Error("unexpected subject:", subjectOf(mails[0]))
+	}
+	if len(mails[0].to) != 2 {
+		t.Error("unexpected recipients:", mails[0].to)
+	}
+	if !strings.Contains(mails[0].data, "disk  unknown (timeout)") {
+		t.Error("unexpected body:", mails[0].data)
+	}
+}
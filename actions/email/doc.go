@@ -0,0 +1,54 @@
+/*
+Package email implements "email" action type that sends events by email.
+
+The constructor takes these parameters:
+
+	Name                  Type      Default  Description
+	server                string             SMTP relay address as "host:port".
+	from                  string             Sender address.
+	to                    []string           Recipients of all events.
+	to_init               []string  to       Recipients on monitor startup.
+	to_fail               []string  to       Recipients on monitor failure.
+	to_recover            []string  to       Recipients on monitor recovery.
+	to_unknown            []string  to       Recipients when the probe fails.
+	username              string             Username for SMTP AUTH.  Optional.
+	password              string             Password for SMTP AUTH.  Optional.
+	starttls              bool      true     Require STARTTLS.
+	insecure_skip_verify  bool      false    Skip verification of server certificates.
+	subject               string             Subject template.
+	body                  string             Body template.
+	group_subject         string             Subject template for grouped events.
+	group_body            string             Body template for grouped events.
+	digest                int       0        Seconds to batch emails into a digest.
+	timeout               int       30       Timeout seconds for SMTP sessions.
+
+To disable emails for an event type, give an empty list, e.g. to_init: [].
+At least one event type must have recipients.
+
+subject and body are text/template templates rendered with
+actions.TemplateData, for example:
+
+	subject: "{{.Monitor}} is {{.Severity}} on {{.Host}}"
+	body: "value {{.Value}} is out of [{{.Crit.Min}}, {{.Crit.Max}}]"
+
+Events grouped by the router are sent as one email to the recipients
+of all the events.  group_subject and group_body are rendered with
+actions.GroupTemplateData.
+
+If starttls is true, the server must support STARTTLS; otherwise
+emails are not sent.  Set starttls to false for servers without TLS.
+
+If username is given, the server must support AUTH.  Credentials are
+sent only over TLS unless the server is on localhost.
+
+If digest is positive, emails are not sent immediately.  Instead,
+notifications to the same recipients through the same server are
+collected for digest seconds, even from different monitors, and sent
+as one email.  If a digest email fails, its notifications are retried
+one by one like other failed notifications.  Pending digests are sent
+when monitors stop.
+
+to_fail is also used when the severity of a failing monitor changes,
+and for re-notifications and escalations configured in the monitor.
+*/
+package email
@@ -0,0 +1,190 @@
+package actions
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+// Severity represents how bad the state of a monitor is.
+type Severity string
+
+// Severities of monitors.
+const (
+	SeverityOK       Severity = "ok"
+	SeverityWarning  Severity = "warning"
+	SeverityCritical Severity = "critical"
+
+	// SeverityUnknown means the probe failed to determine the value.
+	SeverityUnknown Severity = "unknown"
+)
+
+// Rank orders severities from good to bad: ok, unknown, warning,
+// and critical.  It is used to summarize severities.
+func (s Severity) Rank() int {
+	switch s {
+	case SeverityUnknown:
+		return 1
+	case SeverityWarning:
+		return 2
+	case SeverityCritical:
+		return 3
+	}
+	return 0
+}
+
+// Event types.
+const (
+	EventInit    = "init"
+	EventFail    = "fail"
+	EventRecover = "recover"
+	EventUnknown = "unknown"
+	EventRepeat  = "repeat"
+)
+
+// Range is a closed range of normal probe results.
+type Range struct {
+	Min float64 `json:"min"`
+	Max float64 `json:"max"`
+}
+
+// Contains returns true if v is within r.
+func (r Range) Contains(v float64) bool {
+	return r.Min <= v && v <= r.Max
+}
+
+// Event describes a state change of a monitor.
+type Event struct {
+	// Monitor is the monitor name.
+	Monitor string `json:"monitor"`
+
+	// Labels identify the series of the monitor for multi-series probes.
+	// nil for ordinary probes.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Type is one of EventFail, EventRecover, or EventUnknown.
+	// EventInit is used only to render templates for Actor.Init.
+	//
+	// EventFail is also used when the severity of a failing
+	// monitor changes, e.g. from warning to critical.
+	//
+	// EventUnknown is used when the probe fails to determine the value.
+	// When the probe succeeds again, EventFail or EventRecover is
+	// sent according to the new severity.
+	//
+	// EventRepeat is used to re-notify an ongoing failure, and to
+	// notify actors of an escalation step.
+	Type string `json:"type"`
+
+	// Severity is the new severity of the monitor.
+	Severity Severity `json:"severity"`
+
+	// Previous is the last known severity before this event.
+	//
+	// This is SeverityUnknown only when the monitor returns from the
+	// unknown state to the same severity as before.
+	Previous Severity `json:"previous"`
+
+	// FailNotified is true if actors have been notified of a failure
+	// of the series since it was last OK, not counting this event.
+	FailNotified bool `json:"fail_notified,omitempty"`
+
+	// Value is the returned value from the probe (or a value from filters).
+	Value float64 `json:"value"`
+
+	// Crit and Warn are the thresholds of the monitor.
+	// Values out of Crit are critical, and out of Warn are warnings.
+	Crit Range `json:"crit"`
+	Warn Range `json:"warn"`
+
+	// Error describes why the probe failed.  Set for EventUnknown.
+	Error string `json:"error,omitempty"`
+
+	// Message is the message returned by the probe, if any.
+	Message string `json:"message,omitempty"`
+
+	// FailedAt is the time when the current failure started.
+	FailedAt time.Time `json:"failed_at"`
+
+	// Duration is the failure duration.  Set for EventRecover.
+	Duration time.Duration `json:"duration"`
+
+	// Time is the time when the event happened.
+	Time time.Time `json:"time"`
+
+	// Repeat counts re-notifications of the failure in a day.
+	// Zero for notifications of escalation steps.
+	Repeat int `json:"repeat,omitempty"`
+
+	// Escalation is the reached escalation step starting from 1.
+	// Zero if the failure has not been escalated.
+	Escalation int `json:"escalation,omitempty"`
+
+	// Suppressed counts notifications to the same actor or recipient
+	// suppressed by rate limits since the last delivered one.
+	Suppressed int `json:"suppressed,omitempty"`
+}
+
+// Name returns the monitor name followed by formatted labels if any,
+// e.g. "disk{mount=/var}".
+func (e *Event) Name() string {
+	if len(e.Labels) == 0 {
+		return e.Monitor
+	}
+	return e.Monitor + "{" + FormatLabels(e.Labels) + "}"
+}
+
+// FormatLabels formats labels as "key1=value1,key2=value2" sorted by keys.
+func FormatLabels(labels map[string]string) string {
+	keys := make([]string, 0, len(labels))
+	for k := range labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	l := make([]string, 0, len(keys))
+	for _, k := range keys {
+		l = append(l, k+"="+labels[k])
+	}
+	return strings.Join(l, ",")
+}
+
+// Notifier is an optional interface for actors.
+//
+// If an actor implements Notifier, Notify is called for every event
+// instead of Fail and Recover.
+type Notifier interface {
+	// Notify is called when the state of a monitor changes.
+	//
+	// Non-nil error is logged, but will not stop the monitor.
+	Notify(e *Event) error
+}
+
+// Notify delivers e to a.
+//
+// If a does not implement Notifier, Fail is called only when the monitor
+// starts failing or is re-notified, and Recover when it recovers from
+// a failure that has been notified.  EventUnknown is not delivered to
+// such actors.  For multi-series monitors, the monitor name passed to
+// such actors is e.Name().
+func Notify(a Actor, e *Event) error {
+	if n, ok := a.(Notifier); ok {
+		return n.Notify(e)
+	}
+
+	switch e.Type {
+	case EventFail:
+		if e.FailNotified {
+			return nil
+		}
+		return a.Fail(e.Name(), e.Value)
+	case EventRepeat:
+		return a.Fail(e.Name(), e.Value)
+	case EventRecover:
+		if !e.FailNotified {
+			return nil
+		}
+		return a.Recover(e.Name(), e.Duration)
+	}
+	return nil
+}
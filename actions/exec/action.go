@@ -0,0 +1,259 @@
+package exec
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"nightwatch"
+	"nightwatch/actions"
+	"nightwatch/util/cmd"
+	"nightwatch/util/log"
+)
+
+const (
+	defaultTimeout        = 60
+	defaultMaxConcurrency = 1
+)
+
+var (
+	errBusy = errors.New("too many commands are running")
+)
+
+type action struct {
+	cmdInit        []string
+	cmdFail        []string
+	cmdRecover     []string
+	cmdUnknown     []string
+	env            map[string]string
+	timeout        time.Duration
+	maxConcurrency int
+
+	lock sync.Mutex
+	sems map[string]chan struct{}
+}
+
+// semaphore returns the semaphore to limit concurrent commands of a monitor.
+func (a *action) semaphore(name string) chan struct{} {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	sem, ok := a.sems[name]
+	if !ok {
+		sem = make(chan struct{}, a.maxConcurrency)
+		a.sems[name] = sem
+	}
+	return sem
+}
+
+// duration returns the failure duration of e.  For events other than
+// recover, it is the time since the failure started, or zero.
+func duration(e *actions.Event) time.Duration {
+	if e.Type == actions.EventRecover || e.FailedAt.IsZero() || e.Time.IsZero() {
+		return e.Duration
+	}
+	return e.Time.Sub(e.FailedAt)
+}
+
+func environ(e *actions.Event) []string {
+	env := []string{
+		"NIGHTWATCH_MONITOR=" + e.Monitor,
+		"NIGHTWATCH_EVENT=" + e.Type,
+	}
+	if e.Type == actions.EventInit {
+		return env
+	}
+
+	env = append(env,
+		"NIGHTWATCH_SEVERITY="+string(e.Severity),
+		"NIGHTWATCH_PREVIOUS="+string(e.Previous),
+		"NIGHTWATCH_LABELS="+actions.FormatLabels(e.Labels),
+		"NIGHTWATCH_VALUE="+strconv.FormatFloat(e.Value, 'g', -1, 64),
+		"NIGHTWATCH_DURATION="+strconv.Itoa(int(duration(e).Seconds())),
+		"NIGHTWATCH_ERROR="+e.Error,
+		"NIGHTWATCH_MESSAGE="+e.Message,
+	)
+	return env
+}
+
+func (a *action) run(command []string, e *actions.Event) error {
+	if len(command) == 0 {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	defer cancel()
+
+	sem := a.semaphore(e.Monitor)
+	select {
+	case sem <- struct{}{}:
+	case <-ctx.Done():
+		return fmt.Errorf("action:exec:%s: %v", command[0], errBusy)
+	}
+	defer func() {
+		<-sem
+	}()
+
+	c := cmd.CommandContext(ctx, command[0], command[1:]...)
+	c.Env = os.Environ()
+	for k, v := range a.env {
+		c.Env = append(c.Env, k+"="+v)
+	}
+	c.Env = append(c.Env, environ(e)...)
+
+	// results are logged below together with the output.
+	st := time.Now()
+	output, err := c.Cmd.CombinedOutput()
+
+	fields := c.Fields
+	fields[log.FnType] = "exec"
+	fields[log.FnResponseTime] = time.Since(st).Seconds()
+	fields["command"] = c.Path
+	fields["args"] = c.Args
+	fields["monitor"] = e.Name()
+	fields["event"] = e.Type
+	if len(output) > 0 {
+		fields["output"] = cmd.UTF8StringFromBytes(output)
+	}
+
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			err = fmt.Errorf("timed out after %s: %v", a.timeout, err)
+		}
+		fields["error"] = err.Error()
+		log.Error("action:exec", fields)
+		return fmt.Errorf("action:exec:%s: %v", command[0], err)
+	}
+	log.Info("action:exec", fields)
+	return nil
+}
+
+func (a *action) Init(name string) error {
+	return a.run(a.cmdInit, &actions.Event{
+		Monitor: name,
+		Type:    actions.EventInit,
+		Time:    time.Now(),
+	})
+}
+
+func (a *action) Fail(name string, v float64) error {
+	return a.Notify(&actions.Event{
+		Monitor:  name,
+		Type:     actions.EventFail,
+		Severity: actions.SeverityCritical,
+		Previous: actions.SeverityOK,
+		Value:    v,
+		Time:     time.Now(),
+	})
+}
+
+func (a *action) Recover(name string, d time.Duration) error {
+	return a.Notify(&actions.Event{
+		Monitor:  name,
+		Type:     actions.EventRecover,
+		Severity: actions.SeverityOK,
+		Previous: actions.SeverityCritical,
+		Duration: d,
+		Time:     time.Now(),
+	})
+}
+
+func (a *action) Notify(e *actions.Event) error {
+	switch e.Type {
+	case actions.EventFail, actions.EventRepeat:
+		return a.run(a.cmdFail, e)
+	case actions.EventRecover:
+		return a.run(a.cmdRecover, e)
+	case actions.EventUnknown:
+		return a.run(a.cmdUnknown, e)
+	}
+	return nil
+}
+
+func (a *action) String() string {
+	return fmt.Sprintf("action:exec:%s:%s:%s",
+		strings.Join(a.cmdInit, " "),
+		strings.Join(a.cmdFail, " "),
+		strings.Join(a.cmdRecover, " "))
+}
+
+func getCommand(key string, params map[string]interface{}) ([]string, error) {
+	command, err := nightwatch.GetStringList(key, params)
+	switch err {
+	case nil:
+		if len(command) == 0 {
+			return nil, fmt.Errorf("empty command: %s", key)
+		}
+		return command, nil
+	case nightwatch.ErrNoKey:
+		return nil, nil
+	default:
+		return nil, err
+	}
+}
+
+func construct(params map[string]interface{}) (actions.Actor, error) {
+	cmdInit, err := getCommand("command_init", params)
+	if err != nil {
+		return nil, err
+	}
+	cmdFail, err := getCommand("command_fail", params)
+	if err != nil {
+		return nil, err
+	}
+	cmdRecover, err := getCommand("command_recover", params)
+	if err != nil {
+		return nil, err
+	}
+	cmdUnknown, err := getCommand("command_unknown", params)
+	if err != nil {
+		return nil, err
+	}
+
+	env, err := nightwatch.GetStringMap("env", params)
+	if err != nil && err != nightwatch.ErrNoKey {
+		return nil, err
+	}
+	timeout, err := nightwatch.GetInt("timeout", params)
+	switch err {
+	case nil:
+		if timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout: %d", timeout)
+		}
+	case nightwatch.ErrNoKey:
+		timeout = defaultTimeout
+	default:
+		return nil, err
+	}
+	maxConcurrency, err := nightwatch.GetInt("max_concurrency", params)
+	switch err {
+	case nil:
+		if maxConcurrency <= 0 {
+			return nil, fmt.Errorf("invalid max_concurrency: %d", maxConcurrency)
+		}
+	case nightwatch.ErrNoKey:
+		maxConcurrency = defaultMaxConcurrency
+	default:
+		return nil, err
+	}
+
+	return &action{
+		cmdInit:        cmdInit,
+		cmdFail:        cmdFail,
+		cmdRecover:     cmdRecover,
+		cmdUnknown:     cmdUnknown,
+		env:            env,
+		timeout:        time.Duration(timeout) * time.Second,
+		maxConcurrency: maxConcurrency,
+		sems:           make(map[string]chan struct{}),
+	}, nil
+}
+
+func init() {
+	actions.Register("exec", construct)
+}
@@ -0,0 +1,154 @@
+package exec
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"nightwatch/actions"
+)
+
+func TestExec(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "nightwatch-exec")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	out := filepath.Join(dir, "out")
+
+	a, err := construct(map[string]interface{}{
+		"command_fail": []interface{}{
+			"sh", "-c", `echo "$NIGHTWATCH_MONITOR $NIGHTWATCH_EVENT $NIGHTWATCH_VALUE $FOO" > ` + out,
+		},
+		"command_recover": []interface{}{
+			"sh", "-c", `echo "$NIGHTWATCH_EVENT $NIGHTWATCH_DURATION" > ` + out,
+		},
+		"env": map[string]interface{}{"FOO": "bar"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Init("test"); err != nil {
+		t.Error(err)
+	}
+	if err := a.Fail("test", 1.5); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := strings.TrimSpace(string(data)); s != "test fail 1.5 bar" {
+		t.Error(`unexpected output:`, s)
+	}
+
+	if err := a.Recover("test", 90*time.Second); err != nil {
+		t.Fatal(err)
+	}
+	data, err = ioutil.ReadFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s := strings.TrimSpace(string(data)); s != "recover 90" {
+		t.Error(`unexpected output:`, s)
+	}
+}
+
+func TestEnviron(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	env := environ(&actions.Event{
+		Monitor:  "disk",
+		Labels:   map[string]string{"mount": "/", "host": "h1"},
+		Type:     actions.EventRepeat,
+		FailedAt: now.Add(-2 * time.Minute),
+		Time:     now,
+	})
+
+	expected := []string{
+		"NIGHTWATCH_LABELS=host=h1,mount=/",
+		"NIGHTWATCH_DURATION=120",
+	}
+	for _, kv := range expected {
+		found := false
+		for _, t := range env {
+			if t == kv {
+				found = true
+			}
+		}
+		if !found {
+			t.Error("not found:", kv, env)
+		}
+	}
+}
+
+func TestExecError(t *testing.T) {
+	t.Parallel()
+
+	a, err := construct(map[string]interface{}{
+		"command_fail":    []interface{}{"sh", "-c", "exit 1"},
+		"command_recover": []interface{}{"sleep", "10"},
+		"timeout":         float64(1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := a.Fail("test", 1); err == nil {
+		t.Error("non-zero exit status should be an error")
+	}
+
+	st := time.Now()
+	if err := a.Recover("test", time.Second); err == nil {
+		t.Error("timed out command should be an error")
+	}
+	if time.Since(st) > 5*time.Second {
+		t.Error("command is not killed on timeout")
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	t.Parallel()
+
+	a, err := construct(map[string]interface{}{
+		"command_fail":    []interface{}{"sleep", "1"},
+		"max_concurrency": float64(1),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := a.(actions.Notifier)
+
+	run := func(names ...string) time.Duration {
+		st := time.Now()
+		done := make(chan error)
+		for _, name := range names {
+			go func(name string) {
+				done <- n.Notify(&actions.Event{Monitor: name, Type: actions.EventFail})
+			}(name)
+		}
+		for range names {
+			if err := <-done; err != nil {
+				t.Error(err)
+			}
+		}
+		return time.Since(st)
+	}
+
+	// commands for the same monitor run one by one.
+	if d := run("test", "test"); d < 2*time.Second {
+		t.Error("concurrency limit is not enforced:", d)
+	}
+
+	// commands for different monitors run concurrently.
+	if d := run("test1", "test2"); d >= 2*time.Second {
+		t.Error("commands for different monitors are serialized:", d)
+	}
+}
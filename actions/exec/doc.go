@@ -0,0 +1,45 @@
+/*
+Package exec implements "exec" action type that runs commands on events.
+
+The constructor takes these parameters:
+
+	Name             Type      Default  Description
+	command_init     []string           Command to run on monitor startup.  Optional.
+	command_fail     []string           Command to run on monitor failure.  Optional.
+	command_recover  []string           Command to run on monitor recovery.  Optional.
+	command_unknown  []string           Command to run when the probe fails.  Optional.
+	env              map                Extra environment variables.  Optional.
+	timeout          int       60       Timeout seconds for a command.
+	max_concurrency  int       1        Maximum number of commands running for a monitor.
+
+The first element of a command is the program to run, and the rest
+are its arguments.  The program is searched in PATH if it does not
+contain a slash.
+
+Commands inherit the environment of nightwatch, plus these variables:
+
+	Name                  Description
+	NIGHTWATCH_MONITOR    Monitor name.
+	NIGHTWATCH_EVENT      Event type: init, fail, recover, unknown or repeat.
+	NIGHTWATCH_SEVERITY   Current severity.
+	NIGHTWATCH_PREVIOUS   Previous severity.
+	NIGHTWATCH_LABELS     Labels of the series, formatted as k1=v1,k2=v2 sorted by keys.
+	NIGHTWATCH_VALUE      Probe result.
+	NIGHTWATCH_DURATION   Seconds since the failure started, or the failure
+	                      duration for recover events.  0 if not failing.
+	NIGHTWATCH_ERROR      Probe error for unknown events.
+	NIGHTWATCH_MESSAGE    Probe message.
+
+Commands are killed when they do not finish within the timeout.
+If max_concurrency commands are already running for the monitor,
+the next one waits for a slot until the timeout expires.
+
+Outputs of commands are logged together with the monitor name and
+the event type.  A command that exits with non-zero status is
+reported as an error, so that the notification is retried if
+retries are enabled.
+
+command_fail is also run when the severity of a failing monitor changes,
+and for re-notifications and escalations configured in the monitor.
+*/
+package exec
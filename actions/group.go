@@ -0,0 +1,92 @@
+package actions
+
+import (
+	"time"
+)
+
+// Group is a set of events merged into one notification.
+//
+// Groups are made by the router from events that arrive within the
+// group wait of a route and share the labels of the route's group_by.
+type Group struct {
+	// Receiver is the name of the receiver of the group.
+	Receiver string `json:"receiver"`
+
+	// Labels are the labels shared by events of the group.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Events are ordered by the time they happened.
+	Events []*Event `json:"events"`
+}
+
+// Failing returns events that are not recoveries.
+func (g *Group) Failing() []*Event {
+	var l []*Event
+	for _, e := range g.Events {
+		if e.Severity != SeverityOK {
+			l = append(l, e)
+		}
+	}
+	return l
+}
+
+// Recovered returns recovery events.
+func (g *Group) Recovered() []*Event {
+	var l []*Event
+	for _, e := range g.Events {
+		if e.Severity == SeverityOK {
+			l = append(l, e)
+		}
+	}
+	return l
+}
+
+// Severity returns the worst severity among events.
+func (g *Group) Severity() Severity {
+	sev := SeverityOK
+	for _, e := range g.Events {
+		if e.Severity.Rank() > sev.Rank() {
+			sev = e.Severity
+		}
+	}
+	return sev
+}
+
+// Time returns the time of the latest event.
+func (g *Group) Time() time.Time {
+	var t time.Time
+	for _, e := range g.Events {
+		if e.Time.After(t) {
+			t = e.Time
+		}
+	}
+	return t
+}
+
+// GroupNotifier is an optional interface for actors.
+//
+// If an actor implements GroupNotifier, events grouped by the router
+// are delivered as one notification.
+type GroupNotifier interface {
+	// NotifyGroup is called with two or more grouped events.
+	//
+	// Non-nil error is logged, but will not stop the monitor.
+	NotifyGroup(g *Group) error
+}
+
+// NotifyGroup delivers g to a.
+//
+// If a does not implement GroupNotifier, events are delivered one by
+// one with Notify.  The first error stops the delivery.
+func NotifyGroup(a Actor, g *Group) error {
+	if n, ok := a.(GroupNotifier); ok {
+		return n.NotifyGroup(g)
+	}
+
+	for _, e := range g.Events {
+		if err := Notify(a, e); err != nil {
+			return err
+		}
+	}
+	return nil
+}
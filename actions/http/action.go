@@ -2,6 +2,7 @@ package http
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
@@ -17,7 +18,11 @@ import (
 )
 
 const (
-	defaultTimeout = 30
+	defaultTimeout     = 30
+	defaultContentType = "application/json"
+
+	// maxResponseSize limits the size of response bodies to read.
+	maxResponseSize = 1 << 20
 )
 
 var (
@@ -25,25 +30,28 @@ var (
 )
 
 type action struct {
-	urlInit    *url.URL
-	urlFail    *url.URL
-	urlRecover *url.URL
-	method     string
-	header     map[string]string
-	params     map[string]string
-	timeout    time.Duration
+	urlInit     *url.URL
+	urlFail     *url.URL
+	urlRecover  *url.URL
+	urlUnknown  *url.URL
+	method      string
+	header      map[string]string
+	params      map[string]string
+	body        *actions.Template
+	contentType string
+	timeout     time.Duration
 }
 
-func processResponse(u *url.URL, resp *http.Response) error {
+func processResponse(u *url.URL, resp *http.Response) ([]byte, error) {
 	defer func() {
 		io.Copy(ioutil.Discard, resp.Body)
 		resp.Body.Close()
 	}()
 
 	if 200 <= resp.StatusCode && resp.StatusCode < 300 {
-		return nil
+		return ioutil.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
 	}
-	return fmt.Errorf("action:http:%s %s", u.String(), resp.Status)
+	return nil, fmt.Errorf("action:http:%s %s", u.String(), resp.Status)
 }
 
 func (a *action) request(u *url.URL, params map[string]string) error {
@@ -68,17 +76,38 @@ func (a *action) request(u *url.URL, params map[string]string) error {
 		header.Set(k, v)
 	}
 
-	var body io.ReadCloser
-	var length int64
 	if a.method == http.MethodGet {
 		tu.RawQuery = data
-	} else {
-		header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return a.do(&tu, header, "")
+	}
+	header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return a.do(&tu, header, data)
+}
+
+func (a *action) requestBody(u *url.URL, body string) error {
+	header := make(http.Header)
+	for k, v := range a.header {
+		header.Set(k, v)
+	}
+	header.Set("Content-Type", a.contentType)
+	return a.do(u, header, body)
+}
+
+func (a *action) do(u *url.URL, header http.Header, data string) error {
+	_, err := doRequest(a.method, u, header, data, a.timeout)
+	return err
+}
+
+func doRequest(method string, u *url.URL, header http.Header, data string, timeout time.Duration) ([]byte, error) {
+	var body io.ReadCloser
+	var length int64
+	if len(data) > 0 {
 		length = int64(len(data))
 		body = ioutil.NopCloser(strings.NewReader(data))
 	}
+	tu := *u
 	req := &http.Request{
-		Method:        a.method,
+		Method:        method,
 		URL:           &tu,
 		Proto:         "HTTP/1.1",
 		ProtoMajor:    1,
@@ -89,58 +118,124 @@ func (a *action) request(u *url.URL, params map[string]string) error {
 		Host:          u.Host,
 	}
 
-	if a.timeout > 0 {
-		ctx, cancel := context.WithTimeout(context.Background(), a.timeout)
+	if timeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
 		defer cancel()
 		req = req.WithContext(ctx)
 	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	return processResponse(u, resp)
 }
 
-func (a *action) Init(name string) error {
-	if a.urlInit == nil {
-		return nil
+// PostJSON sends v encoded in JSON to u by POST, and returns the
+// response body.
+//
+// This is intended for actions built on HTTP APIs.
+// header may be nil.  User-Agent defaults to nightwatch.
+// Non-2xx responses are returned as errors.
+func PostJSON(u *url.URL, header map[string]string, v interface{}, timeout time.Duration) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
 	}
-	params := make(map[string]string)
-	for k, v := range a.params {
-		params[k] = v
+
+	h := make(http.Header)
+	h.Set("User-Agent", "nightwatch."+nightwatch.Version)
+	for k, v := range header {
+		h.Set(k, v)
 	}
-	params["monitor"] = name
-	params["event"] = "init"
-	return a.request(a.urlInit, params)
+	h.Set("Content-Type", "application/json")
+	return doRequest(http.MethodPost, u, h, string(data), timeout)
 }
 
-func (a *action) Fail(name string, v float64) error {
-	if a.urlFail == nil {
+func (a *action) send(u *url.URL, e *actions.Event) error {
+	if u == nil {
 		return nil
 	}
+
+	if a.body != nil {
+		body, err := a.body.Execute(e)
+		if err != nil {
+			return err
+		}
+		return a.requestBody(u, body)
+	}
+
 	params := make(map[string]string)
 	for k, v := range a.params {
 		params[k] = v
 	}
-	params["monitor"] = name
-	params["event"] = "fail"
-	params["value"] = fmt.Sprintf("%g", v) // %g suppresses trailing zeroes.
-	return a.request(a.urlFail, params)
+	params["monitor"] = e.Monitor
+	params["event"] = e.Type
+	if e.Type == actions.EventInit {
+		return a.request(u, params)
+	}
+
+	params["severity"] = string(e.Severity)
+	if len(e.Labels) > 0 {
+		params["labels"] = actions.FormatLabels(e.Labels)
+	}
+	switch e.Type {
+	case actions.EventFail:
+		params["value"] = fmt.Sprintf("%g", e.Value) // %g suppresses trailing zeroes.
+	case actions.EventRepeat:
+		params["value"] = fmt.Sprintf("%g", e.Value)
+		params["duration"] = strconv.Itoa(int(e.Duration.Seconds()))
+	case actions.EventRecover:
+		params["duration"] = strconv.Itoa(int(e.Duration.Seconds()))
+	case actions.EventUnknown:
+		params["error"] = e.Error
+	}
+	if len(e.Message) > 0 {
+		params["message"] = e.Message
+	}
+	return a.request(u, params)
+}
+
+func (a *action) Init(name string) error {
+	return a.send(a.urlInit, &actions.Event{
+		Monitor: name,
+		Type:    actions.EventInit,
+		Time:    time.Now(),
+	})
+}
+
+func (a *action) Fail(name string, v float64) error {
+	return a.Notify(&actions.Event{
+		Monitor:  name,
+		Type:     actions.EventFail,
+		Severity: actions.SeverityCritical,
+		Previous: actions.SeverityOK,
+		Value:    v,
+		Time:     time.Now(),
+	})
 }
 
 func (a *action) Recover(name string, d time.Duration) error {
-	if a.urlRecover == nil {
-		return nil
-	}
-	params := make(map[string]string)
-	for k, v := range a.params {
-		params[k] = v
+	return a.Notify(&actions.Event{
+		Monitor:  name,
+		Type:     actions.EventRecover,
+		Severity: actions.SeverityOK,
+		Previous: actions.SeverityCritical,
+		Duration: d,
+		Time:     time.Now(),
+	})
+}
+
+func (a *action) Notify(e *actions.Event) error {
+	switch e.Type {
+	case actions.EventFail, actions.EventRepeat:
+		return a.send(a.urlFail, e)
+	case actions.EventRecover:
+		return a.send(a.urlRecover, e)
+	case actions.EventUnknown:
+		return a.send(a.urlUnknown, e)
 	}
-	params["monitor"] = name
-	params["event"] = "recover"
-	params["duration"] = strconv.Itoa(int(d.Seconds()))
-	return a.request(a.urlRecover, params)
+	return nil
 }
 
 func (a *action) String() string {
@@ -149,7 +244,7 @@ func (a *action) String() string {
 }
 
 func construct(params map[string]interface{}) (actions.Actor, error) {
-	var uI, uF, uR *url.URL
+	var uI, uF, uR, uU *url.URL
 	urlInit, err := nightwatch.GetString("url_init", params)
 	switch err {
 	case nil:
@@ -184,11 +279,47 @@ func construct(params map[string]interface{}) (actions.Actor, error) {
 		return nil, err
 	}
 
+	urlUnknown, err := nightwatch.GetString("url_unknown", params)
+	switch err {
+	case nil:
+		uU, err = url.Parse(urlUnknown)
+		if err != nil {
+			return nil, err
+		}
+	case nightwatch.ErrNoKey:
+	default:
+		return nil, err
+	}
+
+	var bodyTmpl *actions.Template
+	body, err := nightwatch.GetString("body", params)
+	switch err {
+	case nil:
+		bodyTmpl, err = actions.NewTemplate("body", body)
+		if err != nil {
+			return nil, fmt.Errorf("invalid body template: %v", err)
+		}
+	case nightwatch.ErrNoKey:
+	default:
+		return nil, err
+	}
+	contentType, err := nightwatch.GetString("content_type", params)
+	switch err {
+	case nil:
+	case nightwatch.ErrNoKey:
+		contentType = defaultContentType
+	default:
+		return nil, err
+	}
+
 	method, err := nightwatch.GetString("method", params)
 	switch err {
 	case nil:
 	case nightwatch.ErrNoKey:
 		method = http.MethodGet
+		if bodyTmpl != nil {
+			method = http.MethodPost
+		}
 	default:
 		return nil, err
 	}
@@ -222,13 +353,16 @@ func construct(params map[string]interface{}) (actions.Actor, error) {
 	}
 
 	return &action{
-		urlInit:    uI,
-		urlFail:    uF,
-		urlRecover: uR,
-		method:     method,
-		header:     header,
-		params:     formParams,
-		timeout:    time.Duration(timeout) * time.Second,
+		urlInit:     uI,
+		urlFail:     uF,
+		urlRecover:  uR,
+		urlUnknown:  uU,
+		method:      method,
+		header:      header,
+		params:      formParams,
+		body:        bodyTmpl,
+		contentType: contentType,
+		timeout:     time.Duration(timeout) * time.Second,
 	}, nil
 }
 
@@ -6,9 +6,13 @@ GET or POST form variables are automatically appended as follows:
     Name           Description
     monitor        The monitor name.
     host           Hostname where nightwatch.server is running.
-    event          One of "init", "fail", or "recover".
-    value          The probe(filter) value.  Appended on failure.
-    duration       Failure duration in seconds.  Appended on recovery.
+    event          One of "init", "fail", "recover", "unknown", or "repeat".
+    value          The probe(filter) value.  Appended on failure and repeat.
+    severity       One of "ok", "warning", "critical", or "unknown".  Not appended on init.
+    error          Why the probe failed.  Appended on unknown.
+    message        The message from the probe, if any.
+    labels         Labels of the series such as "mount=/var".  Multi-series probes only.
+    duration       Failure duration in seconds.  Appended on recovery and repeat.
     version        nightwatch.version such as "0.1".
 
 The constructor takes these parameters:
@@ -17,15 +21,28 @@ The constructor takes these parameters:
     url_init     string                      URL to access on monitor startup.  Optional.
     url_fail     string                      URL to access on monitor failure.  Optional.
     url_recover  string                      URL to access on monitor recovery.  Optional.
+    url_unknown  string                      URL to access when the probe fails.  Optional.
     method       string             GET      HTTP method to use.
+                                             POST if body is given.
     agent        string             nightwatch.0.1 User-Agent string.
     header       map[string]string  nil      HTTP headers.
     params       map[string]string  nil      Additional form parameters.
+    body         string                      Body template.  Optional.
+    content_type string             application/json  Content-Type of the rendered body.
     timeout      int                30       Timeout seconds for requests.
                                              Zero means the default timeout.
 
+If body is given, it is rendered as a text/template with
+actions.TemplateData and sent as the request body instead of the form
+variables.  Use the "json" function to embed values safely:
+
+    body: '{"text": {{json (printf "%s is %s" .Name .Severity)}}, "value": {{.Value}}}'
+
 If URL is not given for an event type, no request is sent for the event.
 
+url_fail is also accessed when the severity of a failing monitor changes,
+e.g. from warning to critical, and for re-notifications ("repeat").
+
 Proxy can be specified through environment variables.
 See net.http.ProxyFromEnvironment for details.
 
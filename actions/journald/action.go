@@ -0,0 +1,189 @@
+package journald
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"nightwatch"
+	"nightwatch/actions"
+)
+
+const (
+	defaultSocket     = "/run/systemd/journal/socket"
+	defaultIdentifier = "nightwatch"
+
+	defaultMessage = `{{.Name}} {{.Type}}` +
+		`{{if or (eq .Type "fail") (eq .Type "repeat")}}: severity={{.Severity}} value={{.Value}}` +
+		`{{else if eq .Type "recover"}}: failed for {{.Duration}}` +
+		`{{else if eq .Type "unknown"}}: {{.Error}}{{end}}` +
+		`{{if .Message}} ({{.Message}}){{end}}`
+)
+
+// syslog priorities used for PRIORITY field.
+const (
+	prioCritical = "2"
+	prioError    = "3"
+	prioWarning  = "4"
+	prioNotice   = "5"
+	prioInfo     = "6"
+)
+
+type action struct {
+	socket     string
+	identifier string
+	message    *actions.Template
+}
+
+func priority(e *actions.Event) string {
+	switch e.Type {
+	case actions.EventInit:
+		return prioInfo
+	case actions.EventRecover:
+		return prioNotice
+	case actions.EventUnknown:
+		return prioError
+	}
+	if e.Severity == actions.SeverityWarning {
+		return prioWarning
+	}
+	return prioCritical
+}
+
+// appendField appends a field in the native journal protocol.
+// Values containing newlines are serialized in the binary form.
+func appendField(b *bytes.Buffer, name, value string) {
+	if !strings.Contains(value, "\n") {
+		b.WriteString(name + "=" + value + "\n")
+		return
+	}
+
+	b.WriteString(name + "\n")
+	binary.Write(b, binary.LittleEndian, uint64(len(value)))
+	b.WriteString(value + "\n")
+}
+
+func (a *action) format(e *actions.Event) ([]byte, error) {
+	msg, err := a.message.Execute(e)
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	appendField(&b, "MESSAGE", msg)
+	appendField(&b, "PRIORITY", priority(e))
+	appendField(&b, "SYSLOG_IDENTIFIER", a.identifier)
+	appendField(&b, "NIGHTWATCH_MONITOR", e.Monitor)
+	appendField(&b, "NIGHTWATCH_EVENT", e.Type)
+	if e.Type != actions.EventInit {
+		appendField(&b, "NIGHTWATCH_SEVERITY", string(e.Severity))
+		appendField(&b, "NIGHTWATCH_PREVIOUS", string(e.Previous))
+	}
+	if len(e.Labels) > 0 {
+		appendField(&b, "NIGHTWATCH_LABELS", actions.FormatLabels(e.Labels))
+	}
+	switch e.Type {
+	case actions.EventFail, actions.EventRepeat:
+		appendField(&b, "NIGHTWATCH_VALUE", strconv.FormatFloat(e.Value, 'g', -1, 64))
+	case actions.EventRecover:
+		appendField(&b, "NIGHTWATCH_DURATION", strconv.Itoa(int(e.Duration.Seconds())))
+	case actions.EventUnknown:
+		appendField(&b, "NIGHTWATCH_ERROR", e.Error)
+	}
+	return b.Bytes(), nil
+}
+
+func (a *action) send(e *actions.Event) error {
+	data, err := a.format(e)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialUnix("unixgram", nil, &net.UnixAddr{Name: a.socket, Net: "unixgram"})
+	if err != nil {
+		return fmt.Errorf("action:journald: %v", err)
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(data)
+	if err != nil {
+		return fmt.Errorf("action:journald: %v", err)
+	}
+	return nil
+}
+
+func (a *action) Init(name string) error {
+	return a.send(&actions.Event{
+		Monitor: name,
+		Type:    actions.EventInit,
+		Time:    time.Now(),
+	})
+}
+
+func (a *action) Fail(name string, v float64) error {
+	return a.Notify(&actions.Event{
+		Monitor:  name,
+		Type:     actions.EventFail,
+		Severity: actions.SeverityCritical,
+		Previous: actions.SeverityOK,
+		Value:    v,
+		Time:     time.Now(),
+	})
+}
+
+func (a *action) Recover(name string, d time.Duration) error {
+	return a.Notify(&actions.Event{
+		Monitor:  name,
+		Type:     actions.EventRecover,
+		Severity: actions.SeverityOK,
+		Previous: actions.SeverityCritical,
+		Duration: d,
+		Time:     time.Now(),
+	})
+}
+
+func (a *action) Notify(e *actions.Event) error {
+	return a.send(e)
+}
+
+func (a *action) String() string {
+	return "action:journald:" + a.socket
+}
+
+func construct(params map[string]interface{}) (actions.Actor, error) {
+	socket, err := nightwatch.GetString("socket", params)
+	switch err {
+	case nil:
+	case nightwatch.ErrNoKey:
+		socket = defaultSocket
+	default:
+		return nil, err
+	}
+	identifier, err := nightwatch.GetString("identifier", params)
+	switch err {
+	case nil:
+	case nightwatch.ErrNoKey:
+		identifier = defaultIdentifier
+	default:
+		return nil, err
+	}
+
+	message, err := actions.TemplateParam("message", defaultMessage, params)
+	if err != nil {
+		return nil, err
+	}
+
+	return &action{
+		socket:     socket,
+		identifier: identifier,
+		message:    message,
+	}, nil
+}
+
+func init() {
+	actions.Register("journald", construct)
+}
@@ -0,0 +1,98 @@
+package journald
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"nightwatch/actions"
+)
+
+// parse decodes a datagram of the native journal protocol.
+func parse(t *testing.T, data []byte) map[string]string {
+	fields := make(map[string]string)
+	for len(data) > 0 {
+		i := bytes.IndexAny(data, "=\n")
+		if i < 0 {
+			t.Fatal("malformed data:", string(data))
+		}
+		name := string(data[:i])
+		if data[i] == '=' {
+			j := bytes.IndexByte(data, '\n')
+			fields[name] = string(data[i+1 : j])
+			data = data[j+1:]
+			continue
+		}
+		data = data[i+1:]
+		n := binary.LittleEndian.Uint64(data[:8])
+		fields[name] = string(data[8 : 8+n])
+		data = data[8+n+1:]
+	}
+	return fields
+}
+
+func TestJournald(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "nightwatch-journald")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "socket")
+	conn, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: sock, Net: "unixgram"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	a, err := construct(map[string]interface{}{
+		"socket":  sock,
+		"message": "{{.Monitor}} failed\nvalue={{.Value}}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = a.(actions.Notifier).Notify(&actions.Event{
+		Monitor:  "disk",
+		Labels:   map[string]string{"mount": "/"},
+		Type:     actions.EventFail,
+		Severity: actions.SeverityWarning,
+		Previous: actions.SeverityOK,
+		Value:    91,
+		Time:     time.Now(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 65536)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, err := conn.Read(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fields := parse(t, buf[:n])
+
+	expected := map[string]string{
+		"MESSAGE":             "disk failed\nvalue=91",
+		"PRIORITY":            "4",
+		"SYSLOG_IDENTIFIER":   "nightwatch",
+		"NIGHTWATCH_MONITOR":  "disk",
+		"NIGHTWATCH_EVENT":    "fail",
+		"NIGHTWATCH_SEVERITY": "warning",
+		"NIGHTWATCH_LABELS":   "mount=/",
+		"NIGHTWATCH_VALUE":    "91",
+	}
+	for k, v := range expected {
+		if fields[k] != v {
+			t.Errorf("%s: expected %q, got %q", k, v, fields[k])
+		}
+	}
+}
@@ -0,0 +1,36 @@
+/*
+Package journald implements "journald" action type that logs events to
+systemd journal through its native protocol.
+
+The constructor takes these parameters:
+
+    Name        Type    Default                      Description
+    socket      string  /run/systemd/journal/socket  Path to the journal socket.
+    identifier  string  nightwatch                   SYSLOG_IDENTIFIER field.
+    message     string                               Message template.
+
+All events including init and unknown are logged with these fields:
+
+    Name                 Description
+    MESSAGE              Rendered message template.
+    PRIORITY             Syslog priority.  See below.
+    SYSLOG_IDENTIFIER    The identifier parameter.
+    NIGHTWATCH_MONITOR   Monitor name.
+    NIGHTWATCH_EVENT     Event type.
+    NIGHTWATCH_SEVERITY  Current severity.
+    NIGHTWATCH_PREVIOUS  Previous severity.
+    NIGHTWATCH_LABELS    Labels of the series.
+    NIGHTWATCH_VALUE     Probe result of failures.
+    NIGHTWATCH_DURATION  Seconds the failure lasted, for recoveries.
+    NIGHTWATCH_ERROR     Probe error for unknown events.
+
+PRIORITY is info for init, notice for recover, err for unknown,
+and warning or crit for failures depending on the severity.
+
+Use journalctl to query events, for example:
+
+    journalctl SYSLOG_IDENTIFIER=nightwatch NIGHTWATCH_MONITOR=disk
+
+message is a text/template template rendered with actions.TemplateData.
+*/
+package journald
@@ -0,0 +1,352 @@
+package pagerduty
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"nightwatch"
+	"nightwatch/actions"
+	nwhttp "nightwatch/actions/http"
+)
+
+const (
+	defaultURL     = "https://events.pagerduty.com/v2/enqueue"
+	defaultTimeout = 30 // second
+
+	defaultDedupKey = `nightwatch/{{.Host}}/{{.Name}}`
+	defaultSummary  = `{{.Name}} on {{.Host}} ` +
+		`{{if eq .Type "unknown"}}is unknown: {{.Error}}` +
+		`{{else}}is {{.Severity}}: value {{.Value}}{{end}}` +
+		`{{if .Message}} ({{.Message}}){{end}}`
+
+	actionTrigger     = "trigger"
+	actionAcknowledge = "acknowledge"
+	actionResolve     = "resolve"
+)
+
+var (
+	errNoIncident = errors.New("no open incident")
+)
+
+// severities maps nightwatch severities to those of Events API v2.
+var severities = map[actions.Severity]string{
+	actions.SeverityOK:       "info",
+	actions.SeverityWarning:  "warning",
+	actions.SeverityCritical: "critical",
+	actions.SeverityUnknown:  "error",
+}
+
+type payload struct {
+	Summary       string                 `json:"summary"`
+	Source        string                 `json:"source"`
+	Severity      string                 `json:"severity"`
+	Timestamp     string                 `json:"timestamp,omitempty"`
+	Component     string                 `json:"component,omitempty"`
+	Group         string                 `json:"group,omitempty"`
+	Class         string                 `json:"class,omitempty"`
+	CustomDetails map[string]interface{} `json:"custom_details,omitempty"`
+}
+
+type event struct {
+	RoutingKey  string   `json:"routing_key"`
+	EventAction string   `json:"event_action"`
+	DedupKey    string   `json:"dedup_key"`
+	Payload     *payload `json:"payload,omitempty"`
+	Client      string   `json:"client,omitempty"`
+}
+
+type response struct {
+	Status   string   `json:"status"`
+	Message  string   `json:"message"`
+	DedupKey string   `json:"dedup_key"`
+	Errors   []string `json:"errors"`
+}
+
+type action struct {
+	url            *url.URL
+	routingKey     string
+	dedupKey       *actions.Template
+	summary        *actions.Template
+	component      string
+	group          string
+	class          string
+	triggerUnknown bool
+	timeout        time.Duration
+
+	lock sync.Mutex
+	open map[string]string // dedup key -> monitor name
+}
+
+func (a *action) post(ev *event) error {
+	data, err := nwhttp.PostJSON(a.url, nil, ev, a.timeout)
+	if err != nil {
+		return fmt.Errorf("action:pagerduty: %v", err)
+	}
+
+	var resp response
+	if err := json.Unmarshal(data, &resp); err != nil {
+		// some compatible APIs return no body.
+		return nil
+	}
+	if len(resp.Status) > 0 && resp.Status != "success" {
+		return fmt.Errorf("action:pagerduty: %s %v", resp.Message, resp.Errors)
+	}
+	return nil
+}
+
+func details(e *actions.Event) map[string]interface{} {
+	d := map[string]interface{}{
+		"monitor":  e.Monitor,
+		"event":    e.Type,
+		"severity": e.Severity,
+		"previous": e.Previous,
+	}
+	if len(e.Labels) > 0 {
+		d["labels"] = e.Labels
+	}
+	switch e.Type {
+	case actions.EventUnknown:
+		d["error"] = e.Error
+	default:
+		d["value"] = e.Value
+		d["critical_range"] = e.Crit
+		d["warning_range"] = e.Warn
+	}
+	if !e.FailedAt.IsZero() {
+		d["failed_at"] = e.FailedAt.Format(time.RFC3339)
+	}
+	if e.Repeat > 0 {
+		d["repeat"] = e.Repeat
+	}
+	if len(e.Message) > 0 {
+		d["message"] = e.Message
+	}
+	return d
+}
+
+func (a *action) trigger(e *actions.Event) error {
+	key, err := a.dedupKey.Execute(e)
+	if err != nil {
+		return err
+	}
+	summary, err := a.summary.Execute(e)
+	if err != nil {
+		return err
+	}
+	hname, err := os.Hostname()
+	if err != nil {
+		return err
+	}
+
+	err = a.post(&event{
+		RoutingKey:  a.routingKey,
+		EventAction: actionTrigger,
+		DedupKey:    key,
+		Client:      "nightwatch." + nightwatch.Version,
+		Payload: &payload{
+			Summary:       summary,
+			Source:        hname,
+			Severity:      severities[e.Severity],
+			Timestamp:     e.Time.Format(time.RFC3339),
+			Component:     a.component,
+			Group:         a.group,
+			Class:         a.class,
+			CustomDetails: details(e),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	a.lock.Lock()
+	a.open[key] = e.Monitor
+	a.lock.Unlock()
+	return nil
+}
+
+func (a *action) resolve(e *actions.Event) error {
+	key, err := a.dedupKey.Execute(e)
+	if err != nil {
+		return err
+	}
+
+	err = a.post(&event{
+		RoutingKey:  a.routingKey,
+		EventAction: actionResolve,
+		DedupKey:    key,
+	})
+	if err != nil {
+		return err
+	}
+
+	a.lock.Lock()
+	delete(a.open, key)
+	a.lock.Unlock()
+	return nil
+}
+
+// Ack implements actions.Acker.
+// It acknowledges open incidents of the named monitor.
+//
+// Events API v2 does not record who acknowledged incidents,
+// so author and comment are not sent.
+func (a *action) Ack(name, author, comment string) error {
+	var keys []string
+	a.lock.Lock()
+	for k, n := range a.open {
+		if n == name {
+			keys = append(keys, k)
+		}
+	}
+	a.lock.Unlock()
+
+	if len(keys) == 0 {
+		// incidents triggered before restarts are not tracked.
+		// Single-series monitors can still be acknowledged.
+		k, err := a.dedupKey.Execute(&actions.Event{Monitor: name, Type: actions.EventFail})
+		if err != nil {
+			return err
+		}
+		keys = append(keys, k)
+	}
+
+	for _, k := range keys {
+		err := a.post(&event{
+			RoutingKey:  a.routingKey,
+			EventAction: actionAcknowledge,
+			DedupKey:    k,
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Init does nothing.  Incidents opened before restarts are resolved
+// or re-triggered by the monitor with the same dedup keys only if
+// monitor states are persisted with -state.  Otherwise, incidents of
+// monitors that recover while nightwatch is down are left open.
+func (a *action) Init(name string) error {
+	return nil
+}
+
+func (a *action) Fail(name string, v float64) error {
+	return a.Notify(&actions.Event{
+		Monitor:  name,
+		Type:     actions.EventFail,
+		Severity: actions.SeverityCritical,
+		Previous: actions.SeverityOK,
+		Value:    v,
+		Time:     time.Now(),
+	})
+}
+
+func (a *action) Recover(name string, d time.Duration) error {
+	return a.Notify(&actions.Event{
+		Monitor:  name,
+		Type:     actions.EventRecover,
+		Severity: actions.SeverityOK,
+		Previous: actions.SeverityCritical,
+		Duration: d,
+		Time:     time.Now(),
+	})
+}
+
+func (a *action) Notify(e *actions.Event) error {
+	switch e.Type {
+	case actions.EventFail, actions.EventRepeat:
+		return a.trigger(e)
+	case actions.EventUnknown:
+		if a.triggerUnknown {
+			return a.trigger(e)
+		}
+	case actions.EventRecover:
+		return a.resolve(e)
+	}
+	return nil
+}
+
+func (a *action) String() string {
+	return "action:pagerduty:" + a.url.Host
+}
+
+func construct(params map[string]interface{}) (actions.Actor, error) {
+	routingKey, err := nightwatch.GetString("routing_key", params)
+	if err != nil {
+		return nil, err
+	}
+
+	var u *url.URL
+	s, err := nightwatch.GetString("url", params)
+	switch err {
+	case nil:
+	case nightwatch.ErrNoKey:
+		s = defaultURL
+	default:
+		return nil, err
+	}
+	u, err = url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+
+	dedupKey, err := actions.TemplateParam("dedup_key", defaultDedupKey, params)
+	if err != nil {
+		return nil, err
+	}
+	summary, err := actions.TemplateParam("summary", defaultSummary, params)
+	if err != nil {
+		return nil, err
+	}
+
+	var opts [3]string
+	for i, k := range []string{"component", "group", "class"} {
+		opts[i], err = nightwatch.GetString(k, params)
+		if err != nil && err != nightwatch.ErrNoKey {
+			return nil, err
+		}
+	}
+
+	triggerUnknown, err := nightwatch.GetBool("trigger_unknown", params)
+	switch err {
+	case nil:
+	case nightwatch.ErrNoKey:
+		triggerUnknown = true
+	default:
+		return nil, err
+	}
+	timeout, err := nightwatch.GetInt("timeout", params)
+	switch err {
+	case nil:
+		if timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout: %d", timeout)
+		}
+	case nightwatch.ErrNoKey:
+		timeout = defaultTimeout
+	default:
+		return nil, err
+	}
+
+	return &action{
+		url:            u,
+		routingKey:     routingKey,
+		dedupKey:       dedupKey,
+		summary:        summary,
+		component:      opts[0],
+		group:          opts[1],
+		class:          opts[2],
+		triggerUnknown: triggerUnknown,
+		timeout:        time.Duration(timeout) * time.Second,
+		open:           make(map[string]string),
+	}, nil
+}
+
+func init() {
+	actions.Register("pagerduty", construct)
+}
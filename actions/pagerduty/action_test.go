@@ -0,0 +1,124 @@
+package pagerduty
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"nightwatch/actions"
+)
+
+type server struct {
+	lock   sync.Mutex
+	events []*event
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ev := new(event)
+	if err := json.NewDecoder(r.Body).Decode(ev); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(&response{Status: "invalid event", Message: err.Error()})
+		return
+	}
+	s.lock.Lock()
+	s.events = append(s.events, ev)
+	s.lock.Unlock()
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(&response{Status: "success", DedupKey: ev.DedupKey})
+}
+
+func (s *server) received() []*event {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.events
+}
+
+func TestPagerDuty(t *testing.T) {
+	t.Parallel()
+
+	s := new(server)
+	hs := httptest.NewServer(s)
+	defer hs.Close()
+
+	a, err := construct(map[string]interface{}{
+		"routing_key": "KEY",
+		"url":         hs.URL,
+		"dedup_key":   "nw/{{.Name}}",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := a.(actions.Notifier)
+
+	e := &actions.Event{
+		Monitor:  "disk",
+		Labels:   map[string]string{"mount": "/"},
+		Type:     actions.EventFail,
+		Severity: actions.SeverityWarning,
+		Previous: actions.SeverityOK,
+		Value:    91,
+		Time:     time.Now(),
+	}
+	if err := n.Notify(e); err != nil {
+		t.Fatal(err)
+	}
+	// repeated failures use the same dedup key.
+	e2 := *e
+	e2.Type = actions.EventRepeat
+	e2.Severity = actions.SeverityCritical
+	if err := n.Notify(&e2); err != nil {
+		t.Fatal(err)
+	}
+	if err := a.(*action).Ack("disk", "alice", "on it"); err != nil {
+		t.Fatal(err)
+	}
+	e3 := *e
+	e3.Type = actions.EventRecover
+	e3.Severity = actions.SeverityOK
+	if err := n.Notify(&e3); err != nil {
+		t.Fatal(err)
+	}
+
+	evs := s.received()
+	if len(evs) != 4 {
+		t.Fatal("unexpected number of events:", len(evs))
+	}
+	expected := []string{actionTrigger, actionTrigger, actionAcknowledge, actionResolve}
+	for i, ev := range evs {
+		if ev.EventAction != expected[i] {
+			t.Errorf("%d: unexpected action: %s", i, ev.EventAction)
+		}
+		if ev.DedupKey != "nw/disk{mount=/}" {
+			t.Errorf("%d: unexpected dedup key: %s", i, ev.DedupKey)
+		}
+		if ev.RoutingKey != "KEY" {
+			t.Errorf("%d: unexpected routing key: %s", i, ev.RoutingKey)
+		}
+	}
+	if evs[0].Payload.Severity != "warning" || evs[1].Payload.Severity != "critical" {
+		t.Error("unexpected severities:", evs[0].Payload.Severity, evs[1].Payload.Severity)
+	}
+	if v := evs[0].Payload.CustomDetails["value"]; v != float64(91) {
+		t.Error("unexpected value:", v)
+	}
+	if evs[3].Payload != nil {
+		t.Error("resolve should not have payload")
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	t.Parallel()
+
+	for _, timeout := range []int{0, -1} {
+		_, err := construct(map[string]interface{}{
+			"routing_key": "KEY",
+			"timeout":     timeout,
+		})
+		if err == nil {
+			t.Error("invalid timeout is accepted:", timeout)
+		}
+	}
+}
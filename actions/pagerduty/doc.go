@@ -0,0 +1,45 @@
+/*
+Package pagerduty implements "pagerduty" action type that sends events
+to incident management services through PagerDuty Events API v2.
+
+Failures trigger incidents, and recoveries resolve them.  Incidents are
+identified by dedup keys derived from monitor names, so that restarts of
+nightwatch or re-notifications never open duplicate incidents.
+
+Monitors recovered while nightwatch is down resolve their incidents
+after restarts only if monitor states are persisted with -state, which
+is enabled by default.  Without it, such incidents are left open.
+
+The constructor takes these parameters:
+
+    Name             Type    Default  Description
+    routing_key      string           Integration key.
+    url              string           Events API endpoint.  Optional.
+    dedup_key        string           Dedup key template.
+    summary          string           Summary template.
+    component        string           Component of incidents.  Optional.
+    group            string           Group of incidents.  Optional.
+    class            string           Class of incidents.  Optional.
+    trigger_unknown  bool    true     Trigger incidents when the probe fails.
+    timeout          int     30       Timeout seconds for requests.
+
+The default url is https://events.pagerduty.com/v2/enqueue.
+Other services compatible with Events API v2 can be used by changing it.
+
+The default dedup_key is "nightwatch/{{.Host}}/{{.Name}}", where .Name
+includes labels of the series.  Templates are rendered with
+actions.TemplateData.
+
+Severities are mapped as follows:
+
+    nightwatch  Events API
+    warning     warning
+    critical    critical
+    unknown     error
+
+Custom details of incidents contain the probe value, ranges, labels,
+and messages of the probe.
+
+Incidents can be acknowledged through Ack.
+*/
+package pagerduty
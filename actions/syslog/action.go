@@ -0,0 +1,298 @@
+package syslog
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"nightwatch"
+	"nightwatch/actions"
+)
+
+const (
+	defaultNetwork  = "unixgram"
+	defaultAddress  = "/dev/log"
+	defaultFacility = "daemon"
+	defaultTag      = "nightwatch"
+	defaultTimeout  = 10 // second
+
+	// sdID is the SD-ID of structured data.  32473 is the private
+	// enterprise number reserved for documentation by RFC 5612.
+	sdID = "nightwatch@32473"
+
+	// timeFormat is the TIMESTAMP format.  RFC 5424 allows at most
+	// 6 digits of fractional seconds.
+	timeFormat = "2006-01-02T15:04:05.000000Z07:00"
+
+	// maxTagLength is the maximum length of APP-NAME.
+	maxTagLength = 48
+
+	defaultMessage = `{{.Name}} {{.Type}}` +
+		`{{if or (eq .Type "fail") (eq .Type "repeat")}}: severity={{.Severity}} value={{.Value}}` +
+		`{{else if eq .Type "recover"}}: failed for {{.Duration}}` +
+		`{{else if eq .Type "unknown"}}: {{.Error}}{{end}}` +
+		`{{if .Message}} ({{.Message}}){{end}}`
+)
+
+// RFC 5424 severities.
+const (
+	sevCritical = 2
+	sevError    = 3
+	sevWarning  = 4
+	sevNotice   = 5
+	sevInfo     = 6
+)
+
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3,
+	"auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+	"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+type action struct {
+	network  string
+	address  string
+	facility int
+	tag      string
+	message  *actions.Template
+	timeout  time.Duration
+}
+
+// validTag returns true if tag is a valid APP-NAME, which consists of
+// printable US-ASCII characters without spaces.
+func validTag(tag string) bool {
+	if len(tag) == 0 || len(tag) > maxTagLength {
+		return false
+	}
+	for i := 0; i < len(tag); i++ {
+		if tag[i] < 33 || tag[i] > 126 {
+			return false
+		}
+	}
+	return true
+}
+
+// severity returns the syslog severity of e.
+func severity(e *actions.Event) int {
+	switch e.Type {
+	case actions.EventInit:
+		return sevInfo
+	case actions.EventRecover:
+		return sevNotice
+	case actions.EventUnknown:
+		return sevError
+	}
+	if e.Severity == actions.SeverityWarning {
+		return sevWarning
+	}
+	return sevCritical
+}
+
+var sdEscaper = strings.NewReplacer(`"`, `\"`, `\`, `\\`, `]`, `\]`)
+
+// structuredData formats e as an SD-ELEMENT.
+func structuredData(e *actions.Event) string {
+	var b bytes.Buffer
+	param := func(name, value string) {
+		fmt.Fprintf(&b, ` %s="%s"`, name, sdEscaper.Replace(value))
+	}
+
+	b.WriteString("[" + sdID)
+	param("monitor", e.Monitor)
+	param("event", e.Type)
+	if e.Type != actions.EventInit {
+		param("severity", string(e.Severity))
+		param("previous", string(e.Previous))
+	}
+	if len(e.Labels) > 0 {
+		param("labels", actions.FormatLabels(e.Labels))
+	}
+	switch e.Type {
+	case actions.EventFail, actions.EventRepeat:
+		param("value", strconv.FormatFloat(e.Value, 'g', -1, 64))
+	case actions.EventRecover:
+		param("duration", strconv.Itoa(int(e.Duration.Seconds())))
+	case actions.EventUnknown:
+		param("error", e.Error)
+	}
+	b.WriteString("]")
+	return b.String()
+}
+
+// format builds an RFC 5424 message.
+func (a *action) format(e *actions.Event) (string, error) {
+	msg, err := a.message.Execute(e)
+	if err != nil {
+		return "", err
+	}
+	hname, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+	t := e.Time
+	if t.IsZero() {
+		t = time.Now()
+	}
+
+	// <PRI>VERSION TIMESTAMP HOSTNAME APP-NAME PROCID MSGID SD MSG
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s",
+		a.facility*8+severity(e),
+		t.Format(timeFormat),
+		hname,
+		a.tag,
+		os.Getpid(),
+		e.Type,
+		structuredData(e),
+		msg), nil
+}
+
+func (a *action) send(e *actions.Event) error {
+	msg, err := a.format(e)
+	if err != nil {
+		return err
+	}
+
+	conn, err := net.DialTimeout(a.network, a.address, a.timeout)
+	if err != nil {
+		return fmt.Errorf("action:syslog: %v", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(a.timeout))
+
+	if a.network == "tcp" || a.network == "unix" {
+		// octet counting framing of RFC 6587.
+		msg = strconv.Itoa(len(msg)) + " " + msg
+	}
+	_, err = conn.Write([]byte(msg))
+	if err != nil {
+		return fmt.Errorf("action:syslog: %v", err)
+	}
+	return nil
+}
+
+func (a *action) Init(name string) error {
+	return a.send(&actions.Event{
+		Monitor: name,
+		Type:    actions.EventInit,
+		Time:    time.Now(),
+	})
+}
+
+func (a *action) Fail(name string, v float64) error {
+	return a.Notify(&actions.Event{
+		Monitor:  name,
+		Type:     actions.EventFail,
+		Severity: actions.SeverityCritical,
+		Previous: actions.SeverityOK,
+		Value:    v,
+		Time:     time.Now(),
+	})
+}
+
+func (a *action) Recover(name string, d time.Duration) error {
+	return a.Notify(&actions.Event{
+		Monitor:  name,
+		Type:     actions.EventRecover,
+		Severity: actions.SeverityOK,
+		Previous: actions.SeverityCritical,
+		Duration: d,
+		Time:     time.Now(),
+	})
+}
+
+func (a *action) Notify(e *actions.Event) error {
+	return a.send(e)
+}
+
+func (a *action) String() string {
+	return fmt.Sprintf("action:syslog:%s:%s", a.network, a.address)
+}
+
+func construct(params map[string]interface{}) (actions.Actor, error) {
+	network, err := nightwatch.GetString("network", params)
+	switch err {
+	case nil:
+	case nightwatch.ErrNoKey:
+		network = defaultNetwork
+	default:
+		return nil, err
+	}
+	switch network {
+	case "udp", "tcp", "unix", "unixgram":
+	default:
+		return nil, fmt.Errorf("invalid network: %s", network)
+	}
+
+	address, err := nightwatch.GetString("address", params)
+	switch err {
+	case nil:
+	case nightwatch.ErrNoKey:
+		if network != defaultNetwork {
+			return nil, fmt.Errorf("address is required for %s", network)
+		}
+		address = defaultAddress
+	default:
+		return nil, err
+	}
+
+	fname, err := nightwatch.GetString("facility", params)
+	switch err {
+	case nil:
+	case nightwatch.ErrNoKey:
+		fname = defaultFacility
+	default:
+		return nil, err
+	}
+	facility, ok := facilities[fname]
+	if !ok {
+		return nil, fmt.Errorf("invalid facility: %s", fname)
+	}
+
+	tag, err := nightwatch.GetString("tag", params)
+	switch err {
+	case nil:
+		if !validTag(tag) {
+			return nil, fmt.Errorf("invalid tag: %q", tag)
+		}
+	case nightwatch.ErrNoKey:
+		tag = defaultTag
+	default:
+		return nil, err
+	}
+
+	message, err := actions.TemplateParam("message", defaultMessage, params)
+	if err != nil {
+		return nil, err
+	}
+
+	timeout, err := nightwatch.GetInt("timeout", params)
+	switch err {
+	case nil:
+		if timeout <= 0 {
+			return nil, fmt.Errorf("invalid timeout: %d", timeout)
+		}
+	case nightwatch.ErrNoKey:
+		timeout = defaultTimeout
+	default:
+		return nil, err
+	}
+
+	return &action{
+		network:  network,
+		address:  address,
+		facility: facility,
+		tag:      tag,
+		message:  message,
+		timeout:  time.Duration(timeout) * time.Second,
+	}, nil
+}
+
+func init() {
+	actions.Register("syslog", construct)
+}
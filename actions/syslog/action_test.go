@@ -0,0 +1,194 @@
+package syslog
+
+import (
+	"bufio"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"nightwatch/actions"
+)
+
+func testEvent() *actions.Event {
+	return &actions.Event{
+		Monitor:  "disk",
+		Labels:   map[string]string{"mount": "/"},
+		Type:     actions.EventFail,
+		Severity: actions.SeverityWarning,
+		Previous: actions.SeverityOK,
+		Value:    91,
+		Message:  `quote " and ]`,
+		Time:     time.Now(),
+	}
+}
+
+func checkMessage(t *testing.T, msg string) {
+	// facility local0 (16) * 8 + warning (4)
+	if !strings.HasPrefix(msg, "<132>1 ") {
+		t.Error("unexpected PRI or version:", msg)
+	}
+	fields := strings.SplitN(msg, " ", 8)
+	if len(fields) != 8 {
+		t.Fatal("malformed message:", msg)
+	}
+	ts := fields[1]
+	if _, err := time.Parse(time.RFC3339, ts); err != nil {
+		t.Error("invalid TIMESTAMP:", ts)
+	}
+	if i := strings.IndexByte(ts, '.'); i >= 0 {
+		frac := ts[i+1:]
+		frac = frac[:strings.IndexAny(frac, "Z+-")]
+		if len(frac) > 6 {
+			t.Error("TIME-SECFRAC is longer than 6 digits:", ts)
+		}
+	}
+	if fields[3] != "nwtest" {
+		t.Error("unexpected APP-NAME:", fields[3])
+	}
+	if fields[5] != "fail" {
+		t.Error("unexpected MSGID:", fields[5])
+	}
+	sd := `[nightwatch@32473 monitor="disk" event="fail" severity="warning" previous="ok" labels="mount=/" value="91"]`
+	if !strings.HasPrefix(fields[6]+" "+fields[7], sd) {
+		t.Error("unexpected structured data:", msg)
+	}
+	if !strings.HasSuffix(msg, `(quote " and ])`) {
+		t.Error("unexpected MSG:", msg)
+	}
+}
+
+func TestUDP(t *testing.T) {
+	t.Parallel()
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	a, err := construct(map[string]interface{}{
+		"network":  "udp",
+		"address":  conn.LocalAddr().String(),
+		"facility": "local0",
+		"tag":      "nwtest",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.(actions.Notifier).Notify(testEvent()); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 4096)
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkMessage(t, string(buf[:n]))
+}
+
+func TestUnixStream(t *testing.T) {
+	t.Parallel()
+
+	dir, err := ioutil.TempDir("", "nightwatch-syslog")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sock := filepath.Join(dir, "log")
+	l, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	ch := make(chan string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			close(ch)
+			return
+		}
+		defer conn.Close()
+
+		// read an octet-counted frame.
+		r := bufio.NewReader(conn)
+		size, err := r.ReadString(' ')
+		if err != nil {
+			close(ch)
+			return
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(size))
+		if err != nil {
+			close(ch)
+			return
+		}
+		buf := make([]byte, n)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			close(ch)
+			return
+		}
+		ch <- string(buf)
+	}()
+
+	a, err := construct(map[string]interface{}{
+		"network":  "unix",
+		"address":  sock,
+		"facility": "local0",
+		"tag":      "nwtest",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := a.(actions.Notifier).Notify(testEvent()); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case msg, ok := <-ch:
+		if !ok {
+			t.Fatal("failed to read a message")
+		}
+		checkMessage(t, msg)
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out")
+	}
+}
+
+func TestConstruct(t *testing.T) {
+	t.Parallel()
+
+	_, err := construct(map[string]interface{}{"network": "tcp"})
+	if err == nil {
+		t.Error("address should be required for tcp")
+	}
+	_, err = construct(map[string]interface{}{"facility": "nosuch"})
+	if err == nil {
+		t.Error("invalid facility should be rejected")
+	}
+	long := strings.Repeat("a", 49)
+	for _, tag := range []string{"", "night watch", "夜", long} {
+		_, err = construct(map[string]interface{}{"tag": tag})
+		if err == nil {
+			t.Errorf("invalid tag should be rejected: %q", tag)
+		}
+	}
+	for _, timeout := range []int{0, -1} {
+		_, err = construct(map[string]interface{}{"timeout": timeout})
+		if err == nil {
+			t.Error("invalid timeout should be rejected:", timeout)
+		}
+	}
+	_, err = construct(map[string]interface{}{"message": "{{.Nosuch}}"})
+	if err == nil || !strings.Contains(err.Error(), "invalid message template") {
+		t.Error("invalid template should be rejected:", err)
+	}
+}
@@ -0,0 +1,44 @@
+/*
+Package syslog implements "syslog" action type that logs events to
+syslog servers in RFC 5424 format.
+
+The constructor takes these parameters:
+
+    Name      Type    Default     Description
+    network   string  unixgram    One of udp, tcp, unix, or unixgram.
+    address   string  /dev/log    Address of the server.
+    facility  string  daemon      Facility name such as daemon or local0.
+    tag       string  nightwatch  APP-NAME of messages.
+    message   string              Message template.
+    timeout   int     10          Timeout seconds to send a message.
+
+address is required unless network is unixgram.
+Messages over stream sockets (tcp and unix) are framed by octet counting
+as defined in RFC 6587.
+
+All events including init and unknown are logged.
+MSGID is the event type, and severities are mapped as follows:
+
+    Event                Severity
+    init                 info
+    fail/repeat warning  warning
+    fail/repeat critical crit
+    unknown              err
+    recover              notice
+
+Fields of events are logged as structured data with SD-ID
+"nightwatch@32473":
+
+    Name      Description
+    monitor   Monitor name.
+    event     Event type.
+    severity  Current severity.
+    previous  Previous severity.
+    labels    Labels of the series.
+    value     Probe result of failures.
+    duration  Seconds the failure lasted, for recoveries.
+    error     Probe error for unknown events.
+
+message is a text/template template rendered with actions.TemplateData.
+*/
+package syslog
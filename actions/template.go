@@ -0,0 +1,213 @@
+package actions
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"text/template"
+	"time"
+)
+
+// TemplateData is passed to notification templates.
+//
+// All fields of Event are accessible, e.g. {{.Monitor}}, {{.Type}},
+// {{.Severity}}, {{.Value}}, {{.Crit.Max}}, {{.Duration}}, {{.Time}}.
+type TemplateData struct {
+	*Event
+
+	// Host is the hostname where nightwatch is running.
+	Host string
+}
+
+var templateFuncs = template.FuncMap{
+	// json encodes v as a JSON value.  Useful to build JSON bodies.
+	"json": func(v interface{}) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+	// labels formats labels as "key1=value1,key2=value2".
+	"labels": FormatLabels,
+	// seconds returns d in whole seconds.
+	"seconds": func(d time.Duration) int64 {
+		return int64(d.Seconds())
+	},
+	// datetime formats t in the local time zone.
+	"datetime": func(t time.Time) string {
+		if t.IsZero() {
+			return ""
+		}
+		return t.Format("2006-01-02 15:04:05")
+	},
+}
+
+// GroupTemplateData is passed to templates for grouped notifications.
+//
+// All fields and methods of Group are accessible, e.g. {{.Receiver}},
+// {{.Labels}}, {{range .Events}}, {{len .Failing}}, {{.Severity}}.
+type GroupTemplateData struct {
+	*Group
+
+	// Host is the hostname where nightwatch is running.
+	Host string
+}
+
+// Template is a text/template to render notifications.
+type Template struct {
+	t *template.Template
+}
+
+// sampleEvents are used to validate templates.
+var sampleEvents = []*Event{
+	{Monitor: "sample", Type: EventInit},
+	{Monitor: "sample", Type: EventFail, Severity: SeverityCritical, Previous: SeverityOK},
+	{Monitor: "sample", Type: EventRecover, Severity: SeverityOK, Previous: SeverityCritical},
+	{Monitor: "sample", Type: EventUnknown, Severity: SeverityUnknown, Previous: SeverityOK, Error: "sample"},
+}
+
+// NewTemplate parses text as a notification template.
+//
+// The template is validated by rendering sample events so that
+// errors are detected when an action is constructed.
+func NewTemplate(name, text string) (*Template, error) {
+	t, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := &Template{t}
+	for _, e := range sampleEvents {
+		if _, err := tmpl.Execute(e); err != nil {
+			return nil, err
+		}
+	}
+	return tmpl, nil
+}
+
+// MustTemplate is like NewTemplate but panics on errors.
+// This is intended for default templates of actions.
+func MustTemplate(name, text string) *Template {
+	t, err := NewTemplate(name, text)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Execute renders the template for e.
+func (t *Template) Execute(e *Event) (string, error) {
+	if e == nil {
+		return "", errors.New("nil event")
+	}
+
+	hname, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	err = t.t.Execute(&buf, &TemplateData{Event: e, Host: hname})
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// GroupTemplate is a text/template to render grouped notifications.
+type GroupTemplate struct {
+	t *template.Template
+}
+
+// sampleGroup is used to validate group templates.
+var sampleGroup = &Group{
+	Receiver: "sample",
+	Labels:   map[string]string{"host": "sample"},
+	Events:   sampleEvents[1:],
+}
+
+// NewGroupTemplate parses text as a template for grouped notifications.
+//
+// The template is validated by rendering a sample group.
+func NewGroupTemplate(name, text string) (*GroupTemplate, error) {
+	t, err := template.New(name).Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+
+	tmpl := &GroupTemplate{t}
+	if _, err := tmpl.Execute(sampleGroup); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// MustGroupTemplate is like NewGroupTemplate but panics on errors.
+// This is intended for default templates of actions.
+func MustGroupTemplate(name, text string) *GroupTemplate {
+	t, err := NewGroupTemplate(name, text)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Execute renders the template for g.
+func (t *GroupTemplate) Execute(g *Group) (string, error) {
+	if g == nil {
+		return "", errors.New("nil group")
+	}
+
+	hname, err := os.Hostname()
+	if err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	err = t.t.Execute(&buf, &GroupTemplateData{Group: g, Host: hname})
+	if err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// templateText returns the template text in params[key].
+// If the key does not exist, def is returned.
+func templateText(key, def string, params map[string]interface{}) (string, error) {
+	v, ok := params[key]
+	if !ok {
+		return def, nil
+	}
+	s, ok := v.(string)
+	if !ok {
+		return "", fmt.Errorf("invalid %s template: not a string", key)
+	}
+	return s, nil
+}
+
+// TemplateParam parses the template in params[key] for actions.
+// If the key does not exist, def is used.
+func TemplateParam(key, def string, params map[string]interface{}) (*Template, error) {
+	text, err := templateText(key, def, params)
+	if err != nil {
+		return nil, err
+	}
+	t, err := NewTemplate(key, text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %v", key, err)
+	}
+	return t, nil
+}
+
+// GroupTemplateParam is like TemplateParam but for grouped notifications.
+func GroupTemplateParam(key, def string, params map[string]interface{}) (*GroupTemplate, error) {
+	text, err := templateText(key, def, params)
+	if err != nil {
+		return nil, err
+	}
+	t, err := NewGroupTemplate(key, text)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s template: %v", key, err)
+	}
+	return t, nil
+}
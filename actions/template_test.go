@@ -0,0 +1,112 @@
+package actions
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func TestTemplate(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewTemplate("bad", "{{.Monitor")
+	if err == nil {
+		t.Error(`parse error is expected`)
+	}
+	_, err = NewTemplate("bad", "{{.NoSuchField}}")
+	if err == nil {
+		t.Error(`execution error is expected`)
+	}
+
+	tmpl, err := NewTemplate("good",
+		`{{.Name}}@{{.Host}} {{.Type}} {{.Severity}} {{.Value}} [{{.Crit.Min}},{{.Crit.Max}}] {{seconds .Duration}} {{json .Message}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := tmpl.Execute(&Event{
+		Monitor:  "disk",
+		Labels:   map[string]string{"mount": "/"},
+		Type:     EventRecover,
+		Severity: SeverityOK,
+		Value:    0.5,
+		Crit:     Range{Min: 0, Max: 1},
+		Duration: 39 * time.Second,
+		Message:  `"quoted"`,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hname, _ := os.Hostname()
+	expected := `disk{mount=/}@` + hname + ` recover ok 0.5 [0,1] 39 "\"quoted\""`
+	if s != expected {
+		t.Errorf("unexpected result: %s", s)
+	}
+}
+
+func TestTemplateParam(t *testing.T) {
+	t.Parallel()
+
+	tmpl, err := TemplateParam("title", "{{.Monitor}} default", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := tmpl.Execute(&Event{Monitor: "disk"}); s != "disk default" {
+		t.Error("default template is not used:", s)
+	}
+
+	params := map[string]interface{}{"title": "{{.Monitor}} custom"}
+	tmpl, err = TemplateParam("title", "{{.Monitor}} default", params)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s, _ := tmpl.Execute(&Event{Monitor: "disk"}); s != "disk custom" {
+		t.Error("template in params is not used:", s)
+	}
+
+	bad := []map[string]interface{}{
+		{"title": 1},
+		{"title": "{{.Monitor"},
+	}
+	for _, params := range bad {
+		if _, err := TemplateParam("title", "", params); err == nil {
+			t.Error("bad template is accepted:", params)
+		}
+		if _, err := GroupTemplateParam("title", "", params); err == nil {
+			t.Error("bad group template is accepted:", params)
+		}
+	}
+}
+
+func TestGroupTemplate(t *testing.T) {
+	t.Parallel()
+
+	_, err := NewGroupTemplate("bad", "{{.NoSuchField}}")
+	if err == nil {
+		t.Error(`execution error is expected`)
+	}
+
+	tmpl, err := NewGroupTemplate("good",
+		`{{len .Failing}} failing, {{len .Recovered}} recovered on {{labels .Labels}} {{.Severity}}:{{range .Events}} {{.Name}}{{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := tmpl.Execute(&Group{
+		Labels: map[string]string{"host": "db1"},
+		Events: []*Event{
+			{Monitor: "ping", Type: EventFail, Severity: SeverityWarning},
+			{Monitor: "disk", Labels: map[string]string{"mount": "/"}, Type: EventFail, Severity: SeverityCritical},
+			{Monitor: "load", Type: EventRecover, Severity: SeverityOK},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `2 failing, 1 recovered on host=db1 critical: ping disk{mount=/} load`
+	if s != expected {
+		t.Errorf("unexpected result: %s", s)
+	}
+}
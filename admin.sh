@@ -13,7 +13,7 @@ function start()
 		exit 1
 	fi
 
-	nohup $BASE_DIR/$SERVER -log_dir=logs server &>$LOG/${SERVER}_$(date +%F).log &
+	nohup $BASE_DIR/$SERVER -log_dir=logs -state=$BASE_DIR/state server &>$LOG/${SERVER}_$(date +%F).log &
 
 	echo "sleeping..." &&  sleep 3
 	$BASE_DIR/$SERVER register sample.yaml
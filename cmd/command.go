@@ -4,15 +4,20 @@ import (
 	"bytes"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"io/ioutil"
+	"math"
 	"net/http"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/gorilla/mux"
 	"nightwatch"
+	"nightwatch/actions"
+	"nightwatch/monitor"
 )
 
 func newRequest(method, path string, body io.Reader) *http.Request {
@@ -63,10 +68,14 @@ func cmdList(r *mux.Router, args []string) error {
 	}
 
 	//fmt.Printf("%-8s  %-32s  Running  Failing\n", "ID", "Name")
-	fmt.Printf("%-8s  %-20s  %-9s  %-6s  %-19s\n", "ID", "Name", "Times", "Status", "FailedAt")
+	fmt.Printf("%-8s  %-20s  %-9s  %-9s  %-8s  %-19s  %-12s  %s\n", "ID", "Name", "Times", "Status", "Severity", "FailedAt", "AckedBy", "InhibitedBy")
 	for _, i := range l {
-		fmt.Printf("%-8d  %-20s  %-9d  %-6s  %-19s\n",
-			i.ID, i.Name, i.Times, i.Status, i.FailedAt)
+		acked := ""
+		if i.Ack != nil {
+			acked = i.Ack.Author
+		}
+		fmt.Printf("%-8d  %-20s  %-9d  %-9s  %-8s  %-19s  %-12s  %s\n",
+			i.ID, i.Name, i.Times, i.Status, i.Severity, i.FailedAt, acked, i.InhibitedBy)
 	}
 	return nil
 }
@@ -137,8 +146,107 @@ func cmdShow(r *mux.Router, args []string) error {
 	fmt.Println("Name:", info.Name)
 	fmt.Printf("Times: %v\n", info.Times)
 	fmt.Printf("Status: %v\n", info.Status)
+	fmt.Printf("Severity: %v\n", info.Severity)
 	fmt.Printf("FailedAt: %v\n", info.FailedAt)
+	if len(info.InhibitedBy) > 0 {
+		fmt.Printf("InhibitedBy: %v\n", info.InhibitedBy)
+	}
+	if a := info.Ack; a != nil {
+		fmt.Printf("AckedBy: %v at %v (%v)\n", a.Author, a.At.Format("2006-01-02 15:04:05"), a.Comment)
+		if !a.ExpiresAt.IsZero() {
+			fmt.Printf("AckExpiresAt: %v\n", a.ExpiresAt.Format("2006-01-02 15:04:05"))
+		}
+	}
+	if len(info.Series) > 0 {
+		fmt.Println("Series:")
+		for _, si := range info.Series {
+			fmt.Printf("    %-32s  %-8s  %-19s  %s\n",
+				actions.FormatLabels(si.Labels), si.Severity, si.FailedAt, si.Muted)
+		}
+	}
+
+	return nil
+}
+
+// sparkLevels are characters of a sparkline from the lowest value.
+const sparkLevels = "_.-=+*#@"
+
+// sparkline draws values in ASCII.  Failed probes are drawn as "!".
+func sparkline(l []*monitor.Sample) string {
+	min, max := math.Inf(1), math.Inf(-1)
+	for _, s := range l {
+		if len(s.Error) > 0 {
+			continue
+		}
+		min = math.Min(min, s.Value)
+		max = math.Max(max, s.Value)
+	}
+
+	b := make([]byte, len(l))
+	for i, s := range l {
+		switch {
+		case len(s.Error) > 0:
+			b[i] = '!'
+		case max == min:
+			b[i] = sparkLevels[len(sparkLevels)/2]
+		default:
+			n := int((s.Value - min) / (max - min) * float64(len(sparkLevels)-1))
+			b[i] = sparkLevels[n]
+		}
+	}
+	return string(b)
+}
+
+func cmdHistory(r *mux.Router, args []string) error {
+	if len(args) != 1 {
+		return errors.New("wrong number of arguments")
+	}
+	client := &http.Client{}
+	url, err := r.Get("history").URL("id", args[0])
+	if err != nil {
+		return err
+	}
 
+	resp, err := client.Do(newRequest(http.MethodGet, url.Path, nil))
+	if err != nil {
+		return err
+	}
+	data, err := readResponse(resp)
+	if err != nil {
+		return err
+	}
+
+	var h nightwatch.History
+	if err := json.Unmarshal(data, &h); err != nil {
+		return err
+	}
+
+	// group samples by series in the order of appearance.
+	var keys []string
+	series := make(map[string][]*monitor.Sample)
+	for _, s := range h {
+		key := actions.FormatLabels(s.Labels)
+		if _, ok := series[key]; !ok {
+			keys = append(keys, key)
+		}
+		series[key] = append(series[key], s)
+	}
+
+	for _, key := range keys {
+		l := series[key]
+		if len(key) > 0 {
+			fmt.Println(key)
+		}
+		fmt.Println(sparkline(l))
+		fmt.Printf("%-19s  %-8s  %-12s  %-12s  %-10s  %s\n",
+			"Time", "Severity", "Raw", "Value", "Duration", "Error")
+		for _, s := range l {
+			fmt.Printf("%-19s  %-8s  %-12g  %-12g  %-10v  %s\n",
+				s.Time.Format("2006-01-02 15:04:05"), s.Severity, s.Raw, s.Value,
+				s.Duration.Round(time.Millisecond), s.Error)
+		}
+		fmt.Println()
+	}
 	return nil
 }
 
@@ -209,6 +317,267 @@ func cmdUnregister(r *mux.Router, args []string) error {
 	return nil
 }
 
+func cmdAck(r *mux.Router, args []string) error {
+	fs := flag.NewFlagSet("ack", flag.ContinueOnError)
+	author := fs.String("author", os.Getenv("USER"), "author")
+	comment := fs.String("comment", "", "comment")
+	duration := fs.String("duration", "", "duration such as 2h (default until recovery)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New("wrong number of arguments")
+	}
+
+	d := &nightwatch.AckDefinition{
+		Author:   *author,
+		Comment:  *comment,
+		Duration: *duration,
+	}
+
+	client := &http.Client{}
+	url, err := r.Get("ack").URL("id", fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	req := newRequest(http.MethodPost, url.Path, bytes.NewBuffer(data))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	if _, err := readResponse(resp); err != nil {
+		return err
+	}
+	fmt.Println("Acknowledged.")
+	return nil
+}
+
+func cmdDeliveries(r *mux.Router, args []string) error {
+	client := &http.Client{}
+	url, err := r.Get("deliveries").URL()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(newRequest(http.MethodGet, url.Path, nil))
+	if err != nil {
+		return err
+	}
+	data, err := readResponse(resp)
+	if err != nil {
+		return err
+	}
+
+	var d nightwatch.Deliveries
+	if err := json.Unmarshal(data, &d); err != nil {
+		return err
+	}
+
+	show := func(title string, l []*monitor.Delivery) {
+		fmt.Println(title)
+		fmt.Printf("%-20s  %-8s  %-8s  %-19s  %s\n", "Monitor", "Event", "Attempts", "CreatedAt", "Error")
+		for _, i := range l {
+			fmt.Printf("%-20s  %-8s  %-8d  %-19s  %s\n",
+				i.Source(), i.EventType(), i.Attempts,
+				i.CreatedAt.Format("2006-01-02 15:04:05"), i.LastError)
+		}
+	}
+	show("Pending:", d.Pending)
+	fmt.Println()
+	show("Dead:", d.Dead)
+	return nil
+}
+
+// labelFlags collects -label KEY=VALUE options.
+type labelFlags map[string]string
+
+func (l labelFlags) String() string {
+	return actions.FormatLabels(l)
+}
+
+func (l labelFlags) Set(v string) error {
+	kv := strings.SplitN(v, "=", 2)
+	if len(kv) != 2 || len(kv[0]) == 0 {
+		return fmt.Errorf("invalid label: %s", v)
+	}
+	l[kv[0]] = kv[1]
+	return nil
+}
+
+func cmdSilenceAdd(r *mux.Router, args []string) error {
+	fs := flag.NewFlagSet("silence add", flag.ContinueOnError)
+	labels := make(labelFlags)
+	name := fs.String("monitor", "", "regular expression of monitor names")
+	fs.Var(labels, "label", "label KEY=VALUE of series (repeatable)")
+	start := fs.String("start", "", "start time in RFC3339 (default now)")
+	end := fs.String("end", "", "end time in RFC3339")
+	duration := fs.String("duration", "", "duration such as 2h; the length of windows with -cron")
+	cron := fs.String("cron", "", "cron expression to start recurring windows")
+	author := fs.String("author", os.Getenv("USER"), "author")
+	comment := fs.String("comment", "", "comment")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	d := &nightwatch.SilenceDefinition{
+		Monitor:  *name,
+		Labels:   labels,
+		Duration: *duration,
+		Cron:     *cron,
+		Author:   *author,
+		Comment:  *comment,
+	}
+	if len(*start) > 0 {
+		t, err := time.Parse(time.RFC3339, *start)
+		if err != nil {
+			return err
+		}
+		d.StartsAt = t
+	}
+	if len(*end) > 0 {
+		t, err := time.Parse(time.RFC3339, *end)
+		if err != nil {
+			return err
+		}
+		d.EndsAt = t
+	}
+
+	client := &http.Client{}
+	url, err := r.Get("silences").URL()
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	req := newRequest(http.MethodPost, url.Path, bytes.NewBuffer(data))
+	req.Header.Set("Content-Type", "application/json; charset=utf-8")
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	data, err = readResponse(resp)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("silence id=%s is added\n", string(data))
+	return nil
+}
+
+func cmdSilenceList(r *mux.Router, args []string) error {
+	client := &http.Client{}
+	url, err := r.Get("silences").URL()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(newRequest(http.MethodGet, url.Path, nil))
+	if err != nil {
+		return err
+	}
+	data, err := readResponse(resp)
+	if err != nil {
+		return err
+	}
+
+	var l nightwatch.SilenceList
+	if err := json.Unmarshal(data, &l); err != nil {
+		return err
+	}
+
+	const layout = "2006-01-02 15:04"
+	fmt.Printf("%-6s  %-8s  %-20s  %-20s  %-16s  %-16s  %-12s  %-10s  %s\n",
+		"ID", "State", "Monitor", "Labels", "StartsAt", "EndsAt", "Cron", "Author", "Comment")
+	for _, i := range l {
+		end := ""
+		if !i.EndsAt.IsZero() {
+			end = i.EndsAt.Format(layout)
+		}
+		cron := i.Cron
+		if len(cron) > 0 {
+			cron += " " + i.Duration.String()
+		}
+		fmt.Printf("%-6d  %-8s  %-20s  %-20s  %-16s  %-16s  %-12s  %-10s  %s\n",
+			i.ID, i.State, i.Monitor, actions.FormatLabels(i.Labels),
+			i.StartsAt.Format(layout), end, cron, i.Author, i.Comment)
+	}
+	return nil
+}
+
+func cmdSilenceExpire(r *mux.Router, args []string) error {
+	if len(args) != 1 {
+		return errors.New("wrong number of arguments")
+	}
+	client := &http.Client{}
+	url, err := r.Get("silence").URL("id", args[0])
+	if err != nil {
+		return err
+	}
+	resp, err := client.Do(newRequest(http.MethodDelete, url.Path, nil))
+	if err != nil {
+		return err
+	}
+	_, err = readResponse(resp)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Expired.")
+	return nil
+}
+
+func cmdSilence(r *mux.Router, args []string) error {
+	if len(args) == 0 {
+		return errors.New("wrong number of arguments")
+	}
+
+	commands := map[string]func(r *mux.Router, args []string) error{
+		"add":    cmdSilenceAdd,
+		"list":   cmdSilenceList,
+		"expire": cmdSilenceExpire,
+	}
+	if f, ok := commands[args[0]]; ok {
+		return f(r, args[1:])
+	}
+	return fmt.Errorf("no such silence command: %s", args[0])
+}
+
+func cmdRateLimits(r *mux.Router, args []string) error {
+	client := &http.Client{}
+	url, err := r.Get("ratelimits").URL()
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(newRequest(http.MethodGet, url.Path, nil))
+	if err != nil {
+		return err
+	}
+	data, err := readResponse(resp)
+	if err != nil {
+		return err
+	}
+
+	var l nightwatch.RateLimiters
+	if err := json.Unmarshal(data, &l); err != nil {
+		return err
+	}
+
+	fmt.Printf("%-9s  %-40s  %-8s  %-5s  %-6s  %-8s  %-8s  %s\n",
+		"Kind", "Key", "PerHour", "Burst", "Tokens", "Allowed", "Dropped", "Pending")
+	for _, i := range l {
+		fmt.Printf("%-9s  %-40s  %-8g  %-5d  %-6.1f  %-8d  %-8d  %d\n",
+			i.Kind, i.Key, i.Limit.PerHour, i.Limit.Burst, i.Tokens,
+			i.Allowed, i.Dropped, i.Pending)
+	}
+	return nil
+}
+
 func cmdVerbosity(r *mux.Router, args []string) error {
 	client := &http.Client{}
 	url, err := r.Get("verbosity").URL()
@@ -247,9 +616,14 @@ func runCommand(cmd string, args []string) error {
 	router := nightwatch.NewRouter()
 
 	commands := map[string]func(r *mux.Router, args []string) error{
+		"ack":        cmdAck,
+		"deliveries": cmdDeliveries,
+		"history":    cmdHistory,
 		"list":       cmdList,
+		"ratelimits": cmdRateLimits,
 		"register":   cmdRegister,
 		"show":       cmdShow,
+		"silence":    cmdSilence,
 		"start":      cmdStart,
 		"stop":       cmdStop,
 		"unregister": cmdUnregister,
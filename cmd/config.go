@@ -1,6 +1,7 @@
 package main
 
 import (
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -59,13 +60,40 @@ func loadFile(f string) error {
 	}
 
 	for _, m := range monitors {
-		// ignoring errors is safe at this point.
-		monitor.Register(m)
+		if err := monitor.Register(m); err != nil {
+			return fmt.Errorf("%s: %v", m.Name(), err)
+		}
 		m.Start()
 	}
 	return nil
 }
 
+// routingFile is the file in the config directory to define
+// receivers and routes.  It is not a monitor config.
+const routingFile = "routing.yaml"
+
+// loadRouting loads routingFile in dir.
+// If the file does not exist, nil is returned.
+func loadRouting(dir string) (*monitor.Router, error) {
+	content, err := ioutil.ReadFile(filepath.Join(dir, routingFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d := new(nightwatch.RoutingDefinition)
+	if err := yaml.Unmarshal(content, d); err != nil {
+		return nil, fmt.Errorf("%s: %v", routingFile, err)
+	}
+	r, err := nightwatch.CreateRouter(d)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", routingFile, err)
+	}
+	return r, nil
+}
+
 func loadConfigs(dir string) error {
 	files, err := filepath.Glob(filepath.Join(dir, "*.yaml"))
 	if err != nil {
@@ -73,6 +101,9 @@ func loadConfigs(dir string) error {
 	}
 
 	for _, f := range files {
+		if filepath.Base(f) == routingFile {
+			continue
+		}
 		if err := loadFile(f); err != nil {
 			return err
 		}
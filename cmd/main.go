@@ -4,14 +4,19 @@ import (
 	"encoding/json"
 	"flag"
 	"fmt"
+	"math"
 	"os"
+	"path/filepath"
+	"strconv"
 	"strings"
+	"time"
 
 	"nightwatch"
 	_ "nightwatch/actions/all"
 	_ "nightwatch/filters/all"
 	"nightwatch/monitor"
 	_ "nightwatch/probes/all"
+	"nightwatch/state"
 	"nightwatch/util/cmd"
 	"nightwatch/util/version"
 
@@ -21,11 +26,23 @@ import (
 const (
 	defaultConfDir    = "/usr/local/etc/nightwatch"
 	defaultListenAddr = "localhost:3838"
+	defaultStateDir   = "/var/lib/nightwatch"
+
+	defaultRetryInitialBackoff = 10 * time.Second
+	defaultRetryMaxBackoff     = 10 * time.Minute
+	defaultRetryMaxAge         = 24 * time.Hour
+	deadLetterFile             = "dead-letters.log"
 )
 
 var (
 	confDir    = flag.String("c", defaultConfDir, "directory for monitor configs")
 	listenAddr = flag.String("s", defaultListenAddr, "HTTP server address")
+	stateDir   = flag.String("state", defaultStateDir, "directory to persist monitor states (empty disables)")
+	retryAge   = flag.Duration("retry-max-age", defaultRetryMaxAge, "maximum age to retry failed notifications (0 disables)")
+	rcptRate   = flag.Float64("recipient-rate-limit", 0, "notifications per hour allowed for each recipient (0 disables)")
+	rcptBurst  = flag.Int("recipient-rate-burst", 0, "notifications allowed at once for each recipient (default: the rate limit)")
+	probeLimit = flag.Int("probe-limit", 0, "maximum number of probes running at once (0 disables)")
+	typeLimits = flag.String("probe-type-limits", "", "maximum number of probes running at once for each probe type, e.g. \"exec=4,sql=2\"")
 	vinfo      = flag.Bool("version", false, "show version info.")
 )
 
@@ -41,10 +58,20 @@ Options:
 	fmt.Fprint(os.Stderr, `
 Commands:
     server              Start agent server.
+    ack [options] ID   Acknowledge the failure of a monitor.
+                       Run "ack -h" for options.
+    deliveries         List failed notifications.
+    history ID         Show recent probe results of a monitor.
     list               List registered monitors.
+    ratelimits         List notification rate limiters.
     register FILE      Register monitors defined in FILE.
                        If FILE is "-", nightwatch reads from stdin.
     show ID            Show the status of a monitor for ID.
+    silence add [options]
+                       Mute notifications of matching monitors.
+                       Run "silence add -h" for options.
+    silence list       List silences.
+    silence expire ID  Expire a silence.
     start ID           Start a monitor.
     stop ID            Stop a monitor.
     unregister ID      Stop and unregister a monitor.
@@ -87,6 +114,56 @@ func main() {
 		return
 	}
 
+	// dir is empty if states are not persisted.
+	dir := openStateStore(*stateDir)
+	if len(dir) > 0 {
+		if err := monitor.LoadSilences(); err != nil {
+			glog.Errorf("failed to load silences!error: %v", err)
+		}
+	}
+
+	// receivers must be ready before restored notifications are retried.
+	router, err := loadRouting(*confDir)
+	if err != nil {
+		glog.Errorf("loadRouting failed!error: %v", err)
+		os.Exit(1)
+	}
+	if router != nil {
+		if err := monitor.SetRouter(router); err != nil {
+			glog.Errorf("failed to init receivers!error: %v", err)
+			os.Exit(1)
+		}
+	}
+
+	if *retryAge > 0 {
+		p := &monitor.RetryPolicy{
+			InitialBackoff: defaultRetryInitialBackoff,
+			MaxBackoff:     defaultRetryMaxBackoff,
+			MaxAge:         *retryAge,
+		}
+		if len(dir) > 0 {
+			p.DeadLetterFile = filepath.Join(dir, deadLetterFile)
+		}
+		monitor.StartRetrying(p)
+	}
+
+	if *rcptRate > 0 {
+		burst := *rcptBurst
+		if burst == 0 {
+			burst = int(math.Ceil(*rcptRate))
+		}
+		monitor.SetRecipientRateLimit(monitor.RateLimit{PerHour: *rcptRate, Burst: burst})
+	}
+
+	limits, err := parseTypeLimits(*typeLimits)
+	if err != nil {
+		glog.Errorf("invalid -probe-type-limits!error: %v", err)
+		os.Exit(1)
+	}
+	if *probeLimit > 0 || len(limits) > 0 {
+		monitor.SetScheduler(monitor.NewScheduler(*probeLimit, limits))
+	}
+
 	if err := loadConfigs(*confDir); err != nil {
 		glog.Errorf("loadConfigs failed!error: %v", err)
 		os.Exit(1)
@@ -94,7 +171,7 @@ func main() {
 
 	nightwatch.Server(*listenAddr)
 	glog.Infof("nightwatch listen on: %s", *listenAddr)
-	err := cmd.Wait()
+	err = cmd.Wait()
 	if err != nil && !cmd.IsSignaled(err) {
 		glog.Errorf("nightwatch encounter unknow abnormal!error: %v", err)
 		os.Exit(1)
@@ -105,4 +182,52 @@ func main() {
 		glog.Infof("stop monitor: %s", m.String())
 		m.Stop()
 	}
+	if router != nil {
+		router.Flush()
+	}
+}
+
+// parseTypeLimits parses a comma separated list of TYPE=N.
+// openStateStore sets the state store in dir, and returns the
+// directory actually used.  If dir is not writable, e.g. nightwatch
+// runs as a non-root user, a directory under the temporary directory
+// is used instead.
+func openStateStore(dir string) string {
+	if len(dir) == 0 {
+		return ""
+	}
+
+	s, err := state.NewFileStore(dir)
+	if err != nil {
+		glog.Errorf("failed to open state store!dir: %s, error: %v", dir, err)
+		dir = filepath.Join(os.TempDir(), "nightwatch")
+		s, err = state.NewFileStore(dir)
+	}
+	if err != nil {
+		glog.Errorf("states are not persisted!dir: %s, error: %v", dir, err)
+		return ""
+	}
+	glog.Infof("state store opened, dir: %s", dir)
+	monitor.SetStateStore(s)
+	return dir
+}
+
+func parseTypeLimits(s string) (map[string]int, error) {
+	limits := make(map[string]int)
+	for _, kv := range strings.Split(s, ",") {
+		kv = strings.TrimSpace(kv)
+		if len(kv) == 0 {
+			continue
+		}
+		i := strings.IndexByte(kv, '=')
+		if i <= 0 {
+			return nil, fmt.Errorf("bad limit: %s", kv)
+		}
+		n, err := strconv.Atoi(kv[i+1:])
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("bad limit: %s", kv)
+		}
+		limits[kv[:i]] = n
+	}
+	return limits, nil
 }
@@ -1,29 +1,40 @@
 package nightwatch
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"math"
 	"time"
 
 	"nightwatch/actions"
 	"nightwatch/filters"
 	"nightwatch/monitor"
 	"nightwatch/probes"
+	"nightwatch/schedule"
 )
 
 const (
 	typeKey         = "type"
+	rateLimitKey    = "rate_limit"
+	rateBurstKey    = "rate_burst"
 	defaultInterval = 60 * time.Second
 	defaultTimeout  = 59 * time.Second
 )
 
 // Errors for cr-monitor.
 var (
-	ErrBadName      = errors.New("bad monitor name")
-	ErrNoType       = errors.New("no type")
-	ErrInvalidType  = errors.New("invalid type")
-	ErrInvalidRange = errors.New("invalid min/max range")
-	ErrNoKey        = errors.New("no key")
+	ErrBadName       = errors.New("bad monitor name")
+	ErrNoType        = errors.New("no type")
+	ErrInvalidType   = errors.New("invalid type")
+	ErrInvalidRange  = errors.New("invalid min/max range")
+	ErrNoKey         = errors.New("no key")
+	ErrInvalidRepeat = errors.New("invalid repeat definition")
+	ErrInvalidRoute  = errors.New("invalid routing definition")
+
+	ErrInvalidRateLimit = errors.New("invalid rate limit")
+	ErrInvalidSchedule  = errors.New("invalid schedule")
+	ErrInvalidInterval  = errors.New("invalid interval")
 )
 
 // MonitorDefinition is a struct to load monitor definitions.
@@ -31,12 +42,110 @@ var (
 type MonitorDefinition struct {
 	Name     string                   `yaml:"name" json:"name"`
 	Probe    map[string]interface{}   `yaml:"probe" json:"probe"`
-	Filter   map[string]interface{}   `yaml:"filter" json:"filter,omitempty"`
+	Filter   FilterDefinitions        `yaml:"filter" json:"filter,omitempty"`
 	Actions  []map[string]interface{} `yaml:"actions" json:"actions"`
 	Interval int                      `yaml:"interval" json:"interval,omitempty"`
 	Timeout  int                      `yaml:"timeout" json:"timeout,omitempty"`
 	Min      float64                  `yaml:"min" json:"min,omitempty"`
 	Max      float64                  `yaml:"max" json:"max,omitempty"`
+
+	// Optional ranges for severities.  CritMin and CritMax default to
+	// Min and Max.  WarnMin and WarnMax default to the critical range.
+	WarnMin *float64 `yaml:"warn_min" json:"warn_min,omitempty"`
+	WarnMax *float64 `yaml:"warn_max" json:"warn_max,omitempty"`
+	CritMin *float64 `yaml:"crit_min" json:"crit_min,omitempty"`
+	CritMax *float64 `yaml:"crit_max" json:"crit_max,omitempty"`
+
+	Repeat *RepeatDefinition `yaml:"repeat" json:"repeat,omitempty"`
+
+	// DependsOn lists names of parent monitors.  While a parent is
+	// failing, notifications of this monitor are inhibited.
+	DependsOn []string `yaml:"depends_on" json:"depends_on,omitempty"`
+
+	// Labels are used to route events of the monitor.
+	Labels map[string]string `yaml:"labels" json:"labels,omitempty"`
+
+	// Schedule is a cron expression.  If given, probes run at
+	// matching times instead of every Interval.
+	Schedule string `yaml:"schedule" json:"schedule,omitempty"`
+
+	// ActiveWindows limit probes to the windows.  Outside them the
+	// monitor is inactive.
+	ActiveWindows []*WindowDefinition `yaml:"active_windows" json:"active_windows,omitempty"`
+
+	// Timezone is the IANA time zone name for Schedule and
+	// ActiveWindows.  The local time zone is used by default.
+	Timezone string `yaml:"timezone" json:"timezone,omitempty"`
+
+	// StartJitter is the maximum seconds of a random delay before
+	// the first probe.
+	StartJitter int `yaml:"start_jitter" json:"start_jitter,omitempty"`
+
+	// RetryInterval is seconds between probes while failing.
+	// Zero means Interval.
+	RetryInterval int `yaml:"retry_interval" json:"retry_interval,omitempty"`
+
+	// BackoffInterval enables backoff while failing.  The interval
+	// doubles after each failing probe up to BackoffInterval seconds.
+	BackoffInterval int `yaml:"backoff_interval" json:"backoff_interval,omitempty"`
+
+	// Priority orders probes waiting for a slot when concurrent
+	// probes are limited.  Higher values start first.
+	Priority int `yaml:"priority" json:"priority,omitempty"`
+
+	// HistorySize is the number of recent samples to keep.
+	// Zero disables the history.  The default is monitor.DefaultHistorySize.
+	HistorySize *int `yaml:"history_size" json:"history_size,omitempty"`
+}
+
+// WindowDefinition defines a recurring time window.
+type WindowDefinition struct {
+	// Cron is a cron expression of times the window opens.
+	Cron string `yaml:"cron" json:"cron"`
+
+	// Duration is minutes the window lasts.
+	Duration int `yaml:"duration" json:"duration"`
+}
+
+// RepeatDefinition defines re-notifications and escalations while
+// a monitor is failing.
+type RepeatDefinition struct {
+	// Interval is minutes between re-notifications.  Zero disables them.
+	Interval int `yaml:"interval" json:"interval,omitempty"`
+
+	// MaxPerDay limits re-notifications per day.  Zero means no limit.
+	MaxPerDay int `yaml:"max_per_day" json:"max_per_day,omitempty"`
+
+	Escalations []*EscalationDefinition `yaml:"escalations" json:"escalations,omitempty"`
+}
+
+// EscalationDefinition defines an escalation step.
+type EscalationDefinition struct {
+	// After is minutes since the failure started to reach this step.
+	After   int                      `yaml:"after" json:"after"`
+	Actions []map[string]interface{} `yaml:"actions" json:"actions"`
+}
+
+// FilterDefinitions is an ordered list of filter definitions.
+//
+// The output of a filter is fed to the next filter.  For compatibility
+// with older definitions, a single filter map is also accepted.
+type FilterDefinitions []map[string]interface{}
+
+// UnmarshalJSON implements json.Unmarshaler.
+func (fd *FilterDefinitions) UnmarshalJSON(data []byte) error {
+	var l []map[string]interface{}
+	if err := json.Unmarshal(data, &l); err == nil {
+		*fd = l
+		return nil
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(data, &m); err != nil {
+		return err
+	}
+	*fd = FilterDefinitions{m}
+	return nil
 }
 
 func getType(m map[string]interface{}) (t string, err error) {
@@ -65,45 +174,168 @@ func getParams(m map[string]interface{}) map[string]interface{} {
 	return nm
 }
 
-// CreateMonitor creates a monitor from MonitorDefinition.
-func CreateMonitor(d *MonitorDefinition) (*monitor.Monitor, error) {
-	if len(d.Name) == 0 {
-		return nil, ErrBadName
+// getRateLimit takes rate limit parameters out of action params.
+func getRateLimit(params map[string]interface{}) (monitor.RateLimit, error) {
+	var l monitor.RateLimit
+	perHour, err := GetFloat(rateLimitKey, params)
+	switch err {
+	case nil:
+	case ErrNoKey:
+		return l, nil
+	default:
+		return l, err
+	}
+	burst, err := GetInt(rateBurstKey, params)
+	switch err {
+	case nil:
+	case ErrNoKey:
+		burst = int(math.Ceil(perHour))
+	default:
+		return l, err
 	}
+	if perHour <= 0 || burst < 0 {
+		return l, ErrInvalidRateLimit
+	}
+	delete(params, rateLimitKey)
+	delete(params, rateBurstKey)
 
-	t, err := getType(d.Probe)
-	if err != nil {
-		return nil, err
+	l.PerHour = perHour
+	l.Burst = burst
+	return l, nil
+}
+
+func createActors(name string, defs []map[string]interface{}) ([]actions.Actor, error) {
+	var actors []actions.Actor
+	for _, ad := range defs {
+		t, err := getType(ad)
+		if err != nil {
+			return nil, err
+		}
+		params := getParams(ad)
+		rl, err := getRateLimit(params)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v in action %s", name, err, t)
+		}
+		a, err := actions.Construct(t, params)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %v in action %s", name, err, t)
+		}
+		if rl.PerHour > 0 {
+			monitor.SetRateLimit(a, rl)
+		}
+		actors = append(actors, a)
 	}
-	probe, err := probes.Construct(t, getParams(d.Probe))
-	if err != nil {
-		return nil, fmt.Errorf("%s: %v in probe", d.Name, err)
+	return actors, nil
+}
+
+func createRepeatPolicy(name string, d *RepeatDefinition) (*monitor.RepeatPolicy, error) {
+	if d.Interval < 0 || d.MaxPerDay < 0 {
+		return nil, ErrInvalidRepeat
 	}
 
-	var filter filters.Filter
-	if d.Filter != nil {
-		t, err = getType(d.Filter)
+	p := &monitor.RepeatPolicy{
+		Interval:  time.Duration(d.Interval) * time.Minute,
+		MaxPerDay: d.MaxPerDay,
+	}
+	var last time.Duration
+	for _, ed := range d.Escalations {
+		after := time.Duration(ed.After) * time.Minute
+		if after < last {
+			return nil, ErrInvalidRepeat
+		}
+		last = after
+
+		actors, err := createActors(name, ed.Actions)
 		if err != nil {
 			return nil, err
 		}
-		f, err := filters.Construct(t, getParams(d.Filter))
+		p.Escalations = append(p.Escalations, &monitor.Escalation{
+			After:  after,
+			Actors: actors,
+		})
+	}
+	return p, nil
+}
+
+func createSchedule(m *monitor.Monitor, d *MonitorDefinition) error {
+	loc := time.Local
+	if len(d.Timezone) > 0 {
+		l, err := time.LoadLocation(d.Timezone)
 		if err != nil {
-			return nil, fmt.Errorf("%s: %v in filter", d.Name, err)
+			return fmt.Errorf("%s: %v: %v", d.Name, ErrInvalidSchedule, err)
 		}
-		filter = f
+		loc = l
 	}
 
-	var actors []actions.Actor
-	for _, ad := range d.Actions {
-		t, err = getType(ad)
+	if len(d.Schedule) > 0 {
+		c, err := schedule.ParseInLocation(d.Schedule, loc)
+		if err != nil {
+			return fmt.Errorf("%s: %v: %v", d.Name, ErrInvalidSchedule, err)
+		}
+		m.SetSchedule(c)
+	}
+
+	var windows []*schedule.Window
+	for _, wd := range d.ActiveWindows {
+		if wd.Duration <= 0 {
+			return fmt.Errorf("%s: %v: invalid window duration", d.Name, ErrInvalidSchedule)
+		}
+		w, err := schedule.NewWindow(wd.Cron, time.Duration(wd.Duration)*time.Minute, loc)
+		if err != nil {
+			return fmt.Errorf("%s: %v: %v", d.Name, ErrInvalidSchedule, err)
+		}
+		windows = append(windows, w)
+	}
+	if len(windows) > 0 {
+		m.SetActiveWindows(windows)
+	}
+	return nil
+}
+
+func createFilters(d *MonitorDefinition) ([]filters.Filter, error) {
+	var fs []filters.Filter
+	for _, fd := range d.Filter {
+		t, err := getType(fd)
 		if err != nil {
 			return nil, err
 		}
-		a, err := actions.Construct(t, getParams(ad))
+		f, err := filters.Construct(t, getParams(fd))
 		if err != nil {
-			return nil, fmt.Errorf("%s: %v in action %s", d.Name, err, t)
+			return nil, fmt.Errorf("%s: %v in filter %s", d.Name, err, t)
 		}
-		actors = append(actors, a)
+		fs = append(fs, f)
+	}
+	return fs, nil
+}
+
+// CreateMonitor creates a monitor from MonitorDefinition.
+func CreateMonitor(d *MonitorDefinition) (*monitor.Monitor, error) {
+	if len(d.Name) == 0 {
+		return nil, ErrBadName
+	}
+
+	t, err := getType(d.Probe)
+	if err != nil {
+		return nil, err
+	}
+	probe, err := probes.Construct(t, getParams(d.Probe))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v in probe", d.Name, err)
+	}
+
+	// construct filters once to validate definitions.
+	if _, err := createFilters(d); err != nil {
+		return nil, err
+	}
+	newFilters := func() []filters.Filter {
+		// errors are impossible as definitions are validated.
+		fs, _ := createFilters(d)
+		return fs
+	}
+
+	actors, err := createActors(d.Name, d.Actions)
+	if err != nil {
+		return nil, err
 	}
 
 	interval := time.Duration(d.Interval) * time.Second
@@ -116,10 +348,69 @@ func CreateMonitor(d *MonitorDefinition) (*monitor.Monitor, error) {
 		timeout = defaultTimeout
 	}
 
-	if d.Min > d.Max {
+	crit := monitor.Range{Min: d.Min, Max: d.Max}
+	if d.CritMin != nil {
+		crit.Min = *d.CritMin
+	}
+	if d.CritMax != nil {
+		crit.Max = *d.CritMax
+	}
+	warn := crit
+	if d.WarnMin != nil {
+		warn.Min = *d.WarnMin
+	}
+	if d.WarnMax != nil {
+		warn.Max = *d.WarnMax
+	}
+
+	if crit.Min > crit.Max || warn.Min > warn.Max {
+		return nil, ErrInvalidRange
+	}
+	if warn.Min < crit.Min || crit.Max < warn.Max {
 		return nil, ErrInvalidRange
 	}
 
-	return monitor.NewMonitor(d.Name, probe, filter, actors,
-		interval, timeout, d.Min, d.Max), nil
+	m := monitor.NewMonitor(d.Name, probe, newFilters, actors,
+		interval, timeout, crit, warn)
+
+	m.SetProbeType(t)
+	m.SetPriority(d.Priority)
+	if d.HistorySize != nil {
+		if *d.HistorySize < 0 {
+			return nil, fmt.Errorf("%s: negative history_size", d.Name)
+		}
+		m.SetHistorySize(*d.HistorySize)
+	}
+
+	if len(d.DependsOn) > 0 {
+		m.SetDependencies(d.DependsOn)
+	}
+	if len(d.Labels) > 0 {
+		m.SetLabels(d.Labels)
+	}
+
+	if err := createSchedule(m, d); err != nil {
+		return nil, err
+	}
+
+	if d.StartJitter < 0 || d.RetryInterval < 0 || d.BackoffInterval < 0 {
+		return nil, ErrInvalidInterval
+	}
+	if d.StartJitter > 0 || d.RetryInterval > 0 || d.BackoffInterval > 0 {
+		m.SetIntervalPolicy(&monitor.IntervalPolicy{
+			StartJitter:   time.Duration(d.StartJitter) * time.Second,
+			RetryInterval: time.Duration(d.RetryInterval) * time.Second,
+			MaxBackoff:    time.Duration(d.BackoffInterval) * time.Second,
+		})
+	}
+
+	if d.Repeat != nil {
+		p, err := createRepeatPolicy(d.Name, d.Repeat)
+		if err != nil {
+			return nil, err
+		}
+		m.SetRepeatPolicy(p)
+	}
+
+	return m, nil
 }
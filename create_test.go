@@ -0,0 +1,90 @@
+package nightwatch
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/ghodss/yaml"
+)
+
+func TestFilterDefinitions(t *testing.T) {
+	cases := []struct {
+		name      string
+		unmarshal func([]byte, interface{}) error
+		data      string
+		types     []string
+	}{
+		{
+			name:      "yaml map",
+			unmarshal: yaml.Unmarshal,
+			data: `
+name: legacy
+filter:
+  type: average
+  init: 0
+`,
+			types: []string{"average"},
+		},
+		{
+			name:      "yaml list",
+			unmarshal: yaml.Unmarshal,
+			data: `
+name: chain
+filter:
+  - type: average
+    init: 0
+  - type: average
+`,
+			types: []string{"average", "average"},
+		},
+		{
+			name:      "yaml none",
+			unmarshal: yaml.Unmarshal,
+			data:      `name: none`,
+		},
+		{
+			name:      "json map",
+			unmarshal: json.Unmarshal,
+			data:      `{"name": "legacy", "filter": {"type": "average", "init": 0}}`,
+			types:     []string{"average"},
+		},
+		{
+			name:      "json list",
+			unmarshal: json.Unmarshal,
+			data:      `{"name": "chain", "filter": [{"type": "average", "init": 0}, {"type": "average"}]}`,
+			types:     []string{"average", "average"},
+		},
+		{
+			name:      "json none",
+			unmarshal: json.Unmarshal,
+			data:      `{"name": "none"}`,
+		},
+	}
+
+	for _, c := range cases {
+		d := new(MonitorDefinition)
+		if err := c.unmarshal([]byte(c.data), d); err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if len(d.Filter) != len(c.types) {
+			t.Errorf("%s: unexpected number of filters: %d", c.name, len(d.Filter))
+			continue
+		}
+		for i, fd := range d.Filter {
+			typ, err := getType(fd)
+			if err != nil {
+				t.Errorf("%s: filter #%d: %v", c.name, i, err)
+				continue
+			}
+			if typ != c.types[i] {
+				t.Errorf("%s: filter #%d: unexpected type: %s", c.name, i, typ)
+			}
+		}
+	}
+
+	d := new(MonitorDefinition)
+	if err := json.Unmarshal([]byte(`{"filter": "average"}`), d); err == nil {
+		t.Error("invalid filter definition is accepted")
+	}
+}
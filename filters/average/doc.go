@@ -6,5 +6,7 @@ The constructor takes these parameters:
     Name    Type     Default   Description
     init    float64        0   Initial value.
     window  int           10   Window size.
+
+The window is persisted across restarts when a state store is configured.
 */
 package average
@@ -1,6 +1,7 @@
 package average
 
 import (
+	"encoding/json"
 	"fmt"
 
 	"nightwatch/filters"
@@ -36,6 +37,31 @@ func (f *filter) Put(v float64) (avg float64) {
 	return
 }
 
+type state struct {
+	Values []float64 `json:"values"`
+	Index  int       `json:"index"`
+}
+
+func (f *filter) State() (json.RawMessage, error) {
+	return json.Marshal(state{f.values, f.index})
+}
+
+func (f *filter) Restore(data json.RawMessage) error {
+	var st state
+	if err := json.Unmarshal(data, &st); err != nil {
+		return err
+	}
+	if len(st.Values) != len(f.values) {
+		return fmt.Errorf("window size mismatch: %d", len(st.Values))
+	}
+	if st.Index < 0 || st.Index >= len(f.values) {
+		return fmt.Errorf("invalid index: %d", st.Index)
+	}
+	copy(f.values, st.Values)
+	f.index = st.Index
+	return nil
+}
+
 func (f *filter) String() string {
 	return fmt.Sprintf("filter:average(window=%d, init=%g)",
 		len(f.values), f.init)
@@ -2,6 +2,7 @@
 package filters
 
 import (
+	"encoding/json"
 	"errors"
 	"sync"
 )
@@ -18,6 +19,19 @@ type Filter interface {
 	String() string
 }
 
+// Stateful is an optional interface for filters that have internal
+// state worth persisting across nightwatch restarts.
+type Stateful interface {
+	// State returns a snapshot of the internal state.
+	State() (json.RawMessage, error)
+
+	// Restore restores the internal state from a snapshot
+	// returned by State.  Restore is called after Init.
+	//
+	// Non-nil error is logged, and the filter is left initialized.
+	Restore(data json.RawMessage) error
+}
+
 // Constructor is a function to create a filter.
 //
 // params are configuration options for the probe.
@@ -0,0 +1,69 @@
+package nightwatch
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"nightwatch/monitor"
+
+	"github.com/gorilla/mux"
+)
+
+// AckDefinition represents JSON request to acknowledge a monitor.
+//
+// ExpiresAt or Duration optionally limits the acknowledgement.
+type AckDefinition struct {
+	Author    string    `json:"author"`
+	Comment   string    `json:"comment"`
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+	Duration  string    `json:"duration,omitempty"`
+}
+
+func handleAck(w http.ResponseWriter, r *http.Request) {
+	// guaranteed no error by mux.
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	m := monitor.FindMonitor(id)
+	if m == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if mt != "application/json" {
+		http.Error(w, "bad content type", http.StatusBadRequest)
+		return
+	}
+
+	var d AckDefinition
+	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	a := &monitor.Ack{
+		Author:    d.Author,
+		Comment:   d.Comment,
+		At:        time.Now(),
+		ExpiresAt: d.ExpiresAt,
+	}
+	if len(d.Duration) > 0 {
+		dur, err := time.ParseDuration(d.Duration)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		a.ExpiresAt = a.At.Add(dur)
+	}
+
+	if err := m.Acknowledge(a); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+	}
+}
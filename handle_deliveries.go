@@ -0,0 +1,35 @@
+package nightwatch
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"nightwatch/monitor"
+)
+
+// Deliveries represents JSON response for deliveries command.
+type Deliveries struct {
+	Pending []*monitor.Delivery `json:"pending"`
+	Dead    []*monitor.Delivery `json:"dead"`
+}
+
+func handleDeliveries(w http.ResponseWriter, r *http.Request) {
+	dead, err := monitor.DeadDeliveries()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	d := &Deliveries{
+		Pending: monitor.PendingDeliveries(),
+		Dead:    dead,
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+}
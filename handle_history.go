@@ -0,0 +1,38 @@
+package nightwatch
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"nightwatch/monitor"
+
+	"github.com/gorilla/mux"
+)
+
+// History represents JSON response for history command.
+type History []*monitor.Sample
+
+func handleHistory(w http.ResponseWriter, r *http.Request) {
+	// guaranteed no error by mux.
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	m := monitor.FindMonitor(id)
+	if m == nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	h := History(m.History())
+	if h == nil {
+		h = make(History, 0)
+	}
+	data, err := json.Marshal(h)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+}
@@ -19,8 +19,12 @@ func handleList(w http.ResponseWriter, r *http.Request) {
 			Running:  m.Running(),
 			Failing:  m.Failing(),
 			Status:   m.Status(),
+			Severity: string(m.Severity()),
 			Times:    m.Times(),
 			FailedAt: m.FailedAt(),
+
+			InhibitedBy: m.InhibitedBy(),
+			Ack:         m.Acked(),
 		})
 	}
 
@@ -19,8 +19,45 @@ type MonitorInfo struct {
 	Running  bool   `json:"running"`
 	Failing  bool   `json:"failing"`
 	Status   string `json:"status"`
+	Severity string `json:"severity"`
 	Times    int64  `json:"times"`
 	FailedAt string `json:"failedAt"`
+
+	// InhibitedBy is the name of the failing parent monitor.
+	InhibitedBy string `json:"inhibitedBy,omitempty"`
+
+	// Ack is the acknowledgement of the current failure.
+	Ack *monitor.Ack `json:"ack,omitempty"`
+
+	// Series is set only for monitors with labeled series.
+	Series []*SeriesInfo `json:"series,omitempty"`
+}
+
+// SeriesInfo represents status of a labeled series of a monitor.
+type SeriesInfo struct {
+	Labels   map[string]string `json:"labels"`
+	Severity string            `json:"severity"`
+	FailedAt string            `json:"failedAt"`
+	Muted    string            `json:"muted,omitempty"`
+}
+
+func seriesInfo(m *monitor.Monitor) []*SeriesInfo {
+	var l []*SeriesInfo
+	for _, s := range m.Series() {
+		if len(s.Labels) == 0 {
+			continue
+		}
+		si := &SeriesInfo{
+			Labels:   s.Labels,
+			Severity: string(s.Severity),
+			Muted:    s.Muted,
+		}
+		if s.FailedAt != nil {
+			si.FailedAt = s.FailedAt.Format("2006-01-02 15:04:05")
+		}
+		l = append(l, si)
+	}
+	return l
 }
 
 func handleMonitor(w http.ResponseWriter, r *http.Request) {
@@ -40,8 +77,13 @@ func handleMonitor(w http.ResponseWriter, r *http.Request) {
 			Running:  m.Running(),
 			Failing:  m.Failing(),
 			Status:   m.Status(),
+			Severity: string(m.Severity()),
 			Times:    m.Times(),
 			FailedAt: m.FailedAt(),
+			Series:   seriesInfo(m),
+
+			InhibitedBy: m.InhibitedBy(),
+			Ack:         m.Acked(),
 		}
 		data, err := json.Marshal(mi)
 		if err != nil {
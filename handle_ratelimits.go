@@ -0,0 +1,26 @@
+package nightwatch
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"nightwatch/monitor"
+)
+
+// RateLimiters represents JSON response for ratelimits command.
+type RateLimiters []*monitor.LimiterStatus
+
+func handleRateLimits(w http.ResponseWriter, r *http.Request) {
+	l := RateLimiters(monitor.RateLimiters())
+	if l == nil {
+		l = make(RateLimiters, 0)
+	}
+	data, err := json.Marshal(l)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Write(data)
+}
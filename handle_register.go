@@ -35,8 +35,15 @@ func handleRegister(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// ignoring error is safe here.
-	monitor.Register(m)
+	switch err := monitor.Register(m); err {
+	case nil:
+	case monitor.ErrRegistered:
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	default:
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	glog.Infof("new monitor, monitor_id: %d, name: %s", m.ID(), m.Name())
 	m.Start()
 
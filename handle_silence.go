@@ -0,0 +1,124 @@
+package nightwatch
+
+import (
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"nightwatch/monitor"
+
+	"github.com/gorilla/mux"
+)
+
+// SilenceDefinition represents JSON request to add a silence.
+//
+// For one-time silences, EndsAt or Duration is required.
+// For recurring silences with Cron, Duration is the length of
+// each window and EndsAt is optional.
+type SilenceDefinition struct {
+	Monitor  string            `json:"monitor,omitempty"`
+	Labels   map[string]string `json:"labels,omitempty"`
+	StartsAt time.Time         `json:"starts_at,omitempty"`
+	EndsAt   time.Time         `json:"ends_at,omitempty"`
+	Duration string            `json:"duration,omitempty"`
+	Cron     string            `json:"cron,omitempty"`
+	Author   string            `json:"author"`
+	Comment  string            `json:"comment"`
+}
+
+// SilenceInfo represents a silence.
+// This is used by silence list command.
+type SilenceInfo struct {
+	*monitor.Silence
+	State string `json:"state"`
+}
+
+// SilenceList represents JSON response for silence list command.
+type SilenceList []*SilenceInfo
+
+func newSilence(d *SilenceDefinition) (*monitor.Silence, error) {
+	s := &monitor.Silence{
+		Monitor:  d.Monitor,
+		Labels:   d.Labels,
+		StartsAt: d.StartsAt,
+		EndsAt:   d.EndsAt,
+		Cron:     d.Cron,
+		Author:   d.Author,
+		Comment:  d.Comment,
+	}
+	if s.StartsAt.IsZero() {
+		s.StartsAt = time.Now()
+	}
+
+	if len(d.Duration) > 0 {
+		dur, err := time.ParseDuration(d.Duration)
+		if err != nil {
+			return nil, err
+		}
+		if len(d.Cron) > 0 {
+			s.Duration = monitor.Duration(dur)
+		} else if s.EndsAt.IsZero() {
+			s.EndsAt = s.StartsAt.Add(dur)
+		}
+	}
+	return s, nil
+}
+
+func handleSilences(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		now := time.Now()
+		l := make(SilenceList, 0)
+		for _, s := range monitor.Silences() {
+			l = append(l, &SilenceInfo{s, s.State(now)})
+		}
+		data, err := json.Marshal(l)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write(data)
+		return
+	}
+
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if mt != "application/json" {
+		http.Error(w, "bad content type", http.StatusBadRequest)
+		return
+	}
+
+	var d SilenceDefinition
+	if err := json.NewDecoder(r.Body).Decode(&d); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s, err := newSilence(&d)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	id, err := monitor.AddSilence(s)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte(fmt.Sprintf("%d", id)))
+}
+
+func handleSilence(w http.ResponseWriter, r *http.Request) {
+	// guaranteed no error by mux.
+	id, _ := strconv.Atoi(mux.Vars(r)["id"])
+
+	if err := monitor.ExpireSilence(id); err != nil {
+		http.NotFound(w, r)
+	}
+}
@@ -3,6 +3,8 @@ package nightwatch
 import (
 	"net/http"
 
+	"nightwatch/metrics"
+
 	"github.com/gorilla/mux"
 )
 
@@ -32,10 +34,45 @@ func NewRouter() *mux.Router {
 			handleMonitor(w, r)
 		})
 
+	r.Path("/monitor/{id:[0-9]+}/history").
+		Name("history").
+		Methods(http.MethodGet).
+		HandlerFunc(handleHistory)
+
+	r.Path("/monitor/{id:[0-9]+}/ack").
+		Name("ack").
+		Methods(http.MethodPost).
+		HandlerFunc(handleAck)
+
+	r.Path("/silences").
+		Name("silences").
+		Methods(http.MethodGet, http.MethodPost).
+		HandlerFunc(handleSilences)
+
+	r.Path("/silence/{id:[0-9]+}").
+		Name("silence").
+		Methods(http.MethodDelete).
+		HandlerFunc(handleSilence)
+
+	r.Path("/deliveries").
+		Name("deliveries").
+		Methods(http.MethodGet).
+		HandlerFunc(handleDeliveries)
+
+	r.Path("/ratelimits").
+		Name("ratelimits").
+		Methods(http.MethodGet).
+		HandlerFunc(handleRateLimits)
+
 	r.Path("/verbosity").
 		Name("verbosity").
 		HandlerFunc(handleVerbosity)
 
+	r.Path("/metrics").
+		Name("metrics").
+		Methods(http.MethodGet).
+		HandlerFunc(metrics.Handler)
+
 	r.Path("/version").
 		Name("version").
 		Methods(http.MethodGet).
@@ -0,0 +1,343 @@
+/*
+Package metrics implements a small set of metrics exposed in the
+Prometheus text format.
+
+Metrics are registered globally with label names, and children are
+looked up by label values:
+
+    var latency = metrics.NewHistogramVec("nightwatch_dispatch_seconds",
+        "Dispatch latency.", metrics.DefaultBuckets, "monitor")
+
+    latency.With("monitorA").Observe(0.1)
+*/
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultBuckets are default histogram buckets in seconds.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10, 30}
+
+type metric interface {
+	write(w io.Writer, name, labels string)
+}
+
+type family struct {
+	name       string
+	help       string
+	typ        string
+	labelNames []string
+	newMetric  func() metric
+
+	lock     sync.Mutex
+	children map[string]metric
+}
+
+var (
+	registryLock = new(sync.Mutex)
+	registry     []*family
+)
+
+func register(f *family) {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	for _, t := range registry {
+		if t.name == f.name {
+			panic("duplicate metric: " + f.name)
+		}
+	}
+	registry = append(registry, f)
+}
+
+func (f *family) with(values []string) metric {
+	if len(values) != len(f.labelNames) {
+		panic(fmt.Sprintf("%s: wrong number of label values", f.name))
+	}
+
+	l := make([]string, len(values))
+	for i, v := range values {
+		l[i] = f.labelNames[i] + "=" + strconv.Quote(v)
+	}
+	key := strings.Join(l, ",")
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	m, ok := f.children[key]
+	if !ok {
+		m = f.newMetric()
+		f.children[key] = m
+	}
+	return m
+}
+
+// Delete removes the child for label values.
+func (f *family) delete(values []string) {
+	l := make([]string, len(values))
+	for i, v := range values {
+		l[i] = f.labelNames[i] + "=" + strconv.Quote(v)
+	}
+
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	delete(f.children, strings.Join(l, ","))
+}
+
+func (f *family) write(w io.Writer) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	fmt.Fprintf(w, "# HELP %s %s\n", f.name, f.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", f.name, f.typ)
+
+	keys := make([]string, 0, len(f.children))
+	for k := range f.children {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		f.children[k].write(w, f.name, k)
+	}
+}
+
+func newFamily(name, help, typ string, labels []string, ctor func() metric) *family {
+	f := &family{
+		name:       name,
+		help:       help,
+		typ:        typ,
+		labelNames: labels,
+		newMetric:  ctor,
+		children:   make(map[string]metric),
+	}
+	register(f)
+	return f
+}
+
+func formatLabels(labels, extra string) string {
+	switch {
+	case len(labels) == 0 && len(extra) == 0:
+		return ""
+	case len(labels) == 0:
+		return "{" + extra + "}"
+	case len(extra) == 0:
+		return "{" + labels + "}"
+	}
+	return "{" + labels + "," + extra + "}"
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// Counter is a monotonically increasing value.
+type Counter struct {
+	lock sync.Mutex
+	v    float64
+}
+
+// Inc increments the counter by 1.
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+// Add adds v to the counter.  v must not be negative.
+func (c *Counter) Add(v float64) {
+	c.lock.Lock()
+	c.v += v
+	c.lock.Unlock()
+}
+
+// Value returns the current value.
+func (c *Counter) Value() float64 {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.v
+}
+
+func (c *Counter) write(w io.Writer, name, labels string) {
+	fmt.Fprintf(w, "%s%s %s\n", name, formatLabels(labels, ""), formatFloat(c.Value()))
+}
+
+// CounterVec is a family of counters.
+type CounterVec struct {
+	f *family
+}
+
+// NewCounterVec registers a new family of counters.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{newFamily(name, help, "counter", labels, func() metric {
+		return new(Counter)
+	})}
+}
+
+// With returns the counter for label values.
+func (v *CounterVec) With(values ...string) *Counter {
+	return v.f.with(values).(*Counter)
+}
+
+// Delete removes the counter for label values.
+func (v *CounterVec) Delete(values ...string) {
+	v.f.delete(values)
+}
+
+// Gauge is a value that can go up and down.
+type Gauge struct {
+	lock sync.Mutex
+	v    float64
+}
+
+// Set sets the gauge to v.
+func (g *Gauge) Set(v float64) {
+	g.lock.Lock()
+	g.v = v
+	g.lock.Unlock()
+}
+
+// Add adds v to the gauge.
+func (g *Gauge) Add(v float64) {
+	g.lock.Lock()
+	g.v += v
+	g.lock.Unlock()
+}
+
+// Inc increments the gauge by 1.
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+// Dec decrements the gauge by 1.
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+// Value returns the current value.
+func (g *Gauge) Value() float64 {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return g.v
+}
+
+func (g *Gauge) write(w io.Writer, name, labels string) {
+	fmt.Fprintf(w, "%s%s %s\n", name, formatLabels(labels, ""), formatFloat(g.Value()))
+}
+
+// GaugeVec is a family of gauges.
+type GaugeVec struct {
+	f *family
+}
+
+// NewGaugeVec registers a new family of gauges.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{newFamily(name, help, "gauge", labels, func() metric {
+		return new(Gauge)
+	})}
+}
+
+// With returns the gauge for label values.
+func (v *GaugeVec) With(values ...string) *Gauge {
+	return v.f.with(values).(*Gauge)
+}
+
+// Delete removes the gauge for label values.
+func (v *GaugeVec) Delete(values ...string) {
+	v.f.delete(values)
+}
+
+// Histogram counts observations in buckets.
+type Histogram struct {
+	lock    sync.Mutex
+	buckets []float64
+	counts  []uint64
+	sum     float64
+	count   uint64
+}
+
+// Observe adds an observation.
+func (h *Histogram) Observe(v float64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for i, b := range h.buckets {
+		if v <= b {
+			h.counts[i]++
+		}
+	}
+	h.sum += v
+	h.count++
+}
+
+// Count returns the number of observations.
+func (h *Histogram) Count() uint64 {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.count
+}
+
+func (h *Histogram) write(w io.Writer, name, labels string) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	for i, b := range h.buckets {
+		le := "le=" + strconv.Quote(formatFloat(b))
+		fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(labels, le), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket%s %d\n", name, formatLabels(labels, `le="+Inf"`), h.count)
+	fmt.Fprintf(w, "%s_sum%s %s\n", name, formatLabels(labels, ""), formatFloat(h.sum))
+	fmt.Fprintf(w, "%s_count%s %d\n", name, formatLabels(labels, ""), h.count)
+}
+
+// HistogramVec is a family of histograms.
+type HistogramVec struct {
+	f *family
+}
+
+// NewHistogramVec registers a new family of histograms.
+// buckets must be sorted in ascending order.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{newFamily(name, help, "histogram", labels, func() metric {
+		return &Histogram{
+			buckets: buckets,
+			counts:  make([]uint64, len(buckets)),
+		}
+	})}
+}
+
+// With returns the histogram for label values.
+func (v *HistogramVec) With(values ...string) *Histogram {
+	return v.f.with(values).(*Histogram)
+}
+
+// Delete removes the histogram for label values.
+func (v *HistogramVec) Delete(values ...string) {
+	v.f.delete(values)
+}
+
+// WriteText writes all registered metrics in the Prometheus text format.
+func WriteText(w io.Writer) {
+	registryLock.Lock()
+	l := append([]*family(nil), registry...)
+	registryLock.Unlock()
+
+	for _, f := range l {
+		f.write(w)
+	}
+}
+
+// Handler is a http.HandlerFunc to expose metrics.
+func Handler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	WriteText(w)
+}
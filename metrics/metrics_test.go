@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+// useRegistry replaces the registry with an empty one until the
+// returned function is called, so that tests can run repeatedly.
+func useRegistry() func() {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	saved := registry
+	registry = nil
+	return func() {
+		registryLock.Lock()
+		defer registryLock.Unlock()
+		registry = saved
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	defer useRegistry()()
+
+	c := NewCounterVec("test_total", "Test counter.", "monitor")
+	g := NewGaugeVec("test_gauge", "Test gauge.")
+	h := NewHistogramVec("test_seconds", "Test histogram.", []float64{0.1, 1}, "monitor")
+
+	c.With("a").Inc()
+	c.With("a").Add(2)
+	g.With().Set(5)
+	h.With("a").Observe(0.5)
+
+	var buf bytes.Buffer
+	WriteText(&buf)
+	out := buf.String()
+
+	for _, s := range []string{
+		"# TYPE test_total counter\n",
+		`test_total{monitor="a"} 3` + "\n",
+		"test_gauge 5\n",
+		`test_seconds_bucket{monitor="a",le="0.1"} 0` + "\n",
+		`test_seconds_bucket{monitor="a",le="1"} 1` + "\n",
+		`test_seconds_bucket{monitor="a",le="+Inf"} 1` + "\n",
+		`test_seconds_count{monitor="a"} 1` + "\n",
+	} {
+		if !strings.Contains(out, s) {
+			t.Errorf("missing %q in:\n%s", s, out)
+		}
+	}
+
+	c.Delete("a")
+	buf.Reset()
+	WriteText(&buf)
+	if strings.Contains(buf.String(), `test_total{monitor="a"}`) {
+		t.Error(`deleted counter is still written`)
+	}
+}
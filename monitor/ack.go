@@ -0,0 +1,102 @@
+package monitor
+
+import (
+	"time"
+
+	"nightwatch/actions"
+
+	"github.com/golang/glog"
+)
+
+// Ack is an acknowledgement of a failure.
+//
+// While a failure is acknowledged, re-notifications and escalations
+// are stopped.  The acknowledgement ends when the monitor recovers
+// or at ExpiresAt.
+type Ack struct {
+	Author  string    `json:"author"`
+	Comment string    `json:"comment"`
+	At      time.Time `json:"at"`
+
+	// ExpiresAt is zero if the acknowledgement lasts until recovery.
+	ExpiresAt time.Time `json:"expires_at,omitempty"`
+}
+
+// Active returns true if a is effective at t.
+func (a *Ack) Active(t time.Time) bool {
+	return a.ExpiresAt.IsZero() || t.Before(a.ExpiresAt)
+}
+
+// Acknowledge acknowledges the failure of m, then calls actors
+// implementing actions.Acker.  If m is not failing, ErrNotFailing
+// is returned.
+func (m *Monitor) Acknowledge(a *Ack) error {
+	if a.At.IsZero() {
+		a.At = time.Now()
+	}
+
+	m.lock.Lock()
+	if m.worstSeverity() == actions.SeverityOK {
+		m.lock.Unlock()
+		return ErrNotFailing
+	}
+	m.ack = a
+	actors := m.allActors()
+	m.lock.Unlock()
+
+	glog.Infof("monitor acknowledged, monitor: %s, author: %s, comment: %s, expires_at: %v", m.name, a.Author, a.Comment, a.ExpiresAt)
+
+	if r := getRouter(); r != nil {
+		actors = append(actors, r.actors()...)
+	}
+	for _, t := range actors {
+		ak, ok := t.(actions.Acker)
+		if !ok {
+			continue
+		}
+		err := protect(m.name, kindAction, func() error {
+			return ak.Ack(m.name, a.Author, a.Comment)
+		})
+		if err != nil {
+			glog.Errorf("failed to acknowledge, monitor: %s, action: %s, error: %v", m.name, t.String(), err)
+		}
+	}
+	return nil
+}
+
+// Acked returns the effective acknowledgement of m, or nil.
+func (m *Monitor) Acked() *Ack {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.activeAck(time.Now())
+}
+
+// activeAck returns the effective acknowledgement at now, or nil.
+//
+// This must be called with m.lock held.
+func (m *Monitor) activeAck(now time.Time) *Ack {
+	if m.ack == nil || !m.ack.Active(now) {
+		return nil
+	}
+	t := *m.ack
+	return &t
+}
+
+// clearAck ends the acknowledgement when m recovers or it expires.
+//
+// This must be called with m.lock held.
+func (m *Monitor) clearAck(now time.Time) {
+	if m.ack == nil {
+		return
+	}
+	switch {
+	case m.worstSeverity() == actions.SeverityOK:
+		glog.Infof("acknowledgement cleared by recovery, monitor: %s", m.name)
+	case !m.ack.Active(now):
+		glog.Infof("acknowledgement expired, monitor: %s", m.name)
+	default:
+		return
+	}
+	m.ack = nil
+}
@@ -0,0 +1,73 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"nightwatch/actions"
+	"nightwatch/probes"
+)
+
+type ackActor struct {
+	testActor
+	acks []string
+}
+
+func (a *ackActor) Ack(name, author, comment string) error {
+	a.acks = append(a.acks, name+":"+author+":"+comment)
+	return nil
+}
+
+func TestAck(t *testing.T) {
+	a := new(ackActor)
+	m := NewMonitor("ack", nil, nil, []actions.Actor{a},
+		time.Second, time.Second,
+		Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+	m.SetRepeatPolicy(&RepeatPolicy{Interval: time.Nanosecond})
+
+	if err := m.Acknowledge(&Ack{Author: "alice"}); err != ErrNotFailing {
+		t.Error("ok monitor must not be acknowledged:", err)
+	}
+
+	m.update([]*probes.Result{{Value: 1}}, nil)
+	if err := m.Acknowledge(&Ack{Author: "alice", Comment: "on it"}); err != nil {
+		t.Fatal(err)
+	}
+	if len(a.acks) != 1 || a.acks[0] != "ack:alice:on it" {
+		t.Error("Ack is not called:", a.acks)
+	}
+	for i := 0; i < 3; i++ {
+		time.Sleep(time.Millisecond)
+		m.update([]*probes.Result{{Value: 1}}, nil)
+	}
+	if len(a.events) != 1 {
+		t.Error("repeats are not stopped:", len(a.events))
+	}
+	if ack := m.Acked(); ack == nil || ack.Author != "alice" {
+		t.Error("ack is not reported:", ack)
+	}
+
+	// recovery clears the acknowledgement.
+	m.update([]*probes.Result{{Value: 0}}, nil)
+	if m.Acked() != nil {
+		t.Error("ack is not cleared by recovery")
+	}
+	if len(a.events) != 2 || a.events[1].Type != actions.EventRecover {
+		t.Error("recovery is not notified")
+	}
+
+	// expired acknowledgements no longer stop repeats.
+	m.update([]*probes.Result{{Value: 1}}, nil)
+	err := m.Acknowledge(&Ack{Author: "bob", ExpiresAt: time.Now().Add(time.Millisecond)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Millisecond)
+	m.update([]*probes.Result{{Value: 1}}, nil)
+	if len(a.events) != 4 || a.events[3].Type != actions.EventRepeat {
+		t.Error("repeats are not resumed after expiry:", len(a.events))
+	}
+	if m.Acked() != nil {
+		t.Error("expired ack is reported")
+	}
+}
@@ -0,0 +1,105 @@
+package monitor
+
+import (
+	"nightwatch/actions"
+)
+
+// SetDependencies sets names of parent monitors.
+//
+// While any parent is failing or unknown, failures of m are inhibited,
+// i.e. actors of m are not notified.  When a parent recovers, m is
+// probed immediately to notify its current state.
+//
+// This should be called before the monitor is registered.
+func (m *Monitor) SetDependencies(parents []string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.dependsOn = append([]string(nil), parents...)
+}
+
+// Dependencies returns names of parent monitors.
+func (m *Monitor) Dependencies() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return append([]string(nil), m.dependsOn...)
+}
+
+// InhibitedBy returns the name of the parent monitor that inhibits
+// notifications of m, or an empty string.
+func (m *Monitor) InhibitedBy() string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.worstSeverity() == actions.SeverityOK {
+		return ""
+	}
+	return m.inhibitor
+}
+
+// failingParent returns the name of a parent that is not ok.
+//
+// This must be called without m.lock held.
+func (m *Monitor) failingParent() string {
+	for _, name := range m.Dependencies() {
+		p := findMonitorByName(name)
+		if p == nil {
+			continue
+		}
+		if p.Severity() != actions.SeverityOK {
+			return name
+		}
+	}
+	return ""
+}
+
+// wakeChildren lets monitors depending on m probe immediately.
+func (m *Monitor) wakeChildren() {
+	for _, c := range ListMonitors() {
+		for _, name := range c.Dependencies() {
+			if name != m.name {
+				continue
+			}
+			select {
+			case c.wake <- struct{}{}:
+			default:
+			}
+		}
+	}
+}
+
+// checkCycle returns the cycle of monitor names if registering m
+// makes a cycle of dependencies.
+//
+// This must be called with registryLock held.
+func checkCycle(m *Monitor) []string {
+	deps := make(map[string][]string)
+	for _, reg := range registry {
+		deps[reg.name] = reg.Dependencies()
+	}
+	deps[m.name] = m.Dependencies()
+
+	// depth first search from m.
+	visiting := make(map[string]bool)
+	done := make(map[string]bool)
+	var visit func(name string, path []string) []string
+	visit = func(name string, path []string) []string {
+		if visiting[name] {
+			return append(path, name)
+		}
+		if done[name] {
+			return nil
+		}
+		visiting[name] = true
+		for _, p := range deps[name] {
+			if cycle := visit(p, append(path, name)); cycle != nil {
+				return cycle
+			}
+		}
+		visiting[name] = false
+		done[name] = true
+		return nil
+	}
+	return visit(m.name, nil)
+}
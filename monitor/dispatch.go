@@ -0,0 +1,132 @@
+package monitor
+
+import (
+	"context"
+	"time"
+
+	"nightwatch/metrics"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// dispatchQueueSize is the capacity of the dispatch queue of
+	// each monitor.  Notifications are dropped when it is full.
+	dispatchQueueSize = 256
+)
+
+// drainTimeout bounds the time for Stop to deliver notifications left
+// in the dispatch queue.  The rest are handed to the retry queue.
+var drainTimeout = 10 * time.Second
+
+var (
+	dispatchQueueSeconds = metrics.NewHistogramVec(
+		"nightwatch_dispatch_queue_seconds",
+		"Time notifications waited in the dispatch queue.",
+		metrics.DefaultBuckets, "monitor")
+	dispatchSeconds = metrics.NewHistogramVec(
+		"nightwatch_dispatch_duration_seconds",
+		"Time to deliver a notification to an action.",
+		metrics.DefaultBuckets, "monitor")
+	dispatchQueueLength = metrics.NewGaugeVec(
+		"nightwatch_dispatch_queue_length",
+		"Number of notifications in the dispatch queue.",
+		"monitor")
+	dispatchDropped = metrics.NewCounterVec(
+		"nightwatch_dispatch_dropped_total",
+		"Number of notifications dropped due to a full dispatch queue.",
+		"monitor")
+	dispatchErrors = metrics.NewCounterVec(
+		"nightwatch_dispatch_errors_total",
+		"Number of failed deliveries to actions.",
+		"monitor")
+)
+
+// dispatch is a queued notification.
+type dispatch struct {
+	n      *notification
+	queued time.Time
+}
+
+// dispatcher delivers queued notifications in order.
+func (m *Monitor) dispatcher(ctx context.Context) error {
+	for {
+		select {
+		case <-ctx.Done():
+			// Stop drains the rest.
+			return nil
+		case d := <-m.dispatchCh:
+			m.dispatchOne(d)
+		}
+	}
+}
+
+func (m *Monitor) dispatchOne(d *dispatch) {
+	dispatchQueueLength.With(m.name).Dec()
+	dispatchQueueSeconds.With(m.name).Observe(time.Since(d.queued).Seconds())
+	m.deliverAll(d.n)
+}
+
+// drain delivers notifications left in the dispatch queue until
+// drainTimeout expires, then hands the rest to the retry queue.
+func (m *Monitor) drain() {
+	deadline := time.Now().Add(drainTimeout)
+	for {
+		select {
+		case d := <-m.dispatchCh:
+			if time.Now().Before(deadline) {
+				m.dispatchOne(d)
+				continue
+			}
+			dispatchQueueLength.With(m.name).Dec()
+			m.requeue(d.n)
+		default:
+			return
+		}
+	}
+}
+
+// requeue hands n to the retry queue without delivering it.
+// If retrying is not enabled, n is dropped.
+func (m *Monitor) requeue(n *notification) {
+	q := retries
+	if q == nil {
+		dispatchDropped.With(m.name).Inc()
+		glog.Errorf("notification is dropped on stop, monitor: %s, event: %s", m.name, n.event.Type)
+		return
+	}
+
+	m.lock.Lock()
+	all := m.allActors()
+	labels := m.routeLabels(n.event)
+	m.lock.Unlock()
+
+	now := time.Now()
+	for _, a := range n.actors {
+		q.add(&Delivery{
+			Monitor:    m.name,
+			Actor:      a.String(),
+			ActorIndex: actorIndex(all, a),
+			Event:      n.event,
+			CreatedAt:  now,
+		})
+	}
+
+	r := getRouter()
+	if r == nil || !n.route {
+		return
+	}
+	for _, rt := range r.Match(labels) {
+		rc := r.receivers[rt.Receiver]
+		for i, a := range rc.Actors {
+			q.add(&Delivery{
+				Monitor:    m.name,
+				Receiver:   rc.Name,
+				Actor:      a.String(),
+				ActorIndex: i,
+				Event:      n.event,
+				CreatedAt:  now,
+			})
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package monitor
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"nightwatch/actions"
+)
+
+type testProbe struct {
+	v float64
+}
+
+func (p *testProbe) Probe(ctx context.Context) float64 {
+	return p.v
+}
+
+func (p *testProbe) String() string {
+	return "probe:test"
+}
+
+type slowActor struct {
+	testActor
+	lock sync.Mutex
+}
+
+func (a *slowActor) Notify(e *actions.Event) error {
+	time.Sleep(100 * time.Millisecond)
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.testActor.Notify(e)
+}
+
+// blockActor blocks notifications until release is closed.
+type blockActor struct {
+	lockedActor
+	release chan struct{}
+}
+
+func (a *blockActor) Notify(e *actions.Event) error {
+	<-a.release
+	return a.lockedActor.Notify(e)
+}
+
+func TestDispatch(t *testing.T) {
+	a := &blockActor{release: make(chan struct{})}
+	p := &testProbe{v: 1}
+	m := NewMonitor("dispatch", p, nil, []actions.Actor{a},
+		10*time.Millisecond, time.Second,
+		Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+	m.SetRepeatPolicy(&RepeatPolicy{Interval: time.Nanosecond})
+
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	// probes must not be delayed by the blocked actor.
+	deadline := time.Now().Add(5 * time.Second)
+	for m.Times() < 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if times := m.Times(); times < 4 {
+		t.Errorf("probes are delayed: %d", times)
+	}
+
+	close(a.release)
+	m.Stop()
+
+	// the last probe may be canceled by Stop before notifying.
+	if n := int64(a.count()); n != m.Times() && n != m.Times()-1 {
+		t.Errorf("notifications are lost: %d/%d", n, m.Times())
+	}
+}
+
+func TestDrainTimeout(t *testing.T) {
+	timeout := drainTimeout
+	drainTimeout = 50 * time.Millisecond
+	defer func() {
+		drainTimeout = timeout
+	}()
+
+	retries = &retryQueue{
+		policy: &RetryPolicy{InitialBackoff: time.Hour, MaxAge: time.Hour},
+		nextID: 1,
+	}
+	defer func() {
+		retries = nil
+	}()
+
+	a := new(slowActor)
+	p := &testProbe{v: 1}
+	m := NewMonitor("drain", p, nil, []actions.Actor{a},
+		10*time.Millisecond, time.Second,
+		Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+	m.SetRepeatPolicy(&RepeatPolicy{Interval: time.Nanosecond})
+
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for len(m.dispatchCh) < 10 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	st := time.Now()
+	m.Stop()
+	if d := time.Since(st); d > 2*time.Second {
+		t.Error("Stop is not bounded:", d)
+	}
+
+	a.lock.Lock()
+	delivered := len(a.events)
+	a.lock.Unlock()
+	pending := len(PendingDeliveries())
+	if pending == 0 {
+		t.Error("leftovers are not handed to the retry queue")
+	}
+	if n := int64(delivered + pending); n != m.Times() && n != m.Times()-1 {
+		t.Errorf("notifications are lost: %d+%d/%d", delivered, pending, m.Times())
+	}
+}
+
+// flushActor counts flushes.
+type flushActor struct {
+	lockedActor
+	flushes int
+}
+
+func (a *flushActor) Flush() {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.flushes++
+}
+
+func TestFlushOnStop(t *testing.T) {
+	a := new(flushActor)
+	m := NewMonitor("flush", &testProbe{v: 0}, nil, []actions.Actor{a},
+		time.Second, time.Second,
+		Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	m.Stop()
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if a.flushes != 1 {
+		t.Error("actors are not flushed on stop:", a.flushes)
+	}
+}
@@ -7,4 +7,18 @@ var (
 	ErrRegistered    = errors.New("monitor has already been registered")
 	ErrNotRegistered = errors.New("monitor has not been registered")
 	ErrStarted       = errors.New("monitor has already been started")
+
+	ErrDependencyCycle = errors.New("dependency cycle")
+
+	ErrInvalidSilence  = errors.New("invalid silence")
+	ErrSilenceNotFound = errors.New("silence not found")
+
+	ErrInvalidRoute = errors.New("invalid route")
+
+	ErrNotFailing = errors.New("monitor is not failing")
+
+	ErrPanic        = errors.New("panic")
+	ErrProbeOverrun = errors.New("probe overran its deadline")
+
+	errActorNotFound = errors.New("actor not found")
 )
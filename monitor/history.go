@@ -0,0 +1,99 @@
+package monitor
+
+import (
+	"time"
+
+	"nightwatch/actions"
+)
+
+// DefaultHistorySize is the default number of samples kept for each monitor.
+const DefaultHistorySize = 120
+
+// Sample is a probe result of a series recorded in the history.
+type Sample struct {
+	Time   time.Time         `json:"time"`
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// Raw is the value returned by the probe, and Value is the value
+	// after filters.  Both are zero if the probe failed.
+	Raw   float64 `json:"raw"`
+	Value float64 `json:"value"`
+
+	// Duration is the time the probe took.
+	Duration time.Duration `json:"duration"`
+
+	Severity actions.Severity `json:"severity"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// history is a ring buffer of samples.
+type history struct {
+	samples []*Sample
+	next    int
+	full    bool
+}
+
+func newHistory(size int) *history {
+	return &history{samples: make([]*Sample, size)}
+}
+
+func (h *history) add(s *Sample) {
+	if len(h.samples) == 0 {
+		return
+	}
+	h.samples[h.next] = s
+	h.next++
+	if h.next == len(h.samples) {
+		h.next = 0
+		h.full = true
+	}
+}
+
+// list returns samples from the oldest.
+func (h *history) list() []*Sample {
+	if !h.full {
+		return append([]*Sample(nil), h.samples[:h.next]...)
+	}
+	l := make([]*Sample, 0, len(h.samples))
+	l = append(l, h.samples[h.next:]...)
+	return append(l, h.samples[:h.next]...)
+}
+
+// SetHistorySize sets the number of samples to keep.  Zero disables
+// the history.  Recorded samples are discarded.
+// This should be called before the monitor starts.
+func (m *Monitor) SetHistorySize(n int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.history = newHistory(n)
+}
+
+// History returns recent samples of all series from the oldest.
+func (m *Monitor) History() []*Sample {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.history.list()
+}
+
+// record adds the last result of s to the history.
+//
+// This must be called with m.lock held.
+func (m *Monitor) record(s *series, raw float64, now time.Time) {
+	sm := &Sample{
+		Time:     now,
+		Labels:   s.labels,
+		Duration: m.probeDuration,
+		Severity: s.severity,
+		Error:    s.lastError,
+	}
+	if s.unknown {
+		sm.Severity = actions.SeverityUnknown
+	}
+	if len(sm.Error) == 0 {
+		sm.Raw = raw
+		sm.Value = s.lastValue
+	}
+	m.history.add(sm)
+}
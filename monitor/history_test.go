@@ -0,0 +1,62 @@
+package monitor
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"nightwatch/actions"
+	"nightwatch/filters"
+	"nightwatch/probes"
+)
+
+// doubleFilter doubles values.
+type doubleFilter struct{}
+
+func (f doubleFilter) Init() {}
+
+func (f doubleFilter) Put(v float64) float64 {
+	return v * 2
+}
+
+func (f doubleFilter) String() string {
+	return "filter:double"
+}
+
+func TestHistory(t *testing.T) {
+	m := NewMonitor("history", nil,
+		func() []filters.Filter { return []filters.Filter{doubleFilter{}} }, nil,
+		time.Second, time.Second,
+		Range{Min: 0, Max: 5}, Range{Min: 0, Max: 5})
+	m.SetHistorySize(3)
+
+	m.update([]*probes.Result{{Value: 1}}, nil)
+	m.update([]*probes.Result{{Value: 2}}, nil)
+	m.update(nil, errors.New("connection refused"))
+	m.update([]*probes.Result{{Value: 4}}, nil)
+
+	h := m.History()
+	if len(h) != 3 {
+		t.Fatal("unexpected number of samples:", len(h))
+	}
+	if h[0].Raw != 2 || h[0].Value != 4 || h[0].Severity != actions.SeverityOK {
+		t.Errorf("unexpected sample: %+v", h[0])
+	}
+	if h[1].Error != "connection refused" || h[1].Severity != actions.SeverityUnknown {
+		t.Errorf("unexpected sample: %+v", h[1])
+	}
+	if h[2].Raw != 4 || h[2].Value != 8 || h[2].Severity != actions.SeverityCritical {
+		t.Errorf("unexpected sample: %+v", h[2])
+	}
+	for i := 1; i < len(h); i++ {
+		if h[i].Time.Before(h[i-1].Time) {
+			t.Error("samples are not ordered")
+		}
+	}
+
+	m.SetHistorySize(0)
+	m.update([]*probes.Result{{Value: 1}}, nil)
+	if len(m.History()) != 0 {
+		t.Error("history is not disabled")
+	}
+}
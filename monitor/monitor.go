@@ -2,7 +2,6 @@ package monitor
 
 import (
 	"context"
-	"fmt"
 	"sync"
 	"time"
 
@@ -10,69 +9,109 @@ import (
 	"nightwatch/actions"
 	"nightwatch/filters"
 	"nightwatch/probes"
+	"nightwatch/schedule"
 	"nightwatch/util/cmd"
 
 	"github.com/golang/glog"
 )
 
+// Range is a closed range of normal probe results.
+type Range = actions.Range
+
 // Monitor is a unit of monitoring.
 //
-// It consists of a (configured) probe, zero or one filter, and one or
+// It consists of a (configured) probe, zero or more filters, and zero or
 // more actions.  cr-monitor will invoke Prover.Probe periodically at given
-// interval.
+// interval.  Events are also sent to the router if it is set.
 type Monitor struct {
-	id       int
-	name     string
-	probe    probes.Prober
-	filter   filters.Filter
-	actors   []actions.Actor
-	interval time.Duration
-	timeout  time.Duration
-	min      float64
-	max      float64
-	failedAt *time.Time
+	id         int
+	name       string
+	probe      probes.Prober
+	newFilters func() []filters.Filter
+	actors     []actions.Actor
+	interval   time.Duration
+	timeout    time.Duration
+	crit       Range
+	warn       Range
+	series     map[string]*series
+	repeat     *RepeatPolicy
+	dependsOn  []string
+	inhibitor  string
+	labels     map[string]string
+	ack        *Ack
+	cron       *schedule.Cron
+	windows    []*schedule.Window
+	intervals  *IntervalPolicy
+	failStreak int
+	probeType  string
+	priority   int
+	history    *history
+
+	// probeDuration is the duration of the last probe.
+	probeDuration time.Duration
+
+	// savedState is the fingerprint of the last saved state,
+	// and savedAt is the time it was saved.
+	savedState string
+	savedAt    time.Time
 
 	//Status
 	status string
 	times  int64
 
 	// goroutine management
-	lock sync.Mutex
-	env  *cmd.Environment
+	lock        sync.Mutex
+	ctl         sync.Mutex // serializes Start and Stop
+	env         *cmd.Environment
+	dispatchCh  chan *dispatch
+	dispatching bool
+	wake        chan struct{}
 }
 
 // NewMonitor creates and initializes a monitor.
 //
 // name can be any descriptive string for the monitor.
-// p and a should not be nil.  f may be nil.
+// p should not be nil.  f and a may be nil.
+// f creates a new filter chain for each series of the probe.
+// Filters are chained in order; the output of a filter is the
+// input of the next filter.
 // interval is the interval between probes.
 // timeout is the maximum duration for a probe to run.
-// min and max defines the range for normal probe results.
+// Results out of crit are critical, and results out of warn but
+// within crit are warnings.  warn should be within crit; if warn
+// equals crit, the monitor never reports warnings.
 func NewMonitor(
 	name string,
 	p probes.Prober,
-	f filters.Filter,
+	f func() []filters.Filter,
 	a []actions.Actor,
 	interval, timeout time.Duration,
-	min, max float64) *Monitor {
+	crit, warn Range) *Monitor {
 	return &Monitor{
-		id:       uninitializedID,
-		name:     name,
-		probe:    p,
-		filter:   f,
-		actors:   a,
-		interval: interval,
-		timeout:  timeout,
-		min:      min,
-		max:      max,
-		times:    0,
-		status:   "running",
+		id:         uninitializedID,
+		name:       name,
+		probe:      p,
+		newFilters: f,
+		actors:     a,
+		interval:   interval,
+		timeout:    timeout,
+		crit:       crit,
+		warn:       warn,
+		series:     make(map[string]*series),
+		history:    newHistory(DefaultHistorySize),
+		times:      0,
+		status:     "running",
+		dispatchCh: make(chan *dispatch, dispatchQueueSize),
+		wake:       make(chan struct{}, 1),
 	}
 }
 
 // Start starts monitoring.
 // If already started, this returns a non-nil error.
 func (m *Monitor) Start() error {
+	m.ctl.Lock()
+	defer m.ctl.Unlock()
+
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
@@ -81,7 +120,9 @@ func (m *Monitor) Start() error {
 	}
 
 	m.env = cmd.NewEnvironment(context.Background())
+	m.dispatching = true
 	m.env.Go(m.run)
+	m.env.Go(m.dispatcher)
 
 	glog.Infof("monitor started, monitor: %s", m.name)
 
@@ -90,107 +131,237 @@ func (m *Monitor) Start() error {
 
 // Stop stops monitoring.
 func (m *Monitor) Stop() {
-	m.lock.Lock()
-	defer m.lock.Unlock()
+	m.ctl.Lock()
+	defer m.ctl.Unlock()
 
-	if m.env == nil {
+	m.lock.Lock()
+	env := m.env
+	m.lock.Unlock()
+	if env == nil {
 		return
 	}
 
 	glog.Infof("monitor is stopping, monitor: %s", m.name)
 
-	m.env.Cancel(nil)
-	m.env.Wait()
-	m.env = nil
+	// m.lock must not be held here as the goroutines may acquire it.
+	env.Cancel(nil)
+	env.Wait()
 
-	m.failedAt = nil
+	// save run counts and filter states not saved by probes.
+	m.saveState(true)
+
+	m.lock.Lock()
+	m.env = nil
+	m.dispatching = false
+	m.series = make(map[string]*series)
+	m.failStreak = 0
 	m.status = "stopped"
+	m.lock.Unlock()
+
+	// deliver notifications left in the dispatch queue, then those
+	// held by actors.
+	m.drain()
+	m.lock.Lock()
+	actors := m.allActors()
+	m.lock.Unlock()
+	flushActors(m.name, actors)
 
 	glog.Infof("monitor stopped, monitor: %s", m.name)
 }
 
-func (m *Monitor) die() {
+func (m *Monitor) die(err error) {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
+	// stop the dispatcher too.
+	m.env.Cancel(err)
 	m.env = nil
-}
-
-func callProbe(ctx context.Context, p probes.Prober, timeout time.Duration) float64 {
-	ctx, cancel := context.WithTimeout(ctx, timeout)
-	defer cancel()
-	return p.Probe(ctx)
+	m.dispatching = false
 }
 
 func (m *Monitor) run(ctx context.Context) error {
-	if m.filter != nil {
-		m.filter.Init()
-	}
-	for _, a := range m.actors {
-		err := a.Init(m.name)
+	m.restoreState()
+	for _, a := range m.allActors() {
+		err := protect(m.name, kindAction, func() error {
+			return a.Init(m.name)
+		})
 		if err != nil {
 			glog.Errorf("failed to init action, monitor: %s, action: %s", m.name, a.String())
-			m.die()
+			m.die(err)
 			return err
 		}
 	}
 
+	if !m.startDelay(ctx) {
+		return nil
+	}
+
+	// scheduled monitors wait for the first matching time.
+	m.lock.Lock()
+	skip := m.cron != nil
+	m.lock.Unlock()
+
 	for {
 		// create a timer before starting probe.
 		// This way, we can keep consistent interval between probes.
-		t := time.After(m.interval)
-
-		glog.Infof("Switch to monitor: %s", m.name)
-		v := callProbe(ctx, m.probe, m.timeout)
-		m.times++
-
-		// check cancel
-		select {
-		case <-ctx.Done():
-			return nil
-		default:
-			// not canceled
+		now := time.Now()
+		m.lock.Lock()
+		next := m.untilNext(now)
+		t := time.After(next)
+		active := m.active(now)
+		if !active {
+			m.deactivate()
 		}
+		m.lock.Unlock()
 
-		if m.filter != nil {
-			v = m.filter.Put(v)
+		var release func()
+		if !skip && active {
+			// give up the probe if no slot is available until the next one.
+			release = m.waitSlot(ctx, now.Add(next))
 		}
-
-		if (v < m.min) || (m.max < v) {
-			m.status = "failed"
-			if m.failedAt == nil {
-				now := time.Now()
-				m.failedAt = &now
-				for _, a := range m.actors {
-					if err := a.Fail(m.name, v); err != nil {
-						glog.Errorf("failed to call Actor.Fail, monitor: %s, action: %s", m.name, a.String())
-					}
-				}
-				glog.Warningf("monitor failure, monitor: %s, value: %s", m.name, fmt.Sprint(v))
-			}
-		} else {
-			m.status = "running"
-			if m.failedAt != nil {
-				d := time.Since(*m.failedAt)
-				for _, a := range m.actors {
-					if err := a.Recover(m.name, d); err != nil {
-						glog.Errorf("failed to call Actor.Recover, monitor: %s, action: %s", m.name, a.String())
-					}
-				}
-				m.failedAt = nil
-				glog.Warningf("monitor recovery, monitor: %s, duration: %v", m.name, int(d.Seconds()))
+		if release != nil {
+			glog.Infof("Switch to monitor: %s", m.name)
+			st := time.Now()
+			rs, err := callProbe(ctx, m.name, m.probe, m.timeout)
+			release()
+			m.lock.Lock()
+			m.times++
+			m.probeDuration = time.Since(st)
+			m.lock.Unlock()
+
+			// check cancel
+			select {
+			case <-ctx.Done():
+				return nil
+			default:
+				// not canceled
 			}
+
+			m.update(rs, err)
+			m.saveState(false)
 		}
+		skip = false
 
 		select {
 		case <-ctx.Done():
 			return nil
 		case <-t:
 			// interval timer expires
+		case <-m.wake:
+			// a parent monitor has recovered
 		}
 	}
 }
 
+func callActor(a actions.Actor, e *actions.Event) error {
+	return protect(e.Monitor, kindAction, func() error {
+		return actions.Notify(a, e)
+	})
+}
+
+// notify sends a notification to actors and the router.
+//
+// While the monitor is running, notifications are queued and delivered
+// by the dispatcher goroutine so that slow actors never delay probes.
+func (m *Monitor) notify(n *notification) {
+	m.lock.Lock()
+	dispatching := m.dispatching
+	m.lock.Unlock()
+
+	if !dispatching {
+		m.deliverAll(n)
+		return
+	}
+
+	select {
+	case m.dispatchCh <- &dispatch{n, time.Now()}:
+		dispatchQueueLength.With(m.name).Inc()
+	default:
+		dispatchDropped.With(m.name).Inc()
+		glog.Errorf("dispatch queue is full, notification is dropped, monitor: %s, event: %s", m.name, n.event.Type)
+	}
+}
+
+func (m *Monitor) deliverAll(n *notification) {
+	m.lock.Lock()
+	all := m.allActors()
+	labels := m.routeLabels(n.event)
+	m.lock.Unlock()
+
+	for _, a := range n.actors {
+		deliver(&Delivery{
+			Monitor:    m.name,
+			Actor:      a.String(),
+			ActorIndex: actorIndex(all, a),
+			Event:      n.event,
+			CreatedAt:  time.Now(),
+		}, a)
+	}
+
+	if r := getRouter(); r != nil && n.route {
+		r.route(n.event, labels)
+	}
+}
+
+// actorIndex returns the index of a in l, or -1.
+func actorIndex(l []actions.Actor, a actions.Actor) int {
+	for i, t := range l {
+		if t == a {
+			return i
+		}
+	}
+	return -1
+}
+
+// deliver calls a for d.Event or d.Group.  If it fails, the
+// notification is queued for retries when retrying is enabled.
+//
+// Notifications beyond rate limits of a are suppressed.
+func deliver(d *Delivery, a actions.Actor) {
+	if !limit(d, a) {
+		return
+	}
+
+	q := retries
+	if q != nil && q.pending(d.key()) {
+		// queue behind pending notifications to keep the order.
+		q.add(d)
+		return
+	}
+
+	st := time.Now()
+	err := d.call(a)
+	dispatchSeconds.With(d.Source()).Observe(time.Since(st).Seconds())
+	if err == nil {
+		return
+	}
+	dispatchErrors.With(d.Source()).Inc()
+	glog.Errorf("failed to notify actor, monitor: %s, receiver: %s, action: %s, event: %s, error: %v", d.Source(), d.Receiver, d.Actor, d.EventType(), err)
+	if q != nil {
+		d.Attempts = 1
+		d.LastError = err.Error()
+		q.add(d)
+	}
+}
+
+// SetLabels sets labels of the monitor.  Labels are used to route
+// events of the monitor.
+// This should be called before the monitor starts.
+func (m *Monitor) SetLabels(labels map[string]string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.labels = labels
+}
+
+// Labels returns labels of the monitor.
+func (m *Monitor) Labels() map[string]string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.labels
+}
+
 // ID returns the monitor ID.
 //
 // ID is valid only after registration.
@@ -210,7 +381,27 @@ func (m *Monitor) String() string {
 
 // Failing returns true if the monitor is detecting a failure.
 func (m *Monitor) Failing() bool {
-	return m.failedAt != nil
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	for _, s := range m.series {
+		if s.failedAt != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// Severity returns the current severity of the monitor.
+//
+// For multi-series monitors, the worst severity among series is
+// returned.  SeverityUnknown is returned if the last probe failed to
+// determine the value.
+func (m *Monitor) Severity() actions.Severity {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	return m.worstSeverity()
 }
 
 // Running returns true if the monitor is running.
@@ -221,7 +412,7 @@ func (m *Monitor) Running() bool {
 	return m.env != nil
 }
 
-// Status returns the status of the monitor, current status: running, pending, failed
+// Status returns the status of the monitor, current status: running, pending, failed, unknown, inhibited, inactive
 func (m *Monitor) Status() string {
 	m.lock.Lock()
 	defer m.lock.Unlock()
@@ -240,9 +431,16 @@ func (m *Monitor) FailedAt() string {
 	m.lock.Lock()
 	defer m.lock.Unlock()
 
+	var first *time.Time
+	for _, s := range m.series {
+		if s.failedAt != nil && (first == nil || s.failedAt.Before(*first)) {
+			first = s.failedAt
+		}
+	}
+
 	failedAt := ""
-	if m.failedAt != nil {
-		failedAt = m.failedAt.Format("2006-01-02 15:04:05")
+	if first != nil {
+		failedAt = first.Format("2006-01-02 15:04:05")
 	}
 
 	return failedAt
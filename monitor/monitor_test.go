@@ -0,0 +1,468 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"nightwatch/actions"
+	"nightwatch/probes"
+)
+
+type testActor struct {
+	events []*actions.Event
+}
+
+func (a *testActor) Init(name string) error {
+	return nil
+}
+
+func (a *testActor) Fail(name string, v float64) error {
+	return nil
+}
+
+func (a *testActor) Recover(name string, d time.Duration) error {
+	return nil
+}
+
+func (a *testActor) Notify(e *actions.Event) error {
+	a.events = append(a.events, e)
+	return nil
+}
+
+func (a *testActor) String() string {
+	return "action:test"
+}
+
+func TestSeverity(t *testing.T) {
+	a := new(testActor)
+	m := NewMonitor("test", nil, nil, []actions.Actor{a},
+		time.Second, time.Second,
+		Range{Min: 0, Max: 90}, Range{Min: 0, Max: 80})
+
+	values := []float64{10, 85, 85, 95, 85, 10, 100, 10}
+	expected := []struct {
+		typ      string
+		severity actions.Severity
+	}{
+		{actions.EventFail, actions.SeverityWarning},
+		{actions.EventFail, actions.SeverityCritical},
+		{actions.EventFail, actions.SeverityWarning},
+		{actions.EventRecover, actions.SeverityOK},
+		{actions.EventFail, actions.SeverityCritical},
+		{actions.EventRecover, actions.SeverityOK},
+	}
+
+	for _, v := range values {
+		m.update([]*probes.Result{{Value: v}}, nil)
+	}
+
+	if len(a.events) != len(expected) {
+		t.Fatalf("unexpected number of events: %d", len(a.events))
+	}
+	for i, e := range a.events {
+		if e.Type != expected[i].typ || e.Severity != expected[i].severity {
+			t.Errorf("unexpected event #%d: %s %s", i, e.Type, e.Severity)
+		}
+	}
+	if m.Failing() {
+		t.Error(`m.Failing()`)
+	}
+}
+
+func TestUnknown(t *testing.T) {
+	a := new(testActor)
+	m := NewMonitor("test", nil, nil, []actions.Actor{a},
+		time.Second, time.Second,
+		Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+
+	broken := errors.New("unreachable")
+	m.update(nil, broken)
+	m.update(nil, broken)
+	if m.Severity() != actions.SeverityUnknown {
+		t.Error(`m.Severity() != actions.SeverityUnknown`)
+	}
+	if m.Failing() {
+		t.Error(`unknown must not be a failure`)
+	}
+	m.update([]*probes.Result{{Value: 0}}, nil)
+
+	if len(a.events) != 2 {
+		t.Fatalf("unexpected number of events: %d", len(a.events))
+	}
+	if a.events[0].Type != actions.EventUnknown || a.events[0].Error != "unreachable" {
+		t.Error(`a.events[0] is not an unknown event`)
+	}
+	if a.events[1].Type != actions.EventRecover || a.events[1].Previous != actions.SeverityUnknown {
+		t.Error(`a.events[1] is not a recovery from unknown`)
+	}
+}
+
+// legacyActor records Fail and Recover calls.
+type legacyActor struct {
+	calls []string
+}
+
+func (a *legacyActor) Init(name string) error {
+	return nil
+}
+
+func (a *legacyActor) Fail(name string, v float64) error {
+	a.calls = append(a.calls, "fail")
+	return nil
+}
+
+func (a *legacyActor) Recover(name string, d time.Duration) error {
+	a.calls = append(a.calls, "recover")
+	return nil
+}
+
+func (a *legacyActor) String() string {
+	return "action:legacy"
+}
+
+func TestLegacyUnknown(t *testing.T) {
+	broken := errors.New("unreachable")
+	cases := []struct {
+		name  string
+		steps []float64 // -1 for probe errors
+		calls string
+	}{
+		{"ok-unknown-ok", []float64{-1, 0}, ""},
+		{"ok-unknown-critical-ok", []float64{-1, 1, 0}, "fail,recover"},
+		{"ok-critical-unknown-ok", []float64{1, -1, 0}, "fail,recover"},
+		{"ok-critical-unknown-critical-ok", []float64{1, -1, 1, 0}, "fail,recover"},
+	}
+
+	for _, c := range cases {
+		a := new(legacyActor)
+		m := NewMonitor(c.name, nil, nil, []actions.Actor{a},
+			time.Second, time.Second,
+			Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+		for _, v := range c.steps {
+			if v < 0 {
+				m.update(nil, broken)
+			} else {
+				m.update([]*probes.Result{{Value: v}}, nil)
+			}
+		}
+		if calls := strings.Join(a.calls, ","); calls != c.calls {
+			t.Errorf("%s: unexpected calls: %q", c.name, calls)
+		}
+	}
+}
+
+func TestUnknownPrevious(t *testing.T) {
+	a := new(testActor)
+	m := NewMonitor("test", nil, nil, []actions.Actor{a},
+		time.Second, time.Second,
+		Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+
+	m.update([]*probes.Result{{Value: 1}}, nil)
+	m.update(nil, errors.New("unreachable"))
+	m.update([]*probes.Result{{Value: 0}}, nil)
+
+	if len(a.events) != 3 {
+		t.Fatalf("unexpected number of events: %d", len(a.events))
+	}
+	e := a.events[2]
+	if e.Type != actions.EventRecover || e.Previous != actions.SeverityCritical {
+		t.Errorf("unexpected recovery: %s %s", e.Type, e.Previous)
+	}
+}
+
+func TestSeries(t *testing.T) {
+	a := new(testActor)
+	m := NewMonitor("disk", nil, nil, []actions.Actor{a},
+		time.Second, time.Second,
+		Range{Min: 0, Max: 90}, Range{Min: 0, Max: 90})
+
+	root := map[string]string{"mount": "/"}
+	data := map[string]string{"mount": "/data"}
+
+	m.update([]*probes.Result{
+		{Value: 10, Labels: root},
+		{Value: 95, Labels: data},
+	}, nil)
+	if len(a.events) != 1 || a.events[0].Name() != "disk{mount=/data}" {
+		t.Fatal(`/data should fail`)
+	}
+	if len(m.Series()) != 2 {
+		t.Error(`len(m.Series()) != 2`)
+	}
+
+	m.update([]*probes.Result{
+		{Value: 95, Labels: root},
+		{Value: 95, Labels: data},
+	}, nil)
+	if len(a.events) != 2 || a.events[1].Labels["mount"] != "/" {
+		t.Fatal(`/ should fail`)
+	}
+
+	// /data disappears.
+	m.update([]*probes.Result{
+		{Value: 10, Labels: root},
+	}, nil)
+	if len(a.events) != 4 {
+		t.Fatalf("unexpected number of events: %d", len(a.events))
+	}
+	for _, e := range a.events[2:] {
+		if e.Type != actions.EventRecover {
+			t.Errorf("unexpected event for %s: %s", e.Name(), e.Type)
+		}
+	}
+	if m.Failing() || len(m.Series()) != 1 {
+		t.Error(`only / should remain without failure`)
+	}
+}
+
+func TestRepeat(t *testing.T) {
+	team := new(testActor)
+	lead := new(testActor)
+	m := NewMonitor("test", nil, nil, []actions.Actor{team},
+		time.Second, time.Second,
+		Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+	m.SetRepeatPolicy(&RepeatPolicy{
+		Interval:  time.Nanosecond,
+		MaxPerDay: 2,
+	})
+
+	for i := 0; i < 5; i++ {
+		time.Sleep(time.Millisecond)
+		m.update([]*probes.Result{{Value: 1}}, nil)
+	}
+	if len(team.events) != 3 {
+		t.Fatalf("unexpected number of events: %d", len(team.events))
+	}
+	if team.events[2].Type != actions.EventRepeat || team.events[2].Repeat != 2 {
+		t.Error(`team.events[2] is not the second repeat`)
+	}
+	m.update([]*probes.Result{{Value: 0}}, nil)
+
+	team.events = nil
+	m.SetRepeatPolicy(&RepeatPolicy{
+		Interval: time.Nanosecond,
+		Escalations: []*Escalation{
+			{After: 0, Actors: []actions.Actor{lead}},
+		},
+	})
+	for i := 0; i < 3; i++ {
+		time.Sleep(time.Millisecond)
+		m.update([]*probes.Result{{Value: 1}}, nil)
+	}
+	m.update([]*probes.Result{{Value: 0}}, nil)
+
+	// team: fail, recover.  lead: escalation, repeat, recover.
+	if len(team.events) != 2 {
+		t.Errorf("unexpected number of events for team: %d", len(team.events))
+	}
+	if len(lead.events) != 3 {
+		t.Fatalf("unexpected number of events for lead: %d", len(lead.events))
+	}
+	if lead.events[0].Escalation != 1 || lead.events[0].Repeat != 0 {
+		t.Error(`lead.events[0] is not an escalation`)
+	}
+	if lead.events[1].Repeat != 1 {
+		t.Error(`lead.events[1] is not a repeat`)
+	}
+	if lead.events[2].Type != actions.EventRecover {
+		t.Error(`lead.events[2] is not a recovery`)
+	}
+}
+
+func TestSilence(t *testing.T) {
+	a := new(testActor)
+	m := NewMonitor("silence-test", nil, nil, []actions.Actor{a},
+		time.Second, time.Second,
+		Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+
+	_, err := AddSilence(&Silence{Monitor: "silence-.*", EndsAt: time.Now()})
+	if err == nil {
+		t.Error("silence without a valid period should be rejected")
+	}
+	_, err = AddSilence(&Silence{Monitor: "silence-.*", EndsAt: time.Now().Add(time.Hour), Cron: "0 2 * * *"})
+	if err == nil {
+		t.Error("recurring silence without duration should be rejected")
+	}
+
+	id, err := AddSilence(&Silence{
+		Monitor: "silence-.*",
+		EndsAt:  time.Now().Add(time.Hour),
+		Author:  "alice",
+		Comment: "maintenance",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// failure and severity changes are not notified while silenced.
+	m.update([]*probes.Result{{Value: 1}}, nil)
+	m.update([]*probes.Result{{Value: 2}}, nil)
+	if len(a.events) != 0 {
+		t.Fatal("notified while silenced:", len(a.events))
+	}
+	if st := m.Series(); st[0].Muted == "" {
+		t.Error("series is not muted")
+	}
+	if !m.Failing() {
+		t.Error("monitor should keep probing while silenced")
+	}
+
+	// the current state is notified after the silence ends.
+	if err := ExpireSilence(id); err != nil {
+		t.Fatal(err)
+	}
+	m.update([]*probes.Result{{Value: 2}}, nil)
+	if len(a.events) != 1 {
+		t.Fatal("state is not reconciled:", len(a.events))
+	}
+	if e := a.events[0]; e.Type != actions.EventFail || e.Previous != actions.SeverityOK {
+		t.Error("unexpected reconciled event:", e.Type, e.Previous)
+	}
+
+	// failure that starts and ends during a silence is not notified.
+	m.update([]*probes.Result{{Value: 0}}, nil)
+	id, err = AddSilence(&Silence{
+		Labels: map[string]string{"host": "a"},
+		EndsAt: time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.events = nil
+	m.update([]*probes.Result{{Value: 1, Labels: map[string]string{"host": "a"}}}, nil)
+	m.update([]*probes.Result{{Value: 0, Labels: map[string]string{"host": "a"}}}, nil)
+	ExpireSilence(id)
+	m.update([]*probes.Result{{Value: 0, Labels: map[string]string{"host": "a"}}}, nil)
+	if len(a.events) != 0 {
+		t.Error("unexpected events:", len(a.events))
+	}
+
+	if err := ExpireSilence(1000); err != ErrSilenceNotFound {
+		t.Error("expiring unknown silence should fail:", err)
+	}
+	for _, s := range Silences() {
+		if s.State(time.Now()) != SilenceExpired {
+			t.Error("silence is not expired:", s.ID)
+		}
+	}
+}
+
+func TestSilenceEnd(t *testing.T) {
+	a := new(testActor)
+	m := NewMonitor("silence-end", nil, nil, []actions.Actor{a},
+		time.Second, time.Second,
+		Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+	if err := Register(m); err != nil {
+		t.Fatal(err)
+	}
+	defer Unregister(m)
+
+	id, err := AddSilence(&Silence{
+		Monitor: "silence-end",
+		EndsAt:  time.Now().Add(time.Hour),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	endedSilences(time.Now())
+
+	m.update([]*probes.Result{{Value: 1}}, nil)
+	if len(a.events) != 0 {
+		t.Fatal("notified while silenced:", len(a.events))
+	}
+
+	// the state is reconciled when the silence ends, without probes.
+	if err := ExpireSilence(id); err != nil {
+		t.Fatal(err)
+	}
+	l := endedSilences(time.Now())
+	if len(l) != 1 || l[0].ID != id {
+		t.Fatal("ended silence is not detected:", l)
+	}
+	reconcileSilenced(l[0])
+	if len(a.events) != 1 || a.events[0].Type != actions.EventFail {
+		t.Error("state is not reconciled:", len(a.events))
+	}
+}
+
+func TestSilenceDuration(t *testing.T) {
+	s := &Silence{Monitor: "x", Cron: "0 2 * * *", Duration: Duration(2 * time.Hour)}
+	data, err := json.Marshal(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(data), `"duration":"2h0m0s"`) {
+		t.Error("duration is not a string:", string(data))
+	}
+
+	for _, in := range []string{`{"duration":"2h"}`, `{"duration":7200000000000}`} {
+		s := new(Silence)
+		if err := json.Unmarshal([]byte(in), s); err != nil {
+			t.Fatal(err)
+		}
+		if time.Duration(s.Duration) != 2*time.Hour {
+			t.Error("unexpected duration:", in, s.Duration)
+		}
+	}
+}
+
+func TestDependency(t *testing.T) {
+	pa := new(testActor)
+	ca := new(testActor)
+	parent := NewMonitor("dep-parent", nil, nil, []actions.Actor{pa},
+		time.Second, time.Second,
+		Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+	child := NewMonitor("dep-child", nil, nil, []actions.Actor{ca},
+		time.Second, time.Second,
+		Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+	child.SetDependencies([]string{"dep-parent"})
+
+	if err := Register(child); err != nil {
+		t.Fatal(err)
+	}
+	defer Unregister(child)
+	if err := Register(parent); err != nil {
+		t.Fatal(err)
+	}
+	defer Unregister(parent)
+
+	parent.update([]*probes.Result{{Value: 1}}, nil)
+	child.update([]*probes.Result{{Value: 1}}, nil)
+	if len(ca.events) != 0 {
+		t.Fatal("child failure is not inhibited")
+	}
+	if child.Status() != "inhibited" || child.InhibitedBy() != "dep-parent" {
+		t.Error("unexpected status:", child.Status(), child.InhibitedBy())
+	}
+
+	// the child is woken up when the parent recovers.
+	parent.update([]*probes.Result{{Value: 0}}, nil)
+	select {
+	case <-child.wake:
+	default:
+		t.Error("child is not woken up")
+	}
+	child.update([]*probes.Result{{Value: 1}}, nil)
+	if len(ca.events) != 1 || ca.events[0].Type != actions.EventFail {
+		t.Fatal("child failure is not notified after the parent recovers")
+	}
+	if child.Status() != "failed" {
+		t.Error("unexpected status:", child.Status())
+	}
+
+	// cycles are rejected.
+	a := NewMonitor("dep-a", nil, nil, nil, time.Second, time.Second, Range{}, Range{})
+	a.SetDependencies([]string{"dep-b"})
+	b := NewMonitor("dep-b", nil, nil, nil, time.Second, time.Second, Range{}, Range{})
+	b.SetDependencies([]string{"dep-child", "dep-a"})
+	if err := Register(a); err != nil {
+		t.Fatal(err)
+	}
+	defer Unregister(a)
+	if err := Register(b); err != ErrDependencyCycle {
+		t.Error("cycle is not detected:", err)
+	}
+}
@@ -0,0 +1,331 @@
+package monitor
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"nightwatch/actions"
+	"nightwatch/metrics"
+
+	"github.com/golang/glog"
+)
+
+// Kinds of rate limiters.
+const (
+	LimiterAction    = "action"
+	LimiterRecipient = "recipient"
+)
+
+var rateLimitDropped = metrics.NewCounterVec(
+	"nightwatch_ratelimit_dropped_total",
+	"Number of notifications suppressed by rate limits.",
+	"kind", "key")
+
+// RateLimit is a token bucket limit of notifications.
+type RateLimit struct {
+	// PerHour is the number of notifications allowed per hour.
+	// Zero disables the limit.
+	PerHour float64 `json:"per_hour"`
+
+	// Burst is the number of notifications allowed at once.
+	Burst int `json:"burst"`
+}
+
+// LimiterStatus represents the state of a rate limiter.
+type LimiterStatus struct {
+	Kind  string    `json:"kind"`
+	Key   string    `json:"key"`
+	Limit RateLimit `json:"limit"`
+
+	// Tokens is the number of notifications allowed now.
+	Tokens float64 `json:"tokens"`
+
+	Allowed int64 `json:"allowed"`
+	Dropped int64 `json:"dropped"`
+
+	// Pending is the number of notifications suppressed since the
+	// last allowed one.  It is reported with the next notification.
+	Pending int `json:"pending"`
+}
+
+// limiter is a token bucket.
+type limiter struct {
+	kind    string
+	key     string
+	limit   RateLimit
+	tokens  float64
+	last    time.Time
+	allowed int64
+	dropped int64
+	pending int
+
+	// lastDelivery is the last suppressed notification and its actor.
+	// It is sent by timer when a token is available.
+	lastDelivery *Delivery
+	lastActor    actions.Actor
+	timer        *time.Timer
+}
+
+func newLimiter(kind, key string, l RateLimit) *limiter {
+	if l.Burst < 1 {
+		l.Burst = 1
+	}
+	return &limiter{
+		kind:   kind,
+		key:    key,
+		limit:  l,
+		tokens: float64(l.Burst),
+	}
+}
+
+// refill adds tokens for the time since the last refill.
+func (l *limiter) refill(now time.Time) {
+	if !l.last.IsZero() {
+		l.tokens += now.Sub(l.last).Hours() * l.limit.PerHour
+		l.tokens = math.Min(l.tokens, float64(l.limit.Burst))
+	}
+	l.last = now
+}
+
+// schedule starts the timer to send the last suppressed notification
+// when a token is available.
+//
+// This must be called with limitsLock held.
+func (l *limiter) schedule() {
+	if l.timer != nil {
+		return
+	}
+	wait := time.Duration((1 - l.tokens) / l.limit.PerHour * float64(time.Hour))
+	l.timer = time.AfterFunc(wait, l.flush)
+}
+
+// stop stops the timer.
+//
+// This must be called with limitsLock held.
+func (l *limiter) stop() {
+	if l.timer != nil {
+		l.timer.Stop()
+		l.timer = nil
+	}
+	l.lastDelivery = nil
+	l.lastActor = nil
+}
+
+// flush sends the last suppressed notification so that suppressed
+// notifications are reported even if nothing else is sent.
+func (l *limiter) flush() {
+	limitsLock.Lock()
+	l.timer = nil
+	d, a := l.lastDelivery, l.lastActor
+	if d == nil || l.pending == 0 {
+		limitsLock.Unlock()
+		return
+	}
+	for _, t := range limitersOf(a) {
+		if t.lastDelivery == d {
+			t.lastDelivery = nil
+			t.lastActor = nil
+		}
+		// d itself is not suppressed any longer.
+		if t.pending > 0 {
+			t.pending--
+		}
+	}
+	limitsLock.Unlock()
+
+	glog.Infof("sending notification suppressed by rate limit, monitor: %s, action: %s, event: %s", d.Source(), d.Actor, d.EventType())
+	nd := *d
+	nd.CreatedAt = time.Now()
+	deliver(&nd, a)
+}
+
+func (l *limiter) status() *LimiterStatus {
+	return &LimiterStatus{
+		Kind:    l.kind,
+		Key:     l.key,
+		Limit:   l.limit,
+		Tokens:  l.tokens,
+		Allowed: l.allowed,
+		Dropped: l.dropped,
+		Pending: l.pending,
+	}
+}
+
+var (
+	limitsLock      = new(sync.Mutex)
+	actorLimiters   = make(map[actions.Actor]*limiter)
+	recipientLimit  RateLimit
+	recipientLimits = make(map[string]*limiter)
+)
+
+// SetRateLimit limits notifications to a.
+func SetRateLimit(a actions.Actor, l RateLimit) {
+	limitsLock.Lock()
+	defer limitsLock.Unlock()
+
+	if t, ok := actorLimiters[a]; ok {
+		t.stop()
+	}
+	if l.PerHour <= 0 {
+		delete(actorLimiters, a)
+		return
+	}
+	actorLimiters[a] = newLimiter(LimiterAction, a.String(), l)
+}
+
+// SetRecipientRateLimit limits notifications to each recipient of
+// actors implementing actions.Recipient.
+func SetRecipientRateLimit(l RateLimit) {
+	limitsLock.Lock()
+	defer limitsLock.Unlock()
+
+	for _, t := range recipientLimits {
+		t.stop()
+	}
+	recipientLimit = l
+	recipientLimits = make(map[string]*limiter)
+}
+
+// limitersOf returns limiters for a.
+//
+// This must be called with limitsLock held.
+func limitersOf(a actions.Actor) []*limiter {
+	var l []*limiter
+	if al, ok := actorLimiters[a]; ok {
+		l = append(l, al)
+	}
+	r, ok := a.(actions.Recipient)
+	if !ok || recipientLimit.PerHour <= 0 {
+		return l
+	}
+	key := r.Recipient()
+	rl, ok := recipientLimits[key]
+	if !ok {
+		rl = newLimiter(LimiterRecipient, key, recipientLimit)
+		recipientLimits[key] = rl
+	}
+	return append(l, rl)
+}
+
+// allow takes a token from every limiter of a for d.
+// If d is allowed, it returns true and the number of notifications
+// suppressed before.  If force is true, d is always allowed.
+func allow(d *Delivery, a actions.Actor, now time.Time, force bool) (bool, int) {
+	limitsLock.Lock()
+	defer limitsLock.Unlock()
+
+	l := limitersOf(a)
+	ok := true
+	for _, t := range l {
+		t.refill(now)
+		if t.tokens < 1 && !force {
+			ok = false
+		}
+	}
+
+	suppressed := 0
+	for _, t := range l {
+		if !ok {
+			t.pending++
+			t.lastDelivery = d
+			t.lastActor = a
+			if t.tokens < 1 {
+				t.dropped++
+				rateLimitDropped.With(t.kind, t.key).Inc()
+				t.schedule()
+			}
+			continue
+		}
+		t.tokens = math.Max(t.tokens-1, 0)
+		t.allowed++
+		if t.pending > suppressed {
+			suppressed = t.pending
+		}
+		t.pending = 0
+		t.lastDelivery = nil
+		t.lastActor = nil
+	}
+	return ok, suppressed
+}
+
+// withSuppressed returns a copy of e reporting n suppressed notifications.
+func withSuppressed(e *actions.Event, n int) *actions.Event {
+	t := *e
+	t.Suppressed = n
+	note := fmt.Sprintf("and %d more notifications suppressed by rate limits", n)
+	if len(t.Message) > 0 {
+		t.Message += "; " + note
+	} else {
+		t.Message = note
+	}
+	return &t
+}
+
+// recovers returns true if d notifies a recovery.
+func recovers(d *Delivery) bool {
+	if d.Group == nil {
+		return d.Event.Type == actions.EventRecover
+	}
+	for _, e := range d.Group.Events {
+		if e.Type == actions.EventRecover {
+			return true
+		}
+	}
+	return false
+}
+
+// limit applies rate limits of a to d.  If d is not allowed, false
+// is returned.  Otherwise, the number of suppressed notifications
+// is reported with the event of d.
+//
+// Recoveries are never suppressed so that a delivered failure is
+// always followed by its recovery.  Suppressed notifications are
+// reported by timer when a token is available if nothing else is sent.
+func limit(d *Delivery, a actions.Actor) bool {
+	ok, n := allow(d, a, time.Now(), recovers(d))
+	if !ok {
+		glog.Warningf("notification suppressed by rate limit, monitor: %s, action: %s, event: %s", d.Source(), d.Actor, d.EventType())
+		return false
+	}
+	if n == 0 {
+		return true
+	}
+
+	if d.Group == nil {
+		d.Event = withSuppressed(d.Event, n)
+		return true
+	}
+	g := *d.Group
+	g.Events = append([]*actions.Event(nil), g.Events...)
+	last := len(g.Events) - 1
+	g.Events[last] = withSuppressed(g.Events[last], n)
+	d.Group = &g
+	return true
+}
+
+// RateLimiters returns the states of rate limiters ordered by kind and key.
+func RateLimiters() []*LimiterStatus {
+	limitsLock.Lock()
+	defer limitsLock.Unlock()
+
+	now := time.Now()
+	var l []*LimiterStatus
+	for _, t := range actorLimiters {
+		t.refill(now)
+		l = append(l, t.status())
+	}
+	for _, t := range recipientLimits {
+		t.refill(now)
+		l = append(l, t.status())
+	}
+	sort.Slice(l, func(i, j int) bool {
+		if l[i].Kind != l[j].Kind {
+			return l[i].Kind < l[j].Kind
+		}
+		return l[i].Key < l[j].Key
+	})
+	return l
+}
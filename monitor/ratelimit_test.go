@@ -0,0 +1,111 @@
+package monitor
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"nightwatch/actions"
+	"nightwatch/probes"
+)
+
+type recipientActor struct {
+	testActor
+	recipient string
+}
+
+func (a *recipientActor) Recipient() string {
+	return a.recipient
+}
+
+func TestRateLimit(t *testing.T) {
+	a := new(testActor)
+	SetRateLimit(a, RateLimit{PerHour: 1, Burst: 2})
+	defer SetRateLimit(a, RateLimit{})
+
+	m := NewMonitor("ratelimit", nil, nil, []actions.Actor{a},
+		time.Second, time.Second,
+		Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+
+	for i := 0; i < 5; i++ {
+		m.update([]*probes.Result{{Value: 1}}, nil)
+		m.update([]*probes.Result{{Value: 0}}, nil)
+	}
+
+	// fail and recover use the burst, then only recoveries are allowed.
+	if len(a.events) != 6 {
+		t.Fatal("rate limit is not applied:", len(a.events))
+	}
+	for i, e := range a.events {
+		if i > 0 && e.Type != actions.EventRecover {
+			t.Errorf("unexpected event #%d: %s", i, e.Type)
+		}
+	}
+	e := a.events[2]
+	if e.Suppressed != 1 || !strings.Contains(e.Message, "and 1 more") {
+		t.Errorf("suppressed notifications are not reported: %d %s", e.Suppressed, e.Message)
+	}
+
+	var st *LimiterStatus
+	for _, l := range RateLimiters() {
+		if l.Kind == LimiterAction && l.Key == a.String() {
+			st = l
+		}
+	}
+	if st == nil {
+		t.Fatal("limiter is not listed")
+	}
+	if st.Allowed != 6 || st.Dropped != 4 || st.Pending != 0 {
+		t.Errorf("unexpected status: %+v", st)
+	}
+}
+
+func TestRateLimitFlush(t *testing.T) {
+	a := new(lockedActor)
+
+	// a token is added every 100ms.
+	SetRateLimit(a, RateLimit{PerHour: 36000, Burst: 1})
+	defer SetRateLimit(a, RateLimit{})
+
+	m := NewMonitor("ratelimit-flush", nil, nil, []actions.Actor{a},
+		time.Second, time.Second,
+		Range{Min: 0, Max: 90}, Range{Min: 0, Max: 80})
+
+	m.update([]*probes.Result{{Value: 85}}, nil)
+	m.update([]*probes.Result{{Value: 95}}, nil)
+	m.update([]*probes.Result{{Value: 85}}, nil)
+	if a.count() != 1 {
+		t.Fatal("rate limit is not applied:", a.count())
+	}
+
+	// the last suppressed notification is sent when a token is available.
+	for i := 0; i < 100 && a.count() < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	if len(a.events) != 2 {
+		t.Fatal("suppressed notifications are not flushed:", len(a.events))
+	}
+	e := a.events[1]
+	if e.Severity != actions.SeverityWarning || e.Suppressed != 1 {
+		t.Errorf("unexpected event: %+v", e)
+	}
+}
+
+func TestRecipientRateLimit(t *testing.T) {
+	SetRecipientRateLimit(RateLimit{PerHour: 1, Burst: 1})
+	defer SetRecipientRateLimit(RateLimit{})
+
+	a1 := &recipientActor{recipient: "alarm:ops"}
+	a2 := &recipientActor{recipient: "alarm:ops"}
+	a3 := &recipientActor{recipient: "alarm:dev"}
+	m := NewMonitor("recipient", nil, nil, []actions.Actor{a1, a2, a3},
+		time.Second, time.Second,
+		Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+
+	m.update([]*probes.Result{{Value: 1}}, nil)
+	if len(a1.events) != 1 || len(a2.events) != 0 || len(a3.events) != 1 {
+		t.Error("recipients do not share limits:", len(a1.events), len(a2.events), len(a3.events))
+	}
+}
@@ -1,8 +1,10 @@
 package monitor
 
 import (
-	"github.com/golang/glog"
+	"strings"
 	"sync"
+
+	"github.com/golang/glog"
 )
 
 const (
@@ -16,6 +18,8 @@ var (
 )
 
 // Register registers a monitor.
+//
+// If dependencies of m make a cycle, ErrDependencyCycle is returned.
 func Register(m *Monitor) error {
 	if m.id != uninitializedID {
 		return ErrRegistered
@@ -31,6 +35,11 @@ func Register(m *Monitor) error {
 	registryLock.Lock()
 	defer registryLock.Unlock()
 
+	if cycle := checkCycle(m); cycle != nil {
+		glog.Warningf("monitor: %s has a dependency cycle: %s", m.name, strings.Join(cycle, " -> "))
+		return ErrDependencyCycle
+	}
+
 	m.id = registryIndex
 	registry[registryIndex] = m
 	registryIndex++
@@ -46,8 +55,22 @@ func FindMonitor(id int) *Monitor {
 	return registry[id]
 }
 
+func findMonitorByName(name string) *Monitor {
+	registryLock.Lock()
+	defer registryLock.Unlock()
+
+	for _, m := range registry {
+		if m.name == name {
+			return m
+		}
+	}
+	return nil
+}
+
 // Unregister removes a monitor from the registry.
 // The monitor should have stopped.
+//
+// The persisted state and rate limits of the monitor are also removed.
 func Unregister(m *Monitor) error {
 	if m.id == uninitializedID {
 		return ErrNotRegistered
@@ -58,6 +81,13 @@ func Unregister(m *Monitor) error {
 
 	delete(registry, m.id)
 	m.id = uninitializedID
+	deleteState(m.name)
+
+	m.lock.Lock()
+	for _, a := range m.allActors() {
+		SetRateLimit(a, RateLimit{})
+	}
+	m.lock.Unlock()
 	return nil
 }
 
@@ -0,0 +1,152 @@
+package monitor
+
+import (
+	"time"
+
+	"nightwatch/actions"
+)
+
+// RepeatPolicy defines re-notifications while a monitor is failing.
+type RepeatPolicy struct {
+	// Interval is the interval of re-notifications.
+	// Zero disables re-notifications.
+	Interval time.Duration
+
+	// MaxPerDay limits the number of re-notifications per day for
+	// each series.  Zero means no limit.
+	MaxPerDay int
+
+	// Escalations are steps to notify other actors when a failure
+	// lasts long.  Steps must be ordered by After.
+	Escalations []*Escalation
+}
+
+// Escalation is a step of escalation.
+type Escalation struct {
+	// After is the failure duration to reach this step.
+	After time.Duration
+
+	// Actors are notified when this step is reached.  Since then,
+	// re-notifications are sent to these actors instead of the
+	// actors of the previous step.
+	Actors []actions.Actor
+}
+
+// repeatState tracks re-notifications of a failing series.
+type repeatState struct {
+	lastNotified time.Time
+	day          string
+	repeats      int
+	escalation   int
+}
+
+const dayLayout = "2006-01-02"
+
+// SetRepeatPolicy sets the policy for re-notifications and escalations.
+// This should be called before the monitor starts.
+func (m *Monitor) SetRepeatPolicy(p *RepeatPolicy) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.repeat = p
+}
+
+// allActors returns all actors of the monitor including escalation steps.
+func (m *Monitor) allActors() []actions.Actor {
+	l := append([]actions.Actor(nil), m.actors...)
+	if m.repeat != nil {
+		for _, esc := range m.repeat.Escalations {
+			l = append(l, esc.Actors...)
+		}
+	}
+	return l
+}
+
+// targets returns actors that should know state changes of s,
+// i.e. the actors of the monitor and reached escalation steps.
+//
+// This must be called with m.lock held.
+func (m *Monitor) targets(s *series) []actions.Actor {
+	l := append([]actions.Actor(nil), m.actors...)
+	if m.repeat == nil {
+		return l
+	}
+	for i := 0; i < s.escalation && i < len(m.repeat.Escalations); i++ {
+		l = append(l, m.repeat.Escalations[i].Actors...)
+	}
+	return l
+}
+
+// resetRepeat resets re-notification state when a new failure starts.
+func (s *series) resetRepeat(now time.Time) {
+	s.repeatState = repeatState{lastNotified: now}
+}
+
+// checkRepeat returns notifications for reached escalation steps and
+// re-notifications of a failing series.  Nothing is returned while
+// the failure is acknowledged.
+//
+// This must be called with m.lock held.
+func (m *Monitor) checkRepeat(s *series, now time.Time) []*notification {
+	if m.repeat == nil || s.failedAt == nil || s.unknown {
+		return nil
+	}
+	if m.activeAck(now) != nil {
+		return nil
+	}
+
+	e := &actions.Event{
+		Monitor:  m.name,
+		Labels:   s.labels,
+		Type:     actions.EventRepeat,
+		Severity: s.severity,
+		Previous: s.severity,
+		Value:    s.lastValue,
+		Crit:     m.crit,
+		Warn:     m.warn,
+		FailedAt: *s.failedAt,
+		Duration: now.Sub(*s.failedAt),
+		Time:     now,
+
+		FailNotified: s.failNotified,
+	}
+
+	var l []*notification
+	for s.escalation < len(m.repeat.Escalations) {
+		esc := m.repeat.Escalations[s.escalation]
+		if e.Duration < esc.After {
+			break
+		}
+		s.escalation++
+		ee := *e
+		ee.Escalation = s.escalation
+		l = append(l, &notification{&ee, esc.Actors, false})
+		s.lastNotified = now
+	}
+	if len(l) > 0 {
+		s.failNotified = true
+		return l
+	}
+
+	if m.repeat.Interval == 0 || now.Sub(s.lastNotified) < m.repeat.Interval {
+		return nil
+	}
+	if day := now.Format(dayLayout); day != s.day {
+		s.day = day
+		s.repeats = 0
+	}
+	if m.repeat.MaxPerDay > 0 && s.repeats >= m.repeat.MaxPerDay {
+		return nil
+	}
+	s.repeats++
+	s.lastNotified = now
+
+	actors := m.actors
+	if s.escalation > 0 {
+		actors = m.repeat.Escalations[s.escalation-1].Actors
+	}
+	e.Repeat = s.repeats
+	e.Escalation = s.escalation
+	s.failNotified = true
+	return []*notification{{e, actors, true}}
+}
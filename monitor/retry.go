@@ -0,0 +1,456 @@
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"math/rand"
+	"os"
+	"sync"
+	"time"
+
+	"nightwatch/actions"
+	"nightwatch/state"
+	"nightwatch/util/cmd"
+
+	"github.com/golang/glog"
+)
+
+const (
+	retryQueueKey    = "retry-queue"
+	retryCheckPeriod = time.Second
+
+	// maxDeadDeliveries is the maximum number of dead deliveries
+	// returned by DeadDeliveries.
+	maxDeadDeliveries = 1000
+)
+
+// RetryPolicy configures retries of failed notifications.
+type RetryPolicy struct {
+	// InitialBackoff is the delay before the first retry.
+	// The delay doubles for each retry up to MaxBackoff.
+	InitialBackoff time.Duration
+	MaxBackoff     time.Duration
+
+	// MaxAge is the maximum age of a notification.  Notifications
+	// that cannot be delivered within MaxAge are dead-lettered.
+	MaxAge time.Duration
+
+	// DeadLetterFile is the file to append dead notifications.
+	// If empty, dead notifications are only logged.
+	DeadLetterFile string
+}
+
+// Delivery is a notification that failed to be delivered to an actor.
+//
+// Either Event or Group is set.  Monitor is empty for groups.
+type Delivery struct {
+	ID         int64          `json:"id"`
+	Monitor    string         `json:"monitor"`
+	Receiver   string         `json:"receiver,omitempty"`
+	Actor      string         `json:"actor"`
+	ActorIndex int            `json:"actor_index"`
+	Event      *actions.Event `json:"event,omitempty"`
+	Group      *actions.Group `json:"group,omitempty"`
+	Attempts   int            `json:"attempts"`
+	CreatedAt  time.Time      `json:"created_at"`
+	NextAt     time.Time      `json:"next_at"`
+	LastError  string         `json:"last_error"`
+}
+
+func (d *Delivery) key() string {
+	return d.Monitor + "\x00" + d.Receiver + "\x00" + d.Actor
+}
+
+// Source returns the monitor name, or the receiver name for groups.
+func (d *Delivery) Source() string {
+	if d.Group != nil {
+		return "receiver:" + d.Receiver
+	}
+	return d.Monitor
+}
+
+// EventType returns the type of the event, or "group" for groups.
+func (d *Delivery) EventType() string {
+	if d.Group != nil {
+		return "group"
+	}
+	return d.Event.Type
+}
+
+// call delivers the notification to a.
+func (d *Delivery) call(a actions.Actor) error {
+	if d.Group != nil {
+		return protect(d.Source(), kindAction, func() error {
+			return actions.NotifyGroup(a, d.Group)
+		})
+	}
+	return callActor(a, d.Event)
+}
+
+type retryQueue struct {
+	lock   sync.Mutex
+	policy *RetryPolicy
+	items  []*Delivery
+	nextID int64
+}
+
+var retries *retryQueue
+
+func init() {
+	actions.SetFailedFunc(retryFailed)
+}
+
+type queueSnapshot struct {
+	NextID int64       `json:"next_id"`
+	Items  []*Delivery `json:"items"`
+}
+
+// StartRetrying starts retrying failed notifications with p.
+//
+// Pending notifications saved in the state store are restored.
+// They are retried until MaxAge even if their monitors or receivers
+// are not registered yet.
+// The retry goroutine runs until the global environment is canceled.
+// Without calling this, failed notifications are only logged.
+func StartRetrying(p *RetryPolicy) {
+	q := restoreRetryQueue(p)
+	retries = q
+	cmd.Go(q.run)
+}
+
+// restoreRetryQueue creates a retry queue with notifications saved
+// in the state store.
+func restoreRetryQueue(p *RetryPolicy) *retryQueue {
+	q := &retryQueue{policy: p, nextID: 1}
+	if s := getStateStore(); s != nil {
+		snap := new(queueSnapshot)
+		err := s.Load(retryQueueKey, snap)
+		switch err {
+		case nil:
+			q.items = snap.Items
+			q.nextID = snap.NextID
+			glog.Infof("restored pending notifications, count: %d", len(q.items))
+		case state.ErrNotFound:
+		default:
+			glog.Errorf("failed to load pending notifications, error: %v", err)
+		}
+	}
+	return q
+}
+
+// save persists the queue.  This must be called with q.lock held.
+func (q *retryQueue) save() {
+	s := getStateStore()
+	if s == nil {
+		return
+	}
+	err := s.Save(retryQueueKey, &queueSnapshot{NextID: q.nextID, Items: q.items})
+	if err != nil {
+		glog.Errorf("failed to save pending notifications, error: %v", err)
+	}
+}
+
+// pending returns true if there are pending deliveries for key.
+func (q *retryQueue) pending(key string) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for _, d := range q.items {
+		if d.key() == key {
+			return true
+		}
+	}
+	return false
+}
+
+func (q *retryQueue) backoff(attempts int) time.Duration {
+	b := q.policy.InitialBackoff
+	for i := 1; i < attempts && b < q.policy.MaxBackoff; i++ {
+		b *= 2
+	}
+	if b > q.policy.MaxBackoff {
+		b = q.policy.MaxBackoff
+	}
+	if b <= 0 {
+		return 0
+	}
+
+	// add jitter between 50% and 100% of b.
+	return b/2 + time.Duration(rand.Int63n(int64(b/2)+1))
+}
+
+// add enqueues a failed delivery.
+func (q *retryQueue) add(d *Delivery) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	d.ID = q.nextID
+	q.nextID++
+	d.NextAt = d.CreatedAt.Add(q.backoff(d.Attempts))
+	q.items = append(q.items, d)
+	q.save()
+}
+
+func (q *retryQueue) run(ctx context.Context) error {
+	ticker := time.NewTicker(retryCheckPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		q.retry()
+	}
+}
+
+// due returns the oldest deliveries for each monitor and actor
+// that are ready to be retried.  Later deliveries wait so that
+// notifications are delivered in order.
+func (q *retryQueue) due(now time.Time) []*Delivery {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	seen := make(map[string]bool)
+	var l []*Delivery
+	for _, d := range q.items {
+		if seen[d.key()] {
+			continue
+		}
+		seen[d.key()] = true
+		if !d.NextAt.After(now) {
+			l = append(l, d)
+		}
+	}
+	return l
+}
+
+func (q *retryQueue) retry() {
+	now := time.Now()
+	for _, d := range q.due(now) {
+		// the actor may be registered later, e.g. after restart.
+		a := findActor(d)
+		var err error
+		if a == nil {
+			err = errActorNotFound
+		} else {
+			err = d.call(a)
+		}
+
+		q.lock.Lock()
+		switch {
+		case err == nil:
+			q.remove(d)
+			glog.Infof("notification delivered, monitor: %s, action: %s, event: %s, attempts: %d", d.Source(), d.Actor, d.EventType(), d.Attempts+1)
+		case now.Sub(d.CreatedAt) >= q.policy.MaxAge:
+			d.Attempts++
+			d.LastError = err.Error()
+			q.remove(d)
+			q.deadLetter(d)
+		default:
+			d.Attempts++
+			d.LastError = err.Error()
+			d.NextAt = now.Add(q.backoff(d.Attempts))
+		}
+		q.save()
+		q.lock.Unlock()
+	}
+}
+
+// remove removes d.  This must be called with q.lock held.
+func (q *retryQueue) remove(d *Delivery) {
+	for i, t := range q.items {
+		if t == d {
+			q.items = append(q.items[:i], q.items[i+1:]...)
+			return
+		}
+	}
+}
+
+// deadLetter records d as dead.  This must be called with q.lock held.
+func (q *retryQueue) deadLetter(d *Delivery) {
+	glog.Errorf("notification is dead, monitor: %s, action: %s, event: %s, attempts: %d, error: %s", d.Source(), d.Actor, d.EventType(), d.Attempts, d.LastError)
+
+	if len(q.policy.DeadLetterFile) == 0 {
+		return
+	}
+	data, err := json.Marshal(d)
+	if err != nil {
+		glog.Errorf("failed to encode dead notification, error: %v", err)
+		return
+	}
+	f, err := os.OpenFile(q.policy.DeadLetterFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		glog.Errorf("failed to open dead letter file, error: %v", err)
+		return
+	}
+	defer f.Close()
+	if _, err := f.Write(append(data, '\n')); err != nil {
+		glog.Errorf("failed to write dead letter file, error: %v", err)
+	}
+}
+
+// retryFailed queues a notification that a failed to deliver after
+// accepting it, e.g. in a digest.  The age of the notification is
+// counted from the time of the event or the group.
+func retryFailed(a actions.Actor, e *actions.Event, g *actions.Group, err error) {
+	d := &Delivery{
+		Actor:      a.String(),
+		ActorIndex: -1,
+		Event:      e,
+		Group:      g,
+		Attempts:   1,
+		LastError:  err.Error(),
+	}
+	if g != nil {
+		d.Receiver = g.Receiver
+		d.CreatedAt = g.Time()
+	} else {
+		d.Monitor = e.Monitor
+		d.CreatedAt = e.Time
+	}
+	d.locate(a)
+
+	dispatchErrors.With(d.Source()).Inc()
+	glog.Errorf("failed to notify actor, monitor: %s, receiver: %s, action: %s, event: %s, error: %v", d.Source(), d.Receiver, d.Actor, d.EventType(), err)
+
+	q := retries
+	if q == nil {
+		return
+	}
+	if time.Since(d.CreatedAt) >= q.policy.MaxAge {
+		q.lock.Lock()
+		q.deadLetter(d)
+		q.lock.Unlock()
+		return
+	}
+	q.add(d)
+}
+
+// locate sets the receiver and the index of a for d.
+// If a is not found, d.ActorIndex is left as is.
+func (d *Delivery) locate(a actions.Actor) {
+	if d.Group == nil {
+		if m := findMonitorByName(d.Monitor); m != nil {
+			m.lock.Lock()
+			i := actorIndex(m.allActors(), a)
+			m.lock.Unlock()
+			if i >= 0 {
+				d.ActorIndex = i
+				return
+			}
+		}
+	}
+
+	r := getRouter()
+	if r == nil {
+		return
+	}
+	for _, rc := range r.receivers {
+		if len(d.Receiver) > 0 && rc.Name != d.Receiver {
+			continue
+		}
+		if i := actorIndex(rc.Actors, a); i >= 0 {
+			d.Receiver = rc.Name
+			d.ActorIndex = i
+			return
+		}
+	}
+}
+
+// flushActors calls Flush of actors that implement actions.Flusher.
+func flushActors(name string, l []actions.Actor) {
+	for _, a := range l {
+		f, ok := a.(actions.Flusher)
+		if !ok {
+			continue
+		}
+		protect(name, kindAction, func() error {
+			f.Flush()
+			return nil
+		})
+	}
+}
+
+// findActor looks up the actor of d from registered monitors
+// or receivers of the router.
+func findActor(d *Delivery) actions.Actor {
+	if len(d.Receiver) > 0 {
+		r := getRouter()
+		if r == nil {
+			return nil
+		}
+		return r.findActor(d)
+	}
+
+	m := findMonitorByName(d.Monitor)
+	if m == nil {
+		return nil
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	l := m.allActors()
+	if d.ActorIndex < 0 || d.ActorIndex >= len(l) {
+		return nil
+	}
+	a := l[d.ActorIndex]
+	if a.String() != d.Actor {
+		// the configuration has changed.
+		return nil
+	}
+	return a
+}
+
+// PendingDeliveries returns notifications waiting for retries.
+func PendingDeliveries() []*Delivery {
+	q := retries
+	if q == nil {
+		return nil
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	l := make([]*Delivery, len(q.items))
+	for i, d := range q.items {
+		t := *d
+		l[i] = &t
+	}
+	return l
+}
+
+// DeadDeliveries returns the latest notifications in the dead letter file.
+func DeadDeliveries() ([]*Delivery, error) {
+	q := retries
+	if q == nil || len(q.policy.DeadLetterFile) == 0 {
+		return nil, nil
+	}
+
+	f, err := os.Open(q.policy.DeadLetterFile)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var l []*Delivery
+	sc := bufio.NewScanner(f)
+	sc.Buffer(nil, 1<<20)
+	for sc.Scan() {
+		d := new(Delivery)
+		if err := json.Unmarshal(sc.Bytes(), d); err != nil {
+			continue
+		}
+		l = append(l, d)
+		if len(l) > maxDeadDeliveries {
+			l = l[1:]
+		}
+	}
+	return l, sc.Err()
+}
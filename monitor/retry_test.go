@@ -0,0 +1,165 @@
+package monitor
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"nightwatch/actions"
+	"nightwatch/probes"
+	"nightwatch/state"
+)
+
+type flakyActor struct {
+	testActor
+	fails int
+}
+
+func (a *flakyActor) Notify(e *actions.Event) error {
+	if a.fails > 0 {
+		a.fails--
+		return errors.New("unavailable")
+	}
+	return a.testActor.Notify(e)
+}
+
+func TestRetry(t *testing.T) {
+	a := &flakyActor{fails: 2}
+	m := NewMonitor("retry", nil, nil, []actions.Actor{a},
+		time.Second, time.Second,
+		Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+	if err := Register(m); err != nil {
+		t.Fatal(err)
+	}
+	defer Unregister(m)
+
+	retries = &retryQueue{
+		policy: &RetryPolicy{MaxAge: time.Hour},
+		nextID: 1,
+	}
+	defer func() {
+		retries = nil
+	}()
+
+	m.update([]*probes.Result{{Value: 1}}, nil)
+	m.update([]*probes.Result{{Value: 0}}, nil)
+
+	// fail is queued after the first attempt, and recover waits behind it.
+	if l := PendingDeliveries(); len(l) != 2 {
+		t.Fatalf("unexpected number of pending deliveries: %d", len(l))
+	}
+
+	retries.retry()
+	if len(PendingDeliveries()) != 2 {
+		t.Error(`the second attempt should fail`)
+	}
+	retries.retry()
+	retries.retry()
+	if len(PendingDeliveries()) != 0 {
+		t.Error(`deliveries should have been completed`)
+	}
+	if len(a.events) != 2 || a.events[0].Type != actions.EventFail || a.events[1].Type != actions.EventRecover {
+		t.Error(`events are not delivered in order`)
+	}
+}
+
+func TestRetryRestored(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nightwatch-retry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := state.NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	SetStateStore(s)
+	defer SetStateStore(nil)
+
+	a := new(testActor)
+	d := &Delivery{
+		ID:         1,
+		Monitor:    "restored",
+		Actor:      a.String(),
+		ActorIndex: 0,
+		Event:      &actions.Event{Monitor: "restored", Type: actions.EventFail},
+		Attempts:   1,
+		CreatedAt:  time.Now(),
+	}
+	err = s.Save(retryQueueKey, &queueSnapshot{NextID: 2, Items: []*Delivery{d}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := restoreRetryQueue(&RetryPolicy{MaxAge: time.Hour})
+	retries = q
+	defer func() {
+		retries = nil
+	}()
+
+	// the monitor is not registered yet.
+	q.retry()
+	l := PendingDeliveries()
+	if len(l) != 1 {
+		t.Fatal("restored delivery is dead-lettered before the monitor is registered")
+	}
+
+	m := NewMonitor("restored", nil, nil, []actions.Actor{a},
+		time.Second, time.Second,
+		Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+	if err := Register(m); err != nil {
+		t.Fatal(err)
+	}
+	defer Unregister(m)
+
+	q.lock.Lock()
+	q.items[0].NextAt = time.Now()
+	q.lock.Unlock()
+	q.retry()
+	if len(PendingDeliveries()) != 0 || len(a.events) != 1 {
+		t.Error("restored delivery is not delivered", len(PendingDeliveries()), len(a.events))
+	}
+}
+
+func TestRetryFailed(t *testing.T) {
+	a := new(testActor)
+	m := NewMonitor("retry-failed", nil, nil, []actions.Actor{a},
+		time.Second, time.Second,
+		Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+	if err := Register(m); err != nil {
+		t.Fatal(err)
+	}
+	defer Unregister(m)
+
+	retries = &retryQueue{
+		policy: &RetryPolicy{MaxAge: time.Hour},
+		nextID: 1,
+	}
+	defer func() {
+		retries = nil
+	}()
+
+	unavailable := errors.New("unavailable")
+	e := &actions.Event{Monitor: "retry-failed", Type: actions.EventFail, Time: time.Now()}
+	actions.Failed(a, e, nil, unavailable)
+
+	// too old notifications are dead.
+	old := &actions.Event{Monitor: "retry-failed", Type: actions.EventFail, Time: time.Now().Add(-2 * time.Hour)}
+	actions.Failed(a, old, nil, unavailable)
+
+	l := PendingDeliveries()
+	if len(l) != 1 {
+		t.Fatalf("unexpected number of pending deliveries: %d", len(l))
+	}
+	if l[0].Monitor != "retry-failed" || l[0].ActorIndex != 0 || l[0].LastError != "unavailable" {
+		t.Errorf("unexpected delivery: %+v", l[0])
+	}
+
+	retries.retry()
+	if len(PendingDeliveries()) != 0 || len(a.events) != 1 {
+		t.Error("failed notification is not retried")
+	}
+}
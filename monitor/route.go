@@ -0,0 +1,345 @@
+package monitor
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"nightwatch/actions"
+
+	"github.com/golang/glog"
+)
+
+// Routing labels added to the labels of monitors and series.
+const (
+	RouteLabelMonitor  = "monitor"
+	RouteLabelSeverity = "severity"
+)
+
+// Route is a node of the routing tree.
+//
+// An event matches a route if its routing labels match all of Match
+// and MatchRE.  Routing labels are the labels of the monitor and the
+// series plus RouteLabelMonitor and RouteLabelSeverity.  Recovery
+// events are routed with the severity they recovered from.
+//
+// A matching event is passed to the child routes in order.  The
+// first matching child takes the event unless its Continue is true.
+// If no child matches, the event is sent to the receiver of the route.
+type Route struct {
+	Receiver string
+	Match    map[string]string
+	MatchRE  map[string]*regexp.Regexp
+
+	// GroupBy lists labels to group events.  Events of a group are
+	// buffered for GroupWait before being sent together.
+	GroupBy   []string
+	GroupWait time.Duration
+
+	Continue bool
+	Routes   []*Route
+}
+
+// Receiver is a named set of actors shared by routes.
+type Receiver struct {
+	Name   string
+	Actors []actions.Actor
+}
+
+// Router routes events emitted by monitors to receivers.
+type Router struct {
+	root      *Route
+	receivers map[string]*Receiver
+
+	lock   sync.Mutex
+	groups map[string]*routeGroup
+}
+
+// routeGroup is a group of events waiting to be sent.
+type routeGroup struct {
+	key      string
+	route    *Route
+	receiver *Receiver
+	labels   map[string]string
+	events   []*actions.Event
+	timer    *time.Timer
+}
+
+var (
+	routerLock = new(sync.Mutex)
+	router     *Router
+)
+
+// NewRouter creates a router from a routing tree and receivers.
+// Every route must refer to one of receivers.
+func NewRouter(root *Route, receivers []*Receiver) (*Router, error) {
+	r := &Router{
+		root:      root,
+		receivers: make(map[string]*Receiver),
+		groups:    make(map[string]*routeGroup),
+	}
+	for _, rc := range receivers {
+		if _, ok := r.receivers[rc.Name]; ok {
+			return nil, fmt.Errorf("%v: duplicate receiver %s", ErrInvalidRoute, rc.Name)
+		}
+		r.receivers[rc.Name] = rc
+	}
+	if err := r.check(root); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (r *Router) check(rt *Route) error {
+	if _, ok := r.receivers[rt.Receiver]; !ok {
+		return fmt.Errorf("%v: unknown receiver %q", ErrInvalidRoute, rt.Receiver)
+	}
+	for _, c := range rt.Routes {
+		if err := r.check(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// SetRouter initializes actors of receivers, then routes events of
+// all monitors with r.  nil disables routing.
+func SetRouter(r *Router) error {
+	if r != nil {
+		for _, rc := range r.receivers {
+			for _, a := range rc.Actors {
+				err := protect(rc.Name, kindAction, func() error {
+					return a.Init(rc.Name)
+				})
+				if err != nil {
+					return fmt.Errorf("receiver %s: %v in %s", rc.Name, err, a.String())
+				}
+			}
+		}
+	}
+
+	routerLock.Lock()
+	router = r
+	routerLock.Unlock()
+	return nil
+}
+
+func getRouter() *Router {
+	routerLock.Lock()
+	defer routerLock.Unlock()
+
+	return router
+}
+
+// matches returns true if labels match the matchers of rt.
+func (rt *Route) matches(labels map[string]string) bool {
+	for k, v := range rt.Match {
+		if labels[k] != v {
+			return false
+		}
+	}
+	for k, re := range rt.MatchRE {
+		if !re.MatchString(labels[k]) {
+			return false
+		}
+	}
+	return true
+}
+
+// find returns routes that take an event with labels.
+func (rt *Route) find(labels map[string]string) []*Route {
+	if !rt.matches(labels) {
+		return nil
+	}
+	var l []*Route
+	for _, c := range rt.Routes {
+		found := c.find(labels)
+		l = append(l, found...)
+		if len(found) > 0 && !c.Continue {
+			break
+		}
+	}
+	if len(l) == 0 {
+		l = []*Route{rt}
+	}
+	return l
+}
+
+// Match returns routes that take an event with routing labels.
+func (r *Router) Match(labels map[string]string) []*Route {
+	return r.root.find(labels)
+}
+
+// routeLabels returns routing labels of e.
+//
+// This must be called with m.lock held.
+func (m *Monitor) routeLabels(e *actions.Event) map[string]string {
+	labels := make(map[string]string)
+	for k, v := range m.labels {
+		labels[k] = v
+	}
+	for k, v := range e.Labels {
+		labels[k] = v
+	}
+	labels[RouteLabelMonitor] = m.name
+	sev := e.Severity
+	if e.Type == actions.EventRecover {
+		sev = e.Previous
+	}
+	labels[RouteLabelSeverity] = string(sev)
+	return labels
+}
+
+// route sends e to the receivers of matching routes.
+func (r *Router) route(e *actions.Event, labels map[string]string) {
+	for _, rt := range r.Match(labels) {
+		rc := r.receivers[rt.Receiver]
+		if rt.GroupWait == 0 {
+			r.send(rc, e)
+			continue
+		}
+
+		key := groupKey(rt, labels)
+		r.lock.Lock()
+		g, ok := r.groups[key]
+		if !ok {
+			g = &routeGroup{
+				key:      key,
+				route:    rt,
+				receiver: rc,
+				labels:   groupLabels(rt, labels),
+			}
+			g.timer = time.AfterFunc(rt.GroupWait, func() {
+				r.flushGroup(key)
+			})
+			r.groups[key] = g
+		}
+		g.events = append(g.events, e)
+		r.lock.Unlock()
+	}
+}
+
+func groupLabels(rt *Route, labels map[string]string) map[string]string {
+	l := make(map[string]string)
+	for _, k := range rt.GroupBy {
+		l[k] = labels[k]
+	}
+	return l
+}
+
+func groupKey(rt *Route, labels map[string]string) string {
+	keys := append([]string(nil), rt.GroupBy...)
+	sort.Strings(keys)
+	l := make([]string, 0, len(keys))
+	for _, k := range keys {
+		l = append(l, k+"="+labels[k])
+	}
+	return fmt.Sprintf("%p/%s", rt, strings.Join(l, ","))
+}
+
+// flushGroup sends events of the group for key.
+func (r *Router) flushGroup(key string) {
+	r.lock.Lock()
+	g, ok := r.groups[key]
+	if ok {
+		delete(r.groups, key)
+	}
+	r.lock.Unlock()
+
+	if ok {
+		r.sendGroup(g)
+	}
+}
+
+// sendGroup sends events of g.  Actors implementing
+// actions.GroupNotifier receive them as one notification.
+func (r *Router) sendGroup(g *routeGroup) {
+	glog.Infof("route group flushed, receiver: %s, group: %s, events: %d", g.receiver.Name, actions.FormatLabels(g.labels), len(g.events))
+	if len(g.events) == 1 {
+		r.send(g.receiver, g.events[0])
+		return
+	}
+
+	group := &actions.Group{
+		Receiver: g.receiver.Name,
+		Labels:   g.labels,
+		Events:   g.events,
+	}
+	for i, a := range g.receiver.Actors {
+		if _, ok := a.(actions.GroupNotifier); !ok {
+			for _, e := range g.events {
+				r.sendTo(g.receiver, i, a, e)
+			}
+			continue
+		}
+		deliver(&Delivery{
+			Receiver:   g.receiver.Name,
+			Actor:      a.String(),
+			ActorIndex: i,
+			Group:      group,
+			CreatedAt:  time.Now(),
+		}, a)
+	}
+}
+
+// send delivers e to actors of rc.
+func (r *Router) send(rc *Receiver, e *actions.Event) {
+	for i, a := range rc.Actors {
+		r.sendTo(rc, i, a, e)
+	}
+}
+
+// sendTo delivers e to a, the i-th actor of rc.
+func (r *Router) sendTo(rc *Receiver, i int, a actions.Actor, e *actions.Event) {
+	deliver(&Delivery{
+		Monitor:    e.Monitor,
+		Receiver:   rc.Name,
+		Actor:      a.String(),
+		ActorIndex: i,
+		Event:      e,
+		CreatedAt:  time.Now(),
+	}, a)
+}
+
+// Flush sends all buffered events immediately, then flushes
+// notifications held by actors of receivers.
+// This should be called before the program exits.
+func (r *Router) Flush() {
+	r.lock.Lock()
+	groups := r.groups
+	r.groups = make(map[string]*routeGroup)
+	r.lock.Unlock()
+
+	for _, g := range groups {
+		g.timer.Stop()
+		r.sendGroup(g)
+	}
+	for _, rc := range r.receivers {
+		flushActors(rc.Name, rc.Actors)
+	}
+}
+
+// actors returns actors of all receivers.
+func (r *Router) actors() []actions.Actor {
+	var l []actions.Actor
+	for _, rc := range r.receivers {
+		l = append(l, rc.Actors...)
+	}
+	return l
+}
+
+// findActor looks up the actor of d from receivers.
+func (r *Router) findActor(d *Delivery) actions.Actor {
+	rc, ok := r.receivers[d.Receiver]
+	if !ok || d.ActorIndex < 0 || d.ActorIndex >= len(rc.Actors) {
+		return nil
+	}
+	a := rc.Actors[d.ActorIndex]
+	if a.String() != d.Actor {
+		return nil
+	}
+	return a
+}
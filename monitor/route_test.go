@@ -0,0 +1,169 @@
+package monitor
+
+import (
+	"regexp"
+	"sync"
+	"testing"
+	"time"
+
+	"nightwatch/actions"
+	"nightwatch/probes"
+)
+
+type lockedActor struct {
+	testActor
+	lock sync.Mutex
+}
+
+func (a *lockedActor) Notify(e *actions.Event) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return a.testActor.Notify(e)
+}
+
+func (a *lockedActor) count() int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	return len(a.events)
+}
+
+func TestRouter(t *testing.T) {
+	ops := new(lockedActor)
+	db := new(lockedActor)
+	pager := new(lockedActor)
+
+	root := &Route{
+		Receiver: "ops",
+		Routes: []*Route{
+			{
+				Receiver: "pager",
+				Match:    map[string]string{RouteLabelSeverity: "critical"},
+				Continue: true,
+			},
+			{
+				Receiver:  "db",
+				MatchRE:   map[string]*regexp.Regexp{RouteLabelMonitor: regexp.MustCompile("^(?:db-.*)$")},
+				GroupBy:   []string{"host"},
+				GroupWait: 50 * time.Millisecond,
+			},
+		},
+	}
+	r, err := NewRouter(root, []*Receiver{
+		{Name: "ops", Actors: []actions.Actor{ops}},
+		{Name: "db", Actors: []actions.Actor{db}},
+		{Name: "pager", Actors: []actions.Actor{pager}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetRouter(r); err != nil {
+		t.Fatal(err)
+	}
+	defer SetRouter(nil)
+
+	newMonitor := func(name string) *Monitor {
+		m := NewMonitor(name, nil, nil, nil,
+			time.Second, time.Second,
+			Range{Min: 0, Max: 90}, Range{Min: 0, Max: 80})
+		m.SetLabels(map[string]string{"host": "host1"})
+		return m
+	}
+	web := newMonitor("web")
+	db1 := newMonitor("db-1")
+	db2 := newMonitor("db-2")
+
+	// warning of web goes to the root receiver.
+	web.update([]*probes.Result{{Value: 85}}, nil)
+	if ops.count() != 1 || pager.count() != 0 {
+		t.Fatal("warning is not routed to ops", ops.count(), pager.count())
+	}
+
+	// critical goes to pager, then continues to db.
+	db1.update([]*probes.Result{{Value: 100}}, nil)
+	db2.update([]*probes.Result{{Value: 85}}, nil)
+	if pager.count() != 1 {
+		t.Error("critical is not routed to pager", pager.count())
+	}
+	if db.count() != 0 {
+		t.Error("events are not grouped", db.count())
+	}
+	time.Sleep(100 * time.Millisecond)
+	if db.count() != 2 {
+		t.Error("group is not flushed", db.count())
+	}
+	if ops.count() != 1 {
+		t.Error("db events are routed to ops", ops.count())
+	}
+
+	// recovery is routed with the severity it recovered from.
+	db1.update([]*probes.Result{{Value: 10}}, nil)
+	if pager.count() != 2 {
+		t.Error("recovery is not routed to pager", pager.count())
+	}
+	r.Flush()
+	if db.count() != 3 {
+		t.Error("Flush does not send buffered events", db.count())
+	}
+
+	if _, err := NewRouter(&Route{Receiver: "none"}, nil); err == nil {
+		t.Error("unknown receiver must be rejected")
+	}
+}
+
+type groupActor struct {
+	lockedActor
+	groups []*actions.Group
+}
+
+func (a *groupActor) NotifyGroup(g *actions.Group) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+	a.groups = append(a.groups, g)
+	return nil
+}
+
+func TestRouteGroup(t *testing.T) {
+	grouped := new(groupActor)
+	single := new(lockedActor)
+
+	root := &Route{
+		Receiver:  "ops",
+		GroupBy:   []string{"host"},
+		GroupWait: time.Hour,
+	}
+	r, err := NewRouter(root, []*Receiver{
+		{Name: "ops", Actors: []actions.Actor{grouped, single}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SetRouter(r); err != nil {
+		t.Fatal(err)
+	}
+	defer SetRouter(nil)
+
+	for _, host := range []string{"host1", "host1", "host1", "host2"} {
+		m := NewMonitor("ping-"+host, nil, nil, nil,
+			time.Second, time.Second,
+			Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+		m.SetLabels(map[string]string{"host": host})
+		m.update([]*probes.Result{{Value: 1}}, nil)
+	}
+	r.Flush()
+
+	grouped.lock.Lock()
+	defer grouped.lock.Unlock()
+	if len(grouped.groups) != 1 {
+		t.Fatal("unexpected number of groups:", len(grouped.groups))
+	}
+	g := grouped.groups[0]
+	if len(g.Events) != 3 || g.Labels["host"] != "host1" || g.Receiver != "ops" {
+		t.Errorf("unexpected group: %+v", g)
+	}
+	if len(grouped.events) != 1 {
+		t.Error("a single event should not be grouped:", len(grouped.events))
+	}
+	if single.count() != 4 {
+		t.Error("events are not delivered one by one:", single.count())
+	}
+}
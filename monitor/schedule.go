@@ -0,0 +1,150 @@
+package monitor
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"nightwatch/schedule"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// statusInactive is the status outside active windows.
+	statusInactive = "inactive"
+
+	// maxScheduleWait is used when a schedule never matches again.
+	maxScheduleWait = 24 * time.Hour
+)
+
+// IntervalPolicy adjusts intervals between probes.
+type IntervalPolicy struct {
+	// StartJitter is the maximum random delay before the first probe
+	// so that monitors started together do not probe at the same time.
+	// This is not used for scheduled monitors.
+	StartJitter time.Duration
+
+	// RetryInterval is the interval while the monitor is failing or
+	// unknown.  Zero means the normal interval.
+	RetryInterval time.Duration
+
+	// MaxBackoff enables backoff while the monitor is failing or
+	// unknown.  The interval doubles after each failing probe up to
+	// MaxBackoff.
+	MaxBackoff time.Duration
+}
+
+// SetIntervalPolicy sets the policy to adjust intervals.
+// This should be called before the monitor starts.
+func (m *Monitor) SetIntervalPolicy(p *IntervalPolicy) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.intervals = p
+}
+
+// startDelay waits for a random delay up to StartJitter.
+// It returns false if ctx is canceled.
+func (m *Monitor) startDelay(ctx context.Context) bool {
+	m.lock.Lock()
+	p := m.intervals
+	scheduled := m.cron != nil
+	m.lock.Unlock()
+
+	if p == nil || p.StartJitter <= 0 || scheduled {
+		return true
+	}
+	d := time.Duration(rand.Int63n(int64(p.StartJitter)))
+	select {
+	case <-ctx.Done():
+		return false
+	case <-time.After(d):
+		return true
+	}
+}
+
+// SetSchedule makes the monitor probe at times matching c instead
+// of every interval.
+// This should be called before the monitor starts.
+func (m *Monitor) SetSchedule(c *schedule.Cron) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.cron = c
+}
+
+// SetActiveWindows limits probes to ws.  Outside the windows, the
+// monitor does not probe and its status is "inactive".
+// This should be called before the monitor starts.
+func (m *Monitor) SetActiveWindows(ws []*schedule.Window) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.windows = ws
+}
+
+// untilNext returns the duration to wait for the next probe.
+//
+// This must be called with m.lock held.
+func (m *Monitor) untilNext(now time.Time) time.Duration {
+	if m.cron == nil {
+		return m.currentInterval()
+	}
+	next := m.cron.Next(now)
+	if next.IsZero() {
+		return maxScheduleWait
+	}
+	return next.Sub(now)
+}
+
+// currentInterval returns the interval by the interval policy
+// and consecutive failing probes.
+//
+// This must be called with m.lock held.
+func (m *Monitor) currentInterval() time.Duration {
+	p := m.intervals
+	if p == nil || m.failStreak == 0 {
+		return m.interval
+	}
+
+	d := m.interval
+	if p.RetryInterval > 0 {
+		d = p.RetryInterval
+	}
+	if p.MaxBackoff <= 0 {
+		return d
+	}
+	for i := 1; i < m.failStreak && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+	return d
+}
+
+// active returns true if now is within one of active windows.
+//
+// This must be called with m.lock held.
+func (m *Monitor) active(now time.Time) bool {
+	if len(m.windows) == 0 {
+		return true
+	}
+	for _, w := range m.windows {
+		if w.Active(now) {
+			return true
+		}
+	}
+	return false
+}
+
+// deactivate sets the status to inactive.
+//
+// This must be called with m.lock held.
+func (m *Monitor) deactivate() {
+	if m.status != statusInactive {
+		glog.Infof("monitor is inactive, monitor: %s", m.name)
+	}
+	m.status = statusInactive
+}
@@ -0,0 +1,97 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"nightwatch/actions"
+	"nightwatch/probes"
+	"nightwatch/schedule"
+)
+
+func TestActiveWindows(t *testing.T) {
+	a := new(testActor)
+	p := &testProbe{v: 1}
+	m := NewMonitor("windows", p, nil, []actions.Actor{a},
+		10*time.Millisecond, time.Second,
+		Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+
+	now := time.Now()
+	w, err := schedule.NewWindow("0 0 1 1 *", time.Minute, time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if w.Active(now) {
+		t.Skip("the window happens to be active")
+	}
+	m.SetActiveWindows([]*schedule.Window{w})
+
+	if err := m.Start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond)
+	status := m.Status()
+	times := m.Times()
+	m.Stop()
+
+	if status != "inactive" {
+		t.Error("unexpected status:", status)
+	}
+	if times != 0 || len(a.events) != 0 {
+		t.Error("probed outside windows:", times, len(a.events))
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	m := NewMonitor("schedule", nil, nil, nil,
+		time.Minute, time.Second,
+		Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+
+	c, err := schedule.ParseInLocation("5 2 * * *", time.UTC)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m.SetSchedule(c)
+
+	now := time.Date(2020, 1, 1, 2, 4, 30, 0, time.UTC)
+	if d := m.untilNext(now); d != 30*time.Second {
+		t.Error("unexpected wait:", d)
+	}
+	now = time.Date(2020, 1, 1, 2, 5, 0, 0, time.UTC)
+	if d := m.untilNext(now); d != 24*time.Hour {
+		t.Error("unexpected wait:", d)
+	}
+}
+
+func TestIntervalPolicy(t *testing.T) {
+	m := NewMonitor("intervals", nil, nil, nil,
+		time.Minute, time.Second,
+		Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+	m.SetIntervalPolicy(&IntervalPolicy{
+		RetryInterval: 10 * time.Second,
+		MaxBackoff:    time.Minute,
+	})
+
+	expected := []time.Duration{
+		10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute,
+	}
+	for i, d := range expected {
+		m.update([]*probes.Result{{Value: 1}}, nil)
+		if actual := m.untilNext(time.Now()); actual != d {
+			t.Errorf("unexpected interval #%d: %v", i, actual)
+		}
+	}
+
+	m.update([]*probes.Result{{Value: 0}}, nil)
+	if d := m.untilNext(time.Now()); d != time.Minute {
+		t.Error("interval is not reset by recovery:", d)
+	}
+
+	m.SetIntervalPolicy(&IntervalPolicy{RetryInterval: 5 * time.Second})
+	for i := 0; i < 3; i++ {
+		m.update([]*probes.Result{{Value: 1}}, nil)
+		if d := m.untilNext(time.Now()); d != 5*time.Second {
+			t.Error("unexpected retry interval:", d)
+		}
+	}
+}
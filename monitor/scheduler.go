@@ -0,0 +1,268 @@
+package monitor
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"nightwatch/metrics"
+
+	"github.com/golang/glog"
+)
+
+// schedulerAll is the type label for the global limit in metrics.
+const schedulerAll = "all"
+
+var (
+	probeSlotsLimit = metrics.NewGaugeVec(
+		"nightwatch_probe_slots_limit",
+		"Maximum number of concurrent probes (0 means no limit).",
+		"type")
+	probeSlotsRunning = metrics.NewGaugeVec(
+		"nightwatch_probe_slots_running",
+		"Number of probes running.",
+		"type")
+	probeSlotsWaiting = metrics.NewGaugeVec(
+		"nightwatch_probe_slots_waiting",
+		"Number of probes waiting for a slot.",
+		"type")
+	probeQueueSeconds = metrics.NewHistogramVec(
+		"nightwatch_probe_queue_seconds",
+		"Time probes waited for a slot.",
+		metrics.DefaultBuckets, "type")
+	probeSkipped = metrics.NewCounterVec(
+		"nightwatch_probe_skipped_total",
+		"Number of probes skipped because no slot was available until the next probe.",
+		"monitor")
+)
+
+// Scheduler limits the number of probes running at once.
+//
+// Probes waiting for a slot are started in the order of priority,
+// then in the order they started waiting.  A probe that cannot run
+// because of the limit of its type does not block probes of other
+// types.
+type Scheduler struct {
+	limit      int
+	typeLimits map[string]int
+
+	lock        sync.Mutex
+	running     int
+	typeRunning map[string]int
+	waiters     []*slotWaiter
+	seq         uint64
+}
+
+// slotWaiter is a probe waiting for a slot.
+type slotWaiter struct {
+	typ      string
+	priority int
+	seq      uint64
+	ready    chan struct{}
+	granted  bool
+}
+
+// NewScheduler creates a scheduler.
+//
+// limit is the maximum number of probes running at once, and
+// typeLimits are the maximums for each probe type.  Zero means
+// no limit.
+func NewScheduler(limit int, typeLimits map[string]int) *Scheduler {
+	s := &Scheduler{
+		limit:       limit,
+		typeLimits:  make(map[string]int),
+		typeRunning: make(map[string]int),
+	}
+	probeSlotsLimit.With(schedulerAll).Set(float64(limit))
+	for t, n := range typeLimits {
+		s.typeLimits[t] = n
+		probeSlotsLimit.With(t).Set(float64(n))
+	}
+	return s
+}
+
+var (
+	schedulerLock = new(sync.Mutex)
+	scheduler     *Scheduler
+)
+
+// SetScheduler makes all monitors run probes through s.
+// nil removes the limits.
+func SetScheduler(s *Scheduler) {
+	schedulerLock.Lock()
+	defer schedulerLock.Unlock()
+
+	scheduler = s
+}
+
+func getScheduler() *Scheduler {
+	schedulerLock.Lock()
+	defer schedulerLock.Unlock()
+
+	return scheduler
+}
+
+// fits returns true if a probe of typ can start now.
+//
+// This must be called with s.lock held.
+func (s *Scheduler) fits(typ string) bool {
+	if s.limit > 0 && s.running >= s.limit {
+		return false
+	}
+	if n := s.typeLimits[typ]; n > 0 && s.typeRunning[typ] >= n {
+		return false
+	}
+	return true
+}
+
+// take counts a probe of typ as running.
+//
+// This must be called with s.lock held.
+func (s *Scheduler) take(typ string) {
+	s.running++
+	s.typeRunning[typ]++
+	probeSlotsRunning.With(schedulerAll).Inc()
+	probeSlotsRunning.With(typ).Inc()
+}
+
+// grant starts waiting probes as long as slots are available.
+//
+// This must be called with s.lock held.
+func (s *Scheduler) grant() {
+	l := s.waiters[:0]
+	for _, w := range s.waiters {
+		if !s.fits(w.typ) {
+			l = append(l, w)
+			continue
+		}
+		s.take(w.typ)
+		w.granted = true
+		close(w.ready)
+		probeSlotsWaiting.With(schedulerAll).Dec()
+		probeSlotsWaiting.With(w.typ).Dec()
+	}
+	s.waiters = l
+}
+
+// acquire waits for a slot for a probe of typ.  If ctx is done
+// before a slot is available, ctx.Err() is returned.
+func (s *Scheduler) acquire(ctx context.Context, typ string, priority int) error {
+	s.lock.Lock()
+	if len(s.waiters) == 0 && s.fits(typ) {
+		s.take(typ)
+		s.lock.Unlock()
+		probeQueueSeconds.With(typ).Observe(0)
+		return nil
+	}
+
+	s.seq++
+	w := &slotWaiter{
+		typ:      typ,
+		priority: priority,
+		seq:      s.seq,
+		ready:    make(chan struct{}),
+	}
+	s.waiters = append(s.waiters, w)
+	sort.SliceStable(s.waiters, func(i, j int) bool {
+		if s.waiters[i].priority != s.waiters[j].priority {
+			return s.waiters[i].priority > s.waiters[j].priority
+		}
+		return s.waiters[i].seq < s.waiters[j].seq
+	})
+	probeSlotsWaiting.With(schedulerAll).Inc()
+	probeSlotsWaiting.With(typ).Inc()
+	s.grant()
+	s.lock.Unlock()
+
+	st := time.Now()
+	select {
+	case <-w.ready:
+		probeQueueSeconds.With(typ).Observe(time.Since(st).Seconds())
+		return nil
+	case <-ctx.Done():
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if w.granted {
+		// granted just after ctx was done.
+		s.releaseLocked(typ)
+		return ctx.Err()
+	}
+	for i, t := range s.waiters {
+		if t == w {
+			s.waiters = append(s.waiters[:i], s.waiters[i+1:]...)
+			break
+		}
+	}
+	probeSlotsWaiting.With(schedulerAll).Dec()
+	probeSlotsWaiting.With(typ).Dec()
+	return ctx.Err()
+}
+
+// release returns the slot of a probe of typ.
+func (s *Scheduler) release(typ string) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.releaseLocked(typ)
+}
+
+// releaseLocked returns the slot of a probe of typ.
+//
+// This must be called with s.lock held.
+func (s *Scheduler) releaseLocked(typ string) {
+	s.running--
+	s.typeRunning[typ]--
+	probeSlotsRunning.With(schedulerAll).Dec()
+	probeSlotsRunning.With(typ).Dec()
+	s.grant()
+}
+
+// SetProbeType sets the type of the probe, used for the limits
+// of the scheduler.
+// This should be called before the monitor starts.
+func (m *Monitor) SetProbeType(typ string) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.probeType = typ
+}
+
+// SetPriority sets the priority to get a slot of the scheduler.
+// Probes with higher priority start first.  The default is 0.
+// This should be called before the monitor starts.
+func (m *Monitor) SetPriority(p int) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.priority = p
+}
+
+// waitSlot waits for a slot of the scheduler until deadline.
+//
+// It returns a function to release the slot, or nil if ctx is canceled
+// or no slot is available until deadline.  The probe timeout starts
+// after a slot is acquired, so that waiting does not shorten it.
+func (m *Monitor) waitSlot(ctx context.Context, deadline time.Time) func() {
+	s := getScheduler()
+	if s == nil {
+		return func() {}
+	}
+
+	m.lock.Lock()
+	typ, priority := m.probeType, m.priority
+	m.lock.Unlock()
+
+	wctx, cancel := context.WithDeadline(ctx, deadline)
+	defer cancel()
+	if err := s.acquire(wctx, typ, priority); err != nil {
+		if ctx.Err() == nil {
+			probeSkipped.With(m.name).Inc()
+			glog.Warningf("probe skipped as no slot is available, monitor: %s, type: %s", m.name, typ)
+		}
+		return nil
+	}
+	return func() { s.release(typ) }
+}
@@ -0,0 +1,83 @@
+package monitor
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestScheduler(t *testing.T) {
+	s := NewScheduler(2, map[string]int{"exec": 1})
+	ctx := context.Background()
+
+	if err := s.acquire(ctx, "exec", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// exec is limited by its type, but others are not.
+	cctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	if err := s.acquire(cctx, "exec", 0); err == nil {
+		t.Fatal("type limit is not applied")
+	}
+	if err := s.acquire(ctx, "sql", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	// the global limit is reached; higher priority starts first.
+	order := make(chan int, 2)
+	for _, p := range []int{0, 10} {
+		go func(p int) {
+			if err := s.acquire(ctx, "sql", p); err != nil {
+				t.Error(err)
+			}
+			order <- p
+		}(p)
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	s.release("sql")
+	if p := <-order; p != 10 {
+		t.Error("lower priority started first:", p)
+	}
+	s.release("exec")
+	if p := <-order; p != 0 {
+		t.Error("unexpected priority:", p)
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.running != 2 || len(s.waiters) != 0 {
+		t.Error("unexpected state:", s.running, len(s.waiters))
+	}
+}
+
+func TestWaitSlot(t *testing.T) {
+	s := NewScheduler(1, nil)
+	SetScheduler(s)
+	defer SetScheduler(nil)
+
+	m := NewMonitor("wait-slot", nil, nil, nil,
+		time.Second, time.Second,
+		Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+	m.SetProbeType("exec")
+	skipped := probeSkipped.With("wait-slot").Value()
+
+	release := m.waitSlot(context.Background(), time.Now().Add(time.Second))
+	if release == nil {
+		t.Fatal("no slot")
+	}
+	if r := m.waitSlot(context.Background(), time.Now().Add(50*time.Millisecond)); r != nil {
+		t.Error("slot is acquired beyond the limit")
+	}
+	if probeSkipped.With("wait-slot").Value()-skipped != 1 {
+		t.Error("skipped probe is not counted")
+	}
+	release()
+
+	if r := m.waitSlot(context.Background(), time.Now().Add(time.Second)); r == nil {
+		t.Error("slot is not released")
+	} else {
+		r()
+	}
+}
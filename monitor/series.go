@@ -0,0 +1,465 @@
+package monitor
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"nightwatch/actions"
+	"nightwatch/filters"
+	"nightwatch/probes"
+
+	"github.com/golang/glog"
+)
+
+// series is the state of a labeled series of a monitor.
+//
+// Monitors with ordinary probes have only one series without labels.
+type series struct {
+	key      string
+	labels   map[string]string
+	filters  []filters.Filter
+	severity actions.Severity
+	unknown  bool
+	failedAt *time.Time
+
+	// notified is the severity actors were notified of last.
+	// It differs from the current severity while notifications
+	// are muted.
+	notified actions.Severity
+
+	// failNotified is true if actors have been notified of a failure
+	// since the series was last OK.
+	failNotified bool
+
+	// muted describes why notifications are muted, or is empty.
+	muted string
+
+	lastValue float64
+	lastError string
+	repeatState
+}
+
+// notification is an event and the actors to be notified.
+// If route is true, the event is also sent to the router.
+type notification struct {
+	event  *actions.Event
+	actors []actions.Actor
+	route  bool
+}
+
+// SeriesStatus represents the status of a series.
+type SeriesStatus struct {
+	Labels   map[string]string
+	Severity actions.Severity
+	FailedAt *time.Time
+
+	// Muted describes why notifications are muted, or is empty.
+	Muted string
+}
+
+func (s *series) currentSeverity() actions.Severity {
+	if s.unknown {
+		return actions.SeverityUnknown
+	}
+	return s.severity
+}
+
+func (m *Monitor) newSeries(labels map[string]string) *series {
+	s := &series{
+		key:      actions.FormatLabels(labels),
+		labels:   labels,
+		severity: actions.SeverityOK,
+		notified: actions.SeverityOK,
+	}
+	if m.newFilters != nil {
+		s.filters = m.newFilters()
+	}
+	for _, f := range s.filters {
+		f.Init()
+	}
+	return s
+}
+
+func (m *Monitor) judge(v float64) actions.Severity {
+	switch {
+	case !m.crit.Contains(v):
+		return actions.SeverityCritical
+	case !m.warn.Contains(v):
+		return actions.SeverityWarning
+	}
+	return actions.SeverityOK
+}
+
+// filter puts v into the filter chain of s.  A panic in filters is
+// returned as an error.
+//
+// This must be called with m.lock held.
+func (m *Monitor) filter(s *series, v float64) (float64, error) {
+	err := protect(m.name, kindFilter, func() error {
+		for _, f := range s.filters {
+			v = f.Put(v)
+		}
+		return nil
+	})
+	return v, err
+}
+
+// evaluate updates the state of s by r.
+// If the state changes, an event to be notified is returned.
+//
+// This must be called with m.lock held.
+func (m *Monitor) evaluate(s *series, r *probes.Result, now time.Time) *actions.Event {
+	prev := s.severity
+	e := &actions.Event{
+		Monitor:  m.name,
+		Labels:   s.labels,
+		Previous: prev,
+		Value:    r.Value,
+		Crit:     m.crit,
+		Warn:     m.warn,
+		Message:  r.Message,
+		Time:     now,
+	}
+	if s.failedAt != nil {
+		e.FailedAt = *s.failedAt
+	}
+
+	if r.Err == nil {
+		v, err := m.filter(s, r.Value)
+		if err != nil {
+			r = &probes.Result{Labels: r.Labels, Err: err}
+		} else {
+			r.Value = v
+		}
+	}
+
+	s.lastError = ""
+	if r.Err != nil {
+		s.lastError = r.Err.Error()
+		if s.unknown {
+			return nil
+		}
+		s.unknown = true
+		e.Type = actions.EventUnknown
+		e.Severity = actions.SeverityUnknown
+		e.Error = r.Err.Error()
+		return e
+	}
+
+	e.Value = r.Value
+	s.lastValue = r.Value
+
+	sev := m.judge(r.Value)
+	if sev == prev && !s.unknown {
+		return nil
+	}
+	if sev == prev {
+		// back from the unknown state without any severity change.
+		e.Previous = actions.SeverityUnknown
+	}
+	s.unknown = false
+
+	e.Type = actions.EventFail
+	e.Severity = sev
+	switch {
+	case sev == actions.SeverityOK:
+		e.Type = actions.EventRecover
+		if s.failedAt != nil {
+			e.Duration = now.Sub(*s.failedAt)
+		}
+		s.failedAt = nil
+	case prev == actions.SeverityOK:
+		s.failedAt = &now
+		s.resetRepeat(now)
+		e.FailedAt = now
+	default:
+		s.lastNotified = now
+	}
+	s.severity = sev
+	return e
+}
+
+// drop is called when s is no longer returned by the probe.
+// If s is failing or unknown, a recovery event is returned.
+//
+// This must be called with m.lock held.
+func (m *Monitor) drop(s *series, now time.Time) *actions.Event {
+	if s.failedAt == nil && !s.unknown {
+		return nil
+	}
+
+	e := &actions.Event{
+		Monitor:  m.name,
+		Labels:   s.labels,
+		Type:     actions.EventRecover,
+		Severity: actions.SeverityOK,
+		Previous: s.severity,
+		Crit:     m.crit,
+		Warn:     m.warn,
+		Message:  "series is no longer reported",
+		Time:     now,
+	}
+	if s.failedAt != nil {
+		e.FailedAt = *s.failedAt
+		e.Duration = now.Sub(*s.failedAt)
+	} else {
+		e.Previous = actions.SeverityUnknown
+	}
+	return e
+}
+
+// muted returns the reason why notifications for s are muted,
+// or an empty string.
+//
+// This must be called with m.lock held.
+func (m *Monitor) muted(s *series, now time.Time) string {
+	if len(m.inhibitor) > 0 {
+		return "inhibited by " + m.inhibitor
+	}
+	if sl := silencedBy(m.name, s.labels, now); sl != nil {
+		return fmt.Sprintf("silenced by %d", sl.ID)
+	}
+	return ""
+}
+
+// reconcile returns an event to notify actors of the current state
+// of s if it has changed while notifications were muted.
+//
+// This must be called with m.lock held.
+func (m *Monitor) reconcile(s *series, now time.Time) *actions.Event {
+	cur := s.currentSeverity()
+	if cur == s.notified {
+		return nil
+	}
+
+	e := &actions.Event{
+		Monitor:  m.name,
+		Labels:   s.labels,
+		Severity: cur,
+		Previous: s.notified,
+		Value:    s.lastValue,
+		Crit:     m.crit,
+		Warn:     m.warn,
+		Message:  "state changed while notifications were muted",
+		Time:     now,
+	}
+	if s.failedAt != nil {
+		e.FailedAt = *s.failedAt
+	}
+	switch cur {
+	case actions.SeverityOK:
+		e.Type = actions.EventRecover
+	case actions.SeverityUnknown:
+		e.Type = actions.EventUnknown
+	default:
+		e.Type = actions.EventFail
+		s.lastNotified = now
+	}
+	return e
+}
+
+// notifications returns notifications for s after it is evaluated.
+// e is the event returned by evaluate or drop, and may be nil.
+//
+// While notifications are muted, nothing is returned.  Otherwise,
+// changes made while muted are reconciled, or re-notifications are
+// checked.
+//
+// This must be called with m.lock held.
+func (m *Monitor) notifications(s *series, e *actions.Event, now time.Time) []*notification {
+	reason := m.muted(s, now)
+	if reason != s.muted {
+		if len(reason) > 0 {
+			glog.Infof("notifications muted, monitor: %s, reason: %s", m.name, reason)
+		} else {
+			glog.Infof("notifications unmuted, monitor: %s", m.name)
+		}
+		s.muted = reason
+	}
+	if len(reason) > 0 {
+		if e != nil {
+			glog.Infof("notification suppressed, monitor: %s, event: %s, reason: %s", e.Name(), e.Type, reason)
+		}
+		return nil
+	}
+
+	if e == nil {
+		e = m.reconcile(s, now)
+		if e == nil {
+			return m.checkRepeat(s, now)
+		}
+	}
+
+	if e.Severity == s.notified {
+		return nil
+	}
+	// actors know nothing about changes while muted.  If actors were
+	// notified of the unknown state, the severity before it is kept.
+	if s.notified != actions.SeverityUnknown && s.notified != e.Previous {
+		e.Previous = s.notified
+	}
+	s.notified = e.Severity
+	e.FailNotified = s.failNotified
+	switch e.Type {
+	case actions.EventFail:
+		s.failNotified = true
+	case actions.EventRecover:
+		s.failNotified = false
+	}
+	return []*notification{{e, m.targets(s), true}}
+}
+
+// reconcileNow notifies actors of changes made while notifications
+// were muted without waiting for the next probe.
+func (m *Monitor) reconcileNow() {
+	now := time.Now()
+	var events []*notification
+
+	m.lock.Lock()
+	for _, s := range m.sortedSeries() {
+		events = append(events, m.notifications(s, nil, now)...)
+	}
+	m.lock.Unlock()
+
+	for _, n := range events {
+		m.notify(n)
+	}
+}
+
+// update updates series by the results of a probe run, then
+// notifies actors of state changes.
+func (m *Monitor) update(rs []*probes.Result, err error) {
+	now := time.Now()
+	var events []*notification
+	parent := m.failingParent()
+
+	m.lock.Lock()
+	if parent != m.inhibitor {
+		if len(parent) > 0 {
+			glog.Infof("monitor inhibited, monitor: %s, parent: %s", m.name, parent)
+		}
+		m.inhibitor = parent
+	}
+	wasOK := m.worstSeverity() == actions.SeverityOK
+	if err != nil {
+		if len(m.series) == 0 {
+			s := m.newSeries(nil)
+			m.series[s.key] = s
+		}
+		for _, s := range m.series {
+			e := m.evaluate(s, &probes.Result{Err: err}, now)
+			m.record(s, 0, now)
+			events = append(events, m.notifications(s, e, now)...)
+		}
+	} else {
+		seen := make(map[string]bool)
+		for _, r := range rs {
+			key := actions.FormatLabels(r.Labels)
+			s, ok := m.series[key]
+			if !ok {
+				s = m.newSeries(r.Labels)
+				m.series[key] = s
+			}
+			seen[key] = true
+			raw := r.Value
+			e := m.evaluate(s, r, now)
+			m.record(s, raw, now)
+			events = append(events, m.notifications(s, e, now)...)
+		}
+		for key, s := range m.series {
+			if seen[key] {
+				continue
+			}
+			if e := m.drop(s, now); e != nil {
+				events = append(events, m.notifications(s, e, now)...)
+			}
+			delete(m.series, key)
+		}
+	}
+	m.clearAck(now)
+	if m.worstSeverity() == actions.SeverityOK {
+		m.failStreak = 0
+	} else {
+		m.failStreak++
+	}
+	m.updateStatus()
+	recovered := !wasOK && m.worstSeverity() == actions.SeverityOK
+	m.lock.Unlock()
+
+	if recovered {
+		m.wakeChildren()
+	}
+
+	for _, n := range events {
+		e := n.event
+		m.notify(n)
+		switch e.Type {
+		case actions.EventRepeat:
+			glog.Warningf("monitor still failing, monitor: %s, repeat: %d, escalation: %d", e.Name(), e.Repeat, e.Escalation)
+		case actions.EventRecover:
+			glog.Warningf("monitor recovery, monitor: %s, duration: %v", e.Name(), int(e.Duration.Seconds()))
+		case actions.EventUnknown:
+			glog.Warningf("monitor unknown, monitor: %s, error: %s", e.Name(), e.Error)
+		default:
+			glog.Warningf("monitor failure, monitor: %s, severity: %s, value: %s", e.Name(), e.Severity, fmt.Sprint(e.Value))
+		}
+	}
+}
+
+// worstSeverity returns the worst severity among series.
+//
+// This must be called with m.lock held.
+func (m *Monitor) worstSeverity() actions.Severity {
+	sev := actions.SeverityOK
+	for _, s := range m.series {
+		if cs := s.currentSeverity(); cs.Rank() > sev.Rank() {
+			sev = cs
+		}
+	}
+	return sev
+}
+
+// updateStatus summarizes the states of series.
+//
+// This must be called with m.lock held.
+func (m *Monitor) updateStatus() {
+	switch sev := m.worstSeverity(); {
+	case sev == actions.SeverityOK:
+		m.status = "running"
+	case len(m.inhibitor) > 0:
+		m.status = "inhibited"
+	case sev == actions.SeverityUnknown:
+		m.status = "unknown"
+	default:
+		m.status = "failed"
+	}
+}
+
+func (m *Monitor) sortedSeries() []*series {
+	l := make([]*series, 0, len(m.series))
+	for _, s := range m.series {
+		l = append(l, s)
+	}
+	sort.Slice(l, func(i, j int) bool {
+		return l[i].key < l[j].key
+	})
+	return l
+}
+
+// Series returns the statuses of series ordered by labels.
+func (m *Monitor) Series() []SeriesStatus {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	var l []SeriesStatus
+	for _, s := range m.sortedSeries() {
+		l = append(l, SeriesStatus{
+			Labels:   s.labels,
+			Severity: s.currentSeverity(),
+			FailedAt: s.failedAt,
+			Muted:    s.muted,
+		})
+	}
+	return l
+}
@@ -0,0 +1,376 @@
+package monitor
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"time"
+
+	"nightwatch/schedule"
+	"nightwatch/state"
+	"nightwatch/util/cmd"
+
+	"github.com/golang/glog"
+)
+
+const (
+	silencesKey = "silences"
+
+	// expired silences are kept for a while to be listed.
+	silenceRetention = 24 * time.Hour
+
+	// silenceCheckPeriod is the interval to check silences that ended.
+	silenceCheckPeriod = time.Second
+)
+
+// Silence states.
+const (
+	SilencePending = "pending"
+	SilenceActive  = "active"
+	SilenceExpired = "expired"
+)
+
+// Silence mutes notifications of matching monitors for a period.
+//
+// Monitors keep probing while silenced.  When a silence ends,
+// actors are notified of the current states that differ from what
+// they were notified of before.
+type Silence struct {
+	ID int `json:"id"`
+
+	// Monitor is a regular expression that matches whole monitor names.
+	// Empty matches any monitor.
+	Monitor string `json:"monitor,omitempty"`
+
+	// Labels must be equal to the labels of series.
+	Labels map[string]string `json:"labels,omitempty"`
+
+	// StartsAt and EndsAt is the period of the silence.
+	// EndsAt may be zero only for recurring silences.
+	StartsAt time.Time `json:"starts_at"`
+	EndsAt   time.Time `json:"ends_at"`
+
+	// Cron makes the silence recurring.  Windows of Duration open
+	// at times matching Cron between StartsAt and EndsAt.
+	Cron     string   `json:"cron,omitempty"`
+	Duration Duration `json:"duration,omitempty"`
+
+	Author  string `json:"author"`
+	Comment string `json:"comment"`
+
+	re     *regexp.Regexp
+	window *schedule.Window
+}
+
+// Duration is a time.Duration represented as a string like "2h" in JSON.
+type Duration time.Duration
+
+// String returns the duration formatted like "2h0m0s".
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+// MarshalJSON implements json.Marshaler.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// UnmarshalJSON implements json.Unmarshaler.
+// Integer nanoseconds saved by older versions are also accepted.
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		var n int64
+		if err := json.Unmarshal(data, &n); err != nil {
+			return err
+		}
+		*d = Duration(n)
+		return nil
+	}
+	t, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	*d = Duration(t)
+	return nil
+}
+
+var (
+	silencesLock = new(sync.Mutex)
+	silences     = make(map[int]*Silence)
+	silenceIndex = 1
+
+	// activeSilences are IDs of silences active at the last check.
+	activeSilences = make(map[int]bool)
+	watchOnce      sync.Once
+)
+
+// silencesSnapshot is the persisted state of silences.
+type silencesSnapshot struct {
+	NextID   int        `json:"next_id"`
+	Silences []*Silence `json:"silences"`
+}
+
+func (s *Silence) compile() error {
+	if len(s.Monitor) == 0 && len(s.Labels) == 0 {
+		return fmt.Errorf("%v: no matchers", ErrInvalidSilence)
+	}
+	pattern := s.Monitor
+	if len(pattern) == 0 {
+		pattern = ".*"
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return fmt.Errorf("%v: %v", ErrInvalidSilence, err)
+	}
+	s.re = re
+
+	if len(s.Cron) == 0 {
+		if s.EndsAt.IsZero() || !s.EndsAt.After(s.StartsAt) {
+			return fmt.Errorf("%v: invalid period", ErrInvalidSilence)
+		}
+		return nil
+	}
+
+	if s.Duration <= 0 {
+		return fmt.Errorf("%v: duration is required for cron", ErrInvalidSilence)
+	}
+	if !s.EndsAt.IsZero() && !s.EndsAt.After(s.StartsAt) {
+		return fmt.Errorf("%v: invalid period", ErrInvalidSilence)
+	}
+	w, err := schedule.NewWindow(s.Cron, time.Duration(s.Duration), time.Local)
+	if err != nil {
+		return fmt.Errorf("%v: %v", ErrInvalidSilence, err)
+	}
+	s.window = w
+	return nil
+}
+
+// State returns the state of the silence at t.
+func (s *Silence) State(t time.Time) string {
+	switch {
+	case !s.EndsAt.IsZero() && !t.Before(s.EndsAt):
+		return SilenceExpired
+	case t.Before(s.StartsAt):
+		return SilencePending
+	case s.window != nil && !s.window.Active(t):
+		return SilencePending
+	}
+	return SilenceActive
+}
+
+// Matches returns true if s matches a series of a monitor.
+func (s *Silence) Matches(name string, labels map[string]string) bool {
+	if !s.re.MatchString(name) {
+		return false
+	}
+	for k, v := range s.Labels {
+		if lv, ok := labels[k]; !ok || lv != v {
+			return false
+		}
+	}
+	return true
+}
+
+// AddSilence validates and adds a silence.
+// The ID of the silence is assigned and returned.
+func AddSilence(s *Silence) (int, error) {
+	if s.StartsAt.IsZero() {
+		s.StartsAt = time.Now()
+	}
+	if err := s.compile(); err != nil {
+		return 0, err
+	}
+
+	silencesLock.Lock()
+	s.ID = silenceIndex
+	silenceIndex++
+	silences[s.ID] = s
+	saveSilences()
+	silencesLock.Unlock()
+	startSilenceWatcher()
+
+	glog.Infof("silence added, id: %d, monitor: %s, labels: %v, author: %s, comment: %s",
+		s.ID, s.Monitor, s.Labels, s.Author, s.Comment)
+	return s.ID, nil
+}
+
+// ExpireSilence ends a silence immediately.
+func ExpireSilence(id int) error {
+	silencesLock.Lock()
+	defer silencesLock.Unlock()
+
+	s, ok := silences[id]
+	if !ok {
+		return ErrSilenceNotFound
+	}
+	now := time.Now()
+	if s.State(now) != SilenceExpired {
+		s.EndsAt = now
+		if s.StartsAt.After(now) {
+			s.StartsAt = now
+		}
+	}
+	saveSilences()
+
+	glog.Infof("silence expired, id: %d", id)
+	return nil
+}
+
+// Silences returns silences ordered by ID.
+// Silences expired long ago are removed.
+func Silences() []*Silence {
+	silencesLock.Lock()
+	defer silencesLock.Unlock()
+
+	purgeSilences(time.Now())
+	l := make([]*Silence, 0, len(silences))
+	for _, s := range silences {
+		t := *s
+		l = append(l, &t)
+	}
+	sort.Slice(l, func(i, j int) bool {
+		return l[i].ID < l[j].ID
+	})
+	return l
+}
+
+// silencedBy returns the active silence for a series, or nil.
+func silencedBy(name string, labels map[string]string, now time.Time) *Silence {
+	silencesLock.Lock()
+	defer silencesLock.Unlock()
+
+	for _, s := range silences {
+		if s.State(now) == SilenceActive && s.Matches(name, labels) {
+			return s
+		}
+	}
+	return nil
+}
+
+// purgeSilences removes silences expired before silenceRetention.
+//
+// This must be called with silencesLock held.
+func purgeSilences(now time.Time) {
+	for id, s := range silences {
+		if !s.EndsAt.IsZero() && now.Sub(s.EndsAt) > silenceRetention {
+			delete(silences, id)
+		}
+	}
+}
+
+// saveSilences persists silences.
+//
+// This must be called with silencesLock held.
+func saveSilences() {
+	st := getStateStore()
+	if st == nil {
+		return
+	}
+
+	purgeSilences(time.Now())
+	snap := &silencesSnapshot{NextID: silenceIndex}
+	for _, s := range silences {
+		snap.Silences = append(snap.Silences, s)
+	}
+	if err := st.Save(silencesKey, snap); err != nil {
+		glog.Errorf("failed to save silences, error: %v", err)
+	}
+}
+
+// LoadSilences loads silences from the state store.
+// This should be called after SetStateStore before monitors start.
+func LoadSilences() error {
+	st := getStateStore()
+	if st == nil {
+		return nil
+	}
+
+	snap := new(silencesSnapshot)
+	err := st.Load(silencesKey, snap)
+	if err == state.ErrNotFound {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	silencesLock.Lock()
+	defer silencesLock.Unlock()
+
+	for _, s := range snap.Silences {
+		if err := s.compile(); err != nil {
+			glog.Errorf("invalid silence is discarded, id: %d, error: %v", s.ID, err)
+			continue
+		}
+		silences[s.ID] = s
+	}
+	if snap.NextID > silenceIndex {
+		silenceIndex = snap.NextID
+	}
+	purgeSilences(time.Now())
+	startSilenceWatcher()
+	return nil
+}
+
+// startSilenceWatcher starts the goroutine to reconcile monitors when
+// silences end.  It runs until the global environment is canceled.
+func startSilenceWatcher() {
+	watchOnce.Do(func() {
+		cmd.Go(watchSilences)
+	})
+}
+
+func watchSilences(ctx context.Context) error {
+	ticker := time.NewTicker(silenceCheckPeriod)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		for _, s := range endedSilences(time.Now()) {
+			reconcileSilenced(s)
+		}
+	}
+}
+
+// endedSilences returns silences that were active at the last call
+// but not at now, either expired or out of their windows.
+func endedSilences(now time.Time) []*Silence {
+	silencesLock.Lock()
+	defer silencesLock.Unlock()
+
+	var l []*Silence
+	for id := range activeSilences {
+		s, ok := silences[id]
+		if !ok || s.State(now) != SilenceActive {
+			delete(activeSilences, id)
+			if ok {
+				l = append(l, s)
+			}
+		}
+	}
+	for id, s := range silences {
+		if s.State(now) == SilenceActive {
+			activeSilences[id] = true
+		}
+	}
+	return l
+}
+
+// reconcileSilenced lets monitors matching s notify changes made
+// while s was active without waiting for their next probes.
+func reconcileSilenced(s *Silence) {
+	glog.Infof("silence ended, id: %d", s.ID)
+	for _, m := range ListMonitors() {
+		if s.re.MatchString(m.Name()) {
+			m.reconcileNow()
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package monitor
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"nightwatch/actions"
+	"nightwatch/filters"
+	"nightwatch/state"
+
+	"github.com/golang/glog"
+)
+
+var (
+	storeLock = new(sync.Mutex)
+	store     state.Store
+)
+
+// SetStateStore sets the store to persist monitor states.
+//
+// This should be called before any monitor starts.
+// nil disables persistence.
+func SetStateStore(s state.Store) {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+
+	store = s
+}
+
+func getStateStore() state.Store {
+	storeLock.Lock()
+	defer storeLock.Unlock()
+
+	return store
+}
+
+// snapshot is the persisted state of a monitor.
+type snapshot struct {
+	Status string            `json:"status"`
+	Times  int64             `json:"times"`
+	Series []*seriesSnapshot `json:"series,omitempty"`
+	Ack    *Ack              `json:"ack,omitempty"`
+
+	// Older versions saved the state of the only series here.
+	Severity actions.Severity  `json:"severity,omitempty"`
+	Unknown  bool              `json:"unknown,omitempty"`
+	FailedAt *time.Time        `json:"failed_at,omitempty"`
+	Filters  []json.RawMessage `json:"filters,omitempty"`
+}
+
+// seriesSnapshot is the persisted state of a series.
+type seriesSnapshot struct {
+	Labels   map[string]string `json:"labels,omitempty"`
+	Severity actions.Severity  `json:"severity,omitempty"`
+	Unknown  bool              `json:"unknown,omitempty"`
+	FailedAt *time.Time        `json:"failed_at,omitempty"`
+	Filters  []json.RawMessage `json:"filters,omitempty"`
+	Notified actions.Severity  `json:"notified,omitempty"`
+
+	FailNotified bool      `json:"fail_notified,omitempty"`
+	LastValue    float64   `json:"last_value,omitempty"`
+	LastNotified time.Time `json:"last_notified,omitempty"`
+	RepeatDay    string    `json:"repeat_day,omitempty"`
+	Repeats      int       `json:"repeats,omitempty"`
+	Escalation   int       `json:"escalation,omitempty"`
+}
+
+func stateKey(name string) string {
+	return "monitor-" + name
+}
+
+func (m *Monitor) filterStates(s *series) []json.RawMessage {
+	var l []json.RawMessage
+	for _, f := range s.filters {
+		var data json.RawMessage
+		if sf, ok := f.(filters.Stateful); ok {
+			d, err := sf.State()
+			if err != nil {
+				glog.Errorf("failed to get filter state, monitor: %s, filter: %s, error: %v", m.name, f.String(), err)
+			}
+			data = d
+		}
+		l = append(l, data)
+	}
+	return l
+}
+
+func (m *Monitor) restoreFilters(s *series, states []json.RawMessage) {
+	// filters may have been changed since the state was saved.
+	if len(states) != len(s.filters) {
+		glog.Warningf("filter states are discarded, monitor: %s", m.name)
+		return
+	}
+	for i, f := range s.filters {
+		sf, ok := f.(filters.Stateful)
+		if !ok || len(states[i]) == 0 || string(states[i]) == "null" {
+			continue
+		}
+		if err := sf.Restore(states[i]); err != nil {
+			glog.Errorf("failed to restore filter state, monitor: %s, filter: %s, error: %v", m.name, f.String(), err)
+			f.Init()
+		}
+	}
+}
+
+// stateSaveInterval is the interval to save run counts and filter
+// states, which change on every probe.
+var stateSaveInterval = time.Minute
+
+// saveState saves the current state of the monitor if the state of
+// series has changed since the last save, or if force is true.
+// Run counts and filter states alone trigger saves only once in
+// stateSaveInterval so that every probe does not write to the store.
+// This must be called from the monitoring goroutine or after it ends.
+func (m *Monitor) saveState(force bool) {
+	st := getStateStore()
+	if st == nil {
+		return
+	}
+
+	now := time.Now()
+	m.lock.Lock()
+	snap := &snapshot{
+		Status: m.status,
+		Times:  m.times,
+		Ack:    m.ack,
+	}
+	for _, s := range m.sortedSeries() {
+		snap.Series = append(snap.Series, &seriesSnapshot{
+			Labels:   s.labels,
+			Severity: s.severity,
+			Unknown:  s.unknown,
+			FailedAt: s.failedAt,
+			Filters:  m.filterStates(s),
+			Notified: s.notified,
+
+			FailNotified: s.failNotified,
+			LastValue:    s.lastValue,
+			LastNotified: s.lastNotified,
+			RepeatDay:    s.day,
+			Repeats:      s.repeats,
+			Escalation:   s.escalation,
+		})
+	}
+	key := stateFingerprint(snap)
+	if !force && key == m.savedState && now.Sub(m.savedAt) < stateSaveInterval {
+		m.lock.Unlock()
+		return
+	}
+	m.savedState = key
+	m.savedAt = now
+	m.lock.Unlock()
+
+	if err := st.Save(stateKey(m.name), snap); err != nil {
+		glog.Errorf("failed to save monitor state, monitor: %s, error: %v", m.name, err)
+	}
+}
+
+// stateFingerprint returns a string that changes when the state of
+// series in snap changes.
+func stateFingerprint(snap *snapshot) string {
+	t := *snap
+	t.Times = 0
+	t.Series = nil
+	for _, ss := range snap.Series {
+		s := *ss
+		s.Filters = nil
+		s.LastValue = 0
+		t.Series = append(t.Series, &s)
+	}
+	data, err := json.Marshal(&t)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// restoreState restores the state saved by saveState.
+// This must be called from the monitoring goroutine before the
+// first probe.
+func (m *Monitor) restoreState() {
+	st := getStateStore()
+	if st == nil {
+		return
+	}
+
+	snap := new(snapshot)
+	err := st.Load(stateKey(m.name), snap)
+	if err == state.ErrNotFound {
+		return
+	}
+	if err != nil {
+		glog.Errorf("failed to load monitor state, monitor: %s, error: %v", m.name, err)
+		return
+	}
+
+	if len(snap.Series) == 0 && (snap.FailedAt != nil || snap.Unknown || len(snap.Filters) > 0) {
+		snap.Series = []*seriesSnapshot{{
+			Severity: snap.Severity,
+			Unknown:  snap.Unknown,
+			FailedAt: snap.FailedAt,
+			Filters:  snap.Filters,
+		}}
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	m.times = snap.Times
+	m.ack = snap.Ack
+	for _, ss := range snap.Series {
+		s := m.newSeries(ss.Labels)
+		s.unknown = ss.Unknown
+		s.failedAt = ss.FailedAt
+		s.lastValue = ss.LastValue
+		s.repeatState = repeatState{
+			lastNotified: ss.LastNotified,
+			day:          ss.RepeatDay,
+			repeats:      ss.Repeats,
+			escalation:   ss.Escalation,
+		}
+		if s.failedAt != nil {
+			s.severity = ss.Severity
+			if len(s.severity) == 0 || s.severity == actions.SeverityOK {
+				// saved by older versions without severity.
+				s.severity = actions.SeverityCritical
+			}
+		}
+		s.notified = ss.Notified
+		if len(s.notified) == 0 {
+			// saved by older versions.
+			s.notified = s.currentSeverity()
+		}
+		// actors notified of a failing severity have got a failure.
+		s.failNotified = ss.FailNotified ||
+			s.notified == actions.SeverityWarning ||
+			s.notified == actions.SeverityCritical
+		m.restoreFilters(s, ss.Filters)
+		m.series[s.key] = s
+	}
+	m.updateStatus()
+
+	glog.Infof("monitor state restored, monitor: %s, series: %d", m.name, len(m.series))
+}
+
+func deleteState(name string) {
+	s := getStateStore()
+	if s == nil {
+		return
+	}
+	if err := s.Delete(stateKey(name)); err != nil {
+		glog.Errorf("failed to delete monitor state, monitor: %s, error: %v", name, err)
+	}
+}
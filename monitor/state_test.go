@@ -0,0 +1,63 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+
+	"nightwatch/probes"
+	"nightwatch/state"
+)
+
+// countStore counts saves.
+type countStore struct {
+	saves int
+}
+
+func (s *countStore) Load(key string, v interface{}) error {
+	return state.ErrNotFound
+}
+
+func (s *countStore) Save(key string, v interface{}) error {
+	s.saves++
+	return nil
+}
+
+func (s *countStore) Delete(key string) error {
+	return nil
+}
+
+func TestSaveState(t *testing.T) {
+	s := new(countStore)
+	SetStateStore(s)
+	defer SetStateStore(nil)
+
+	m := NewMonitor("save-state", nil, nil, nil,
+		time.Second, time.Second,
+		Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+
+	values := []float64{0, 0, 0, 1, 1, 0}
+	for _, v := range values {
+		m.update([]*probes.Result{{Value: v}}, nil)
+		m.lock.Lock()
+		m.times++
+		m.lock.Unlock()
+		m.saveState(false)
+	}
+	if s.saves != 3 {
+		t.Error("state is not saved only on changes:", s.saves)
+	}
+
+	m.saveState(true)
+	if s.saves != 4 {
+		t.Error("forced save is skipped")
+	}
+
+	// filter states and run counts are saved periodically.
+	m.lock.Lock()
+	m.savedAt = m.savedAt.Add(-stateSaveInterval)
+	m.lock.Unlock()
+	m.saveState(false)
+	if s.saves != 5 {
+		t.Error("state is not saved periodically")
+	}
+}
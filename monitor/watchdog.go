@@ -0,0 +1,118 @@
+package monitor
+
+import (
+	"context"
+	"fmt"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+
+	"nightwatch/metrics"
+	"nightwatch/probes"
+
+	"github.com/golang/glog"
+)
+
+// States of a probe goroutine.
+const (
+	probeRunning int32 = iota
+	probeReturned
+	probeAbandoned
+)
+
+// probeOverrunGrace is the time a probe may take to return after its
+// deadline before it is abandoned.
+var probeOverrunGrace = 5 * time.Second
+
+var (
+	panicsRecovered = metrics.NewCounterVec(
+		"nightwatch_panics_total",
+		"Number of panics recovered in probes, filters and actions.",
+		"monitor", "kind")
+	probeOverruns = metrics.NewCounterVec(
+		"nightwatch_probe_overruns_total",
+		"Number of probes abandoned for overrunning their deadline.",
+		"monitor")
+	probesAbandoned = metrics.NewGaugeVec(
+		"nightwatch_probe_abandoned_goroutines",
+		"Number of abandoned probe goroutines that have not returned yet.",
+		"monitor")
+)
+
+// Kinds of code protected from panics.
+const (
+	kindProbe  = "probe"
+	kindFilter = "filter"
+	kindAction = "action"
+)
+
+// protect calls f and converts a panic in it into an error.
+// The stack trace of the panic is logged.
+func protect(name, kind string, f func() error) (err error) {
+	defer func() {
+		r := recover()
+		if r == nil {
+			return
+		}
+		panicsRecovered.With(name, kind).Inc()
+		glog.Errorf("recovered from panic, monitor: %s, kind: %s, panic: %v\n%s", name, kind, r, debug.Stack())
+		err = fmt.Errorf("%v: %v", ErrPanic, r)
+	}()
+	return f()
+}
+
+// probeReturn is the return values of a probe.
+type probeReturn struct {
+	rs  []*probes.Result
+	err error
+}
+
+// callProbe runs p for the monitor name with timeout.
+//
+// A panic in p is returned as an error.  If p does not return within
+// probeOverrunGrace after its deadline, the goroutine running p is
+// abandoned and ErrProbeOverrun is returned.
+func callProbe(ctx context.Context, name string, p probes.Prober, timeout time.Duration) ([]*probes.Result, error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ch := make(chan probeReturn, 1)
+	state := probeRunning
+	go func() {
+		var ret probeReturn
+		ret.err = protect(name, kindProbe, func() error {
+			var err error
+			ret.rs, err = probes.RunSeries(ctx, p)
+			return err
+		})
+		ch <- ret
+		if !atomic.CompareAndSwapInt32(&state, probeRunning, probeReturned) {
+			probesAbandoned.With(name).Dec()
+			glog.Warningf("abandoned probe returned, monitor: %s", name)
+		}
+	}()
+
+	select {
+	case ret := <-ch:
+		return ret.rs, ret.err
+	case <-ctx.Done():
+	}
+
+	grace := time.NewTimer(probeOverrunGrace)
+	defer grace.Stop()
+	select {
+	case ret := <-ch:
+		return ret.rs, ret.err
+	case <-grace.C:
+	}
+
+	if !atomic.CompareAndSwapInt32(&state, probeRunning, probeAbandoned) {
+		// returned just now.
+		ret := <-ch
+		return ret.rs, ret.err
+	}
+	probeOverruns.With(name).Inc()
+	probesAbandoned.With(name).Inc()
+	glog.Errorf("probe overran its deadline and is abandoned, monitor: %s, timeout: %v", name, timeout)
+	return nil, fmt.Errorf("%v: timeout %v", ErrProbeOverrun, timeout)
+}
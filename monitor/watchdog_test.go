@@ -0,0 +1,131 @@
+package monitor
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"nightwatch/actions"
+	"nightwatch/filters"
+	"nightwatch/probes"
+)
+
+type panicProbe struct{}
+
+func (p panicProbe) Probe(ctx context.Context) float64 {
+	panic("probe is broken")
+}
+
+func (p panicProbe) String() string {
+	return "probe:panic"
+}
+
+// stuckProbe ignores ctx and returns when release is closed.
+type stuckProbe struct {
+	release chan struct{}
+}
+
+func (p *stuckProbe) Probe(ctx context.Context) float64 {
+	<-p.release
+	return 0
+}
+
+func (p *stuckProbe) String() string {
+	return "probe:stuck"
+}
+
+type panicFilter struct{}
+
+func (f panicFilter) Init() {}
+
+func (f panicFilter) Put(v float64) float64 {
+	panic("filter is broken")
+}
+
+func (f panicFilter) String() string {
+	return "filter:panic"
+}
+
+type panicActor struct {
+	testActor
+}
+
+func (a *panicActor) Notify(e *actions.Event) error {
+	panic("action is broken")
+}
+
+func TestProbePanic(t *testing.T) {
+	rs, err := callProbe(context.Background(), "panic", panicProbe{}, time.Second)
+	if err == nil || !strings.Contains(err.Error(), ErrPanic.Error()) {
+		t.Fatal("panic is not converted into an error:", rs, err)
+	}
+
+	m := NewMonitor("panic", panicProbe{}, nil, nil,
+		time.Second, time.Second,
+		Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+	m.update(rs, err)
+	if m.Status() != "unknown" {
+		t.Error("unexpected status:", m.Status())
+	}
+}
+
+func TestProbeOverrun(t *testing.T) {
+	grace := probeOverrunGrace
+	probeOverrunGrace = 50 * time.Millisecond
+	defer func() {
+		probeOverrunGrace = grace
+	}()
+
+	// counters are global; compare deltas so that tests can repeat.
+	overruns := probeOverruns.With("stuck").Value()
+	abandoned := probesAbandoned.With("stuck").Value()
+
+	p := &stuckProbe{release: make(chan struct{})}
+	st := time.Now()
+	_, err := callProbe(context.Background(), "stuck", p, 50*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), ErrProbeOverrun.Error()) {
+		t.Fatal("overrun is not detected:", err)
+	}
+	if d := time.Since(st); d > time.Second {
+		t.Error("stuck probe blocks the caller:", d)
+	}
+	if probeOverruns.With("stuck").Value()-overruns != 1 {
+		t.Error("overrun is not counted")
+	}
+	if probesAbandoned.With("stuck").Value()-abandoned != 1 {
+		t.Error("abandoned goroutine is not counted")
+	}
+
+	close(p.release)
+	for i := 0; i < 100 && probesAbandoned.With("stuck").Value() != abandoned; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if probesAbandoned.With("stuck").Value() != abandoned {
+		t.Error("returned goroutine is still counted")
+	}
+}
+
+func TestFilterPanic(t *testing.T) {
+	m := NewMonitor("filter-panic", nil,
+		func() []filters.Filter { return []filters.Filter{panicFilter{}} }, nil,
+		time.Second, time.Second,
+		Range{Min: 0, Max: 0}, Range{Min: 0, Max: 0})
+	m.update([]*probes.Result{{Value: 0}}, nil)
+	if m.Status() != "unknown" {
+		t.Error("unexpected status:", m.Status())
+	}
+}
+
+func TestActionPanic(t *testing.T) {
+	panics := panicsRecovered.With("action-panic", kindAction).Value()
+
+	a := new(panicActor)
+	err := callActor(a, &actions.Event{Monitor: "action-panic", Type: actions.EventFail})
+	if err == nil || !strings.Contains(err.Error(), ErrPanic.Error()) {
+		t.Error("panic is not converted into an error:", err)
+	}
+	if panicsRecovered.With("action-panic", kindAction).Value()-panics != 1 {
+		t.Error("panic is not counted")
+	}
+}
@@ -13,7 +13,8 @@ type Prober interface {
 	//
 	// The returned float64 value will be interpreted by the monitor
 	// who run the probe.  Errors occurring within the probe should
-	// produce a float64 value indicating the error.
+	// produce a float64 value indicating the error, or the probe
+	// should implement ResultProber to report them separately.
 	//
 	// ctx.Deadline() is always set.
 	// Probe must return immediately when the ctx.Done() is closed.
@@ -24,6 +25,57 @@ type Prober interface {
 	String() string
 }
 
+// Result is the detailed result of a probe.
+type Result struct {
+	// Value is the probed value.  Ignored if Err is not nil.
+	Value float64
+
+	// Err is non-nil when the probe could not determine the value,
+	// e.g. the target was unreachable.
+	Err error
+
+	// Message is an optional human readable description of the result.
+	Message string
+
+	// Labels are optional key-value pairs describing the result.
+	Labels map[string]string
+}
+
+// ResultProber is an optional interface for probes that can
+// distinguish errors from values.
+type ResultProber interface {
+	// ProbeResult works like Probe, but returns the detailed result.
+	//
+	// The returned value must not be nil.
+	ProbeResult(ctx context.Context) *Result
+}
+
+// SeriesProber is an optional interface for probes that return
+// several labeled values in one run, e.g. disk usages of every
+// mount point.
+type SeriesProber interface {
+	// ProbeSeries returns results for each series.
+	//
+	// Each series is identified by its Labels; results should have
+	// distinct label sets.  A series that is no longer returned is
+	// considered to be gone.
+	//
+	// Non-nil error means that the probe could not determine any value.
+	// Errors for individual series should be set in Result.Err.
+	ProbeSeries(ctx context.Context) ([]*Result, error)
+}
+
+// Run runs p and returns the result.
+//
+// If p does not implement ResultProber, the value returned by Probe
+// is wrapped in a Result.
+func Run(ctx context.Context, p Prober) *Result {
+	if rp, ok := p.(ResultProber); ok {
+		return rp.ProbeResult(ctx)
+	}
+	return &Result{Value: p.Probe(ctx)}
+}
+
 // Constructor is a function to create a probe.
 //
 // params are configuration options for the probe.
@@ -64,3 +116,14 @@ func Construct(name string, params map[string]interface{}) (Prober, error) {
 
 	return ctor(params)
 }
+
+// RunSeries runs p and returns the results for all series.
+//
+// If p does not implement SeriesProber, the result of Run is returned
+// as the only series.
+func RunSeries(ctx context.Context, p Prober) ([]*Result, error) {
+	if sp, ok := p.(SeriesProber); ok {
+		return sp.ProbeSeries(ctx)
+	}
+	return []*Result{Run(ctx, p)}, nil
+}
@@ -0,0 +1,110 @@
+package nightwatch
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+
+	"nightwatch/monitor"
+)
+
+// RoutingDefinition is a struct to load the routing configuration.
+type RoutingDefinition struct {
+	Receivers []*ReceiverDefinition `yaml:"receivers" json:"receivers"`
+	Route     *RouteDefinition      `yaml:"route" json:"route"`
+}
+
+// ReceiverDefinition defines a named set of actions.
+type ReceiverDefinition struct {
+	Name    string                   `yaml:"name" json:"name"`
+	Actions []map[string]interface{} `yaml:"actions" json:"actions"`
+}
+
+// RouteDefinition defines a node of the routing tree.
+//
+// Receiver, GroupBy and GroupWait default to those of the parent.
+type RouteDefinition struct {
+	Receiver string            `yaml:"receiver" json:"receiver,omitempty"`
+	Match    map[string]string `yaml:"match" json:"match,omitempty"`
+
+	// MatchRE values are regular expressions that match whole labels.
+	MatchRE map[string]string `yaml:"match_re" json:"match_re,omitempty"`
+
+	GroupBy []string `yaml:"group_by" json:"group_by,omitempty"`
+
+	// GroupWait is seconds to buffer events of a group.
+	GroupWait *int `yaml:"group_wait" json:"group_wait,omitempty"`
+
+	Continue bool               `yaml:"continue" json:"continue,omitempty"`
+	Routes   []*RouteDefinition `yaml:"routes" json:"routes,omitempty"`
+}
+
+func createRoute(d *RouteDefinition, parent *monitor.Route) (*monitor.Route, error) {
+	rt := &monitor.Route{
+		Receiver: d.Receiver,
+		Match:    d.Match,
+		MatchRE:  make(map[string]*regexp.Regexp),
+		GroupBy:  d.GroupBy,
+		Continue: d.Continue,
+	}
+	if parent != nil {
+		if len(rt.Receiver) == 0 {
+			rt.Receiver = parent.Receiver
+		}
+		if rt.GroupBy == nil {
+			rt.GroupBy = parent.GroupBy
+		}
+		rt.GroupWait = parent.GroupWait
+	}
+	if d.GroupWait != nil {
+		if *d.GroupWait < 0 {
+			return nil, fmt.Errorf("%v: negative group_wait", ErrInvalidRoute)
+		}
+		rt.GroupWait = time.Duration(*d.GroupWait) * time.Second
+	}
+
+	for k, v := range d.MatchRE {
+		re, err := regexp.Compile("^(?:" + v + ")$")
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", ErrInvalidRoute, err)
+		}
+		rt.MatchRE[k] = re
+	}
+
+	for _, cd := range d.Routes {
+		c, err := createRoute(cd, rt)
+		if err != nil {
+			return nil, err
+		}
+		rt.Routes = append(rt.Routes, c)
+	}
+	return rt, nil
+}
+
+// CreateRouter creates a router from RoutingDefinition.
+func CreateRouter(d *RoutingDefinition) (*monitor.Router, error) {
+	if d.Route == nil {
+		return nil, fmt.Errorf("%v: no route", ErrInvalidRoute)
+	}
+
+	var receivers []*monitor.Receiver
+	for _, rd := range d.Receivers {
+		if len(rd.Name) == 0 {
+			return nil, fmt.Errorf("%v: no receiver name", ErrInvalidRoute)
+		}
+		actors, err := createActors(rd.Name, rd.Actions)
+		if err != nil {
+			return nil, err
+		}
+		receivers = append(receivers, &monitor.Receiver{
+			Name:   rd.Name,
+			Actors: actors,
+		})
+	}
+
+	root, err := createRoute(d.Route, nil)
+	if err != nil {
+		return nil, err
+	}
+	return monitor.NewRouter(root, receivers)
+}
@@ -0,0 +1,233 @@
+// Package schedule provides cron expressions and time windows.
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Errors for cron expressions.
+var (
+	ErrInvalidCron = errors.New("invalid cron expression")
+)
+
+// maxSearch limits the search for the next matching time.
+const maxSearch = 5 * 366 * 24 * time.Hour
+
+type field struct {
+	name     string
+	min, max int
+	names    map[string]int
+}
+
+var fields = []field{
+	{"minute", 0, 59, nil},
+	{"hour", 0, 23, nil},
+	{"day of month", 1, 31, nil},
+	{"month", 1, 12, map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}},
+	{"day of week", 0, 7, map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}},
+}
+
+var descriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+// Cron is a parsed cron expression.
+//
+// Cron matches times at the granularity of minutes.
+type Cron struct {
+	spec   string
+	loc    *time.Location
+	minute uint64
+	hour   uint64
+	dom    uint64
+	month  uint64
+	dow    uint64
+
+	// domStar and dowStar are true if the field is "*".
+	// As in Vixie cron, if both day fields are restricted,
+	// a day matches either of them.
+	domStar bool
+	dowStar bool
+}
+
+// Parse parses a cron expression in the local time zone.
+//
+// spec consists of five fields: minute, hour, day of month, month,
+// and day of week.  Each field accepts "*", numbers, ranges "a-b",
+// steps "*/n" and "a-b/n", and comma separated lists of them.
+// Months and days of week can be given by names such as "jan" or "mon".
+// Sunday is either 0 or 7.
+//
+// Descriptors @yearly, @monthly, @weekly, @daily and @hourly are
+// also accepted.
+func Parse(spec string) (*Cron, error) {
+	return ParseInLocation(spec, time.Local)
+}
+
+// ParseInLocation is like Parse but interprets spec in loc.
+func ParseInLocation(spec string, loc *time.Location) (*Cron, error) {
+	s := strings.TrimSpace(spec)
+	if d, ok := descriptors[strings.ToLower(s)]; ok {
+		s = d
+	}
+
+	f := strings.Fields(s)
+	if len(f) != len(fields) {
+		return nil, fmt.Errorf("%v: %s: expected %d fields", ErrInvalidCron, spec, len(fields))
+	}
+
+	var bits [5]uint64
+	for i, fd := range fields {
+		b, err := fd.parse(f[i])
+		if err != nil {
+			return nil, fmt.Errorf("%v: %s: %v", ErrInvalidCron, spec, err)
+		}
+		bits[i] = b
+	}
+	// Sunday may be 7.
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+
+	return &Cron{
+		spec:    spec,
+		loc:     loc,
+		minute:  bits[0],
+		hour:    bits[1],
+		dom:     bits[2],
+		month:   bits[3],
+		dow:     bits[4],
+		domStar: f[2] == "*",
+		dowStar: f[4] == "*",
+	}, nil
+}
+
+func (fd field) value(s string) (int, error) {
+	if v, ok := fd.names[strings.ToLower(s)]; ok {
+		return v, nil
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("bad %s: %s", fd.name, s)
+	}
+	if v < fd.min || v > fd.max {
+		return 0, fmt.Errorf("%s out of range: %d", fd.name, v)
+	}
+	return v, nil
+}
+
+func (fd field) parse(s string) (uint64, error) {
+	var bits uint64
+	for _, item := range strings.Split(s, ",") {
+		step := 1
+		if i := strings.IndexByte(item, '/'); i >= 0 {
+			n, err := strconv.Atoi(item[i+1:])
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("bad step: %s", item)
+			}
+			step = n
+			item = item[:i]
+		}
+
+		lo, hi := fd.min, fd.max
+		switch {
+		case item == "*":
+		case strings.IndexByte(item, '-') > 0:
+			i := strings.IndexByte(item, '-')
+			var err error
+			lo, err = fd.value(item[:i])
+			if err != nil {
+				return 0, err
+			}
+			hi, err = fd.value(item[i+1:])
+			if err != nil {
+				return 0, err
+			}
+			if lo > hi {
+				return 0, fmt.Errorf("bad range: %s", item)
+			}
+		default:
+			v, err := fd.value(item)
+			if err != nil {
+				return 0, err
+			}
+			lo = v
+			if step == 1 {
+				hi = v
+			}
+		}
+
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
+
+func (c *Cron) matchDay(t time.Time) bool {
+	dom := has(c.dom, t.Day())
+	dow := has(c.dow, int(t.Weekday()))
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Match returns true if t matches c at the granularity of minutes.
+func (c *Cron) Match(t time.Time) bool {
+	t = t.In(c.loc)
+	return has(c.month, int(t.Month())) && c.matchDay(t) &&
+		has(c.hour, t.Hour()) && has(c.minute, t.Minute())
+}
+
+// Next returns the earliest time after t that matches c.
+// If no time matches within five years, the zero time is returned.
+func (c *Cron) Next(t time.Time) time.Time {
+	t = t.In(c.loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.Add(maxSearch)
+
+	for t.Before(limit) {
+		switch {
+		case !has(c.month, int(t.Month())):
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, c.loc)
+		case !c.matchDay(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, c.loc)
+		case !has(c.hour, t.Hour()):
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, c.loc)
+		case !has(c.minute, t.Minute()):
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+// Location returns the time zone of c.
+func (c *Cron) Location() *time.Location {
+	return c.loc
+}
+
+// String returns the expression given to Parse.
+func (c *Cron) String() string {
+	return c.spec
+}
@@ -0,0 +1,116 @@
+package schedule
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	t.Parallel()
+
+	valid := []string{
+		"* * * * *",
+		"*/5 0-6 1,15 jan-jun mon-fri",
+		"5 2 * * 7",
+		"@daily",
+		"0 9-17/2 * * *",
+	}
+	for _, s := range valid {
+		if _, err := Parse(s); err != nil {
+			t.Errorf("%s: %v", s, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"*/0 * * * *",
+		"5-1 * * * *",
+		"* * * foo *",
+	}
+	for _, s := range invalid {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("%s should be invalid", s)
+		}
+	}
+}
+
+func TestNext(t *testing.T) {
+	t.Parallel()
+
+	loc := time.UTC
+	base := time.Date(2017, 3, 10, 10, 30, 15, 0, loc) // Friday
+
+	cases := []struct {
+		spec string
+		next time.Time
+	}{
+		{"* * * * *", time.Date(2017, 3, 10, 10, 31, 0, 0, loc)},
+		{"5 2 * * *", time.Date(2017, 3, 11, 2, 5, 0, 0, loc)},
+		{"0 9 * * mon", time.Date(2017, 3, 13, 9, 0, 0, 0, loc)},
+		{"0 0 1 * *", time.Date(2017, 4, 1, 0, 0, 0, 0, loc)},
+		{"0 0 29 2 *", time.Date(2020, 2, 29, 0, 0, 0, 0, loc)},
+		{"*/20 10 * * *", time.Date(2017, 3, 10, 10, 40, 0, 0, loc)},
+		// day of month OR day of week.
+		{"0 0 15 * sun", time.Date(2017, 3, 12, 0, 0, 0, 0, loc)},
+		{"0 0 31 2 *", time.Time{}},
+	}
+	for _, c := range cases {
+		cron, err := ParseInLocation(c.spec, loc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next := cron.Next(base); !next.Equal(c.next) {
+			t.Errorf("%s: expected %v, got %v", c.spec, c.next, next)
+		}
+	}
+}
+
+func TestLocation(t *testing.T) {
+	t.Parallel()
+
+	loc := time.FixedZone("UTC+8", 8*3600)
+	cron, err := ParseInLocation("5 2 * * *", loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := cron.Next(time.Date(2017, 3, 10, 0, 0, 0, 0, time.UTC))
+	if !next.Equal(time.Date(2017, 3, 10, 18, 5, 0, 0, time.UTC)) {
+		t.Error("unexpected next time:", next.UTC())
+	}
+	if !cron.Match(time.Date(2017, 3, 10, 18, 5, 30, 0, time.UTC)) {
+		t.Error("should match")
+	}
+}
+
+func TestWindow(t *testing.T) {
+	t.Parallel()
+
+	loc := time.UTC
+	w, err := NewWindow("0 2 * * sat", 2*time.Hour, loc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cases := []struct {
+		t      time.Time
+		active bool
+	}{
+		{time.Date(2017, 3, 11, 1, 59, 0, 0, loc), false},
+		{time.Date(2017, 3, 11, 2, 0, 0, 0, loc), true},
+		{time.Date(2017, 3, 11, 3, 59, 59, 0, loc), true},
+		{time.Date(2017, 3, 11, 4, 0, 0, 0, loc), false},
+		{time.Date(2017, 3, 12, 3, 0, 0, 0, loc), false},
+	}
+	for _, c := range cases {
+		if w.Active(c.t) != c.active {
+			t.Errorf("%v: expected %v", c.t, c.active)
+		}
+	}
+	if end := w.End(time.Date(2017, 3, 11, 3, 0, 0, 0, loc)); !end.Equal(time.Date(2017, 3, 11, 4, 0, 0, 0, loc)) {
+		t.Error("unexpected end:", end)
+	}
+}
@@ -0,0 +1,48 @@
+package schedule
+
+import (
+	"time"
+)
+
+// Window is a recurring time window that opens at times matching
+// a cron expression and lasts for a duration.
+type Window struct {
+	Cron     *Cron
+	Duration time.Duration
+}
+
+// NewWindow creates a window from a cron expression in loc.
+func NewWindow(spec string, d time.Duration, loc *time.Location) (*Window, error) {
+	c, err := ParseInLocation(spec, loc)
+	if err != nil {
+		return nil, err
+	}
+	return &Window{c, d}, nil
+}
+
+// Active returns true if t is within the window.
+func (w *Window) Active(t time.Time) bool {
+	start := w.Start(t)
+	return !start.IsZero()
+}
+
+// Start returns the start time of the window that contains t.
+// If t is not within the window, the zero time is returned.
+func (w *Window) Start(t time.Time) time.Time {
+	// the window is active if it opened after t - Duration.
+	start := w.Cron.Next(t.Add(-w.Duration))
+	if start.IsZero() || start.After(t) {
+		return time.Time{}
+	}
+	return start
+}
+
+// End returns the end time of the window that contains t.
+// If t is not within the window, the zero time is returned.
+func (w *Window) End(t time.Time) time.Time {
+	start := w.Start(t)
+	if start.IsZero() {
+		return start
+	}
+	return start.Add(w.Duration)
+}
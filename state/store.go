@@ -0,0 +1,113 @@
+// Package state provides stores to persist nightwatch states across restarts.
+package state
+
+import (
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Errors for state stores.
+var (
+	ErrNotFound = errors.New("state not found")
+)
+
+// Store is the interface for state stores.
+//
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Load reads the state saved for key into v.
+	// If no state has been saved for key, ErrNotFound is returned.
+	Load(key string, v interface{}) error
+
+	// Save saves v as the state for key.
+	// v must be encodable by encoding/json.
+	Save(key string, v interface{}) error
+
+	// Delete removes the state for key.
+	// Deleting a non-existent key is not an error.
+	Delete(key string) error
+}
+
+type fileStore struct {
+	dir  string
+	lock sync.Mutex
+}
+
+// NewFileStore creates a Store that saves states as JSON files in dir.
+// dir is created if it does not exist.  An error is returned if dir
+// is not writable.
+func NewFileStore(dir string) (Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	f, err := ioutil.TempFile(dir, ".tmp")
+	if err != nil {
+		return nil, err
+	}
+	f.Close()
+	os.Remove(f.Name())
+	return &fileStore{dir: dir}, nil
+}
+
+func (s *fileStore) path(key string) string {
+	return filepath.Join(s.dir, url.PathEscape(key)+".json")
+}
+
+func (s *fileStore) Load(key string, v interface{}) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	data, err := ioutil.ReadFile(s.path(key))
+	if os.IsNotExist(err) {
+		return ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func (s *fileStore) Save(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// write to a temporary file then rename it so that
+	// a crash never leaves a partially written state.
+	f, err := ioutil.TempFile(s.dir, ".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err2 := f.Close(); err == nil {
+		err = err2
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), s.path(key))
+}
+
+func (s *fileStore) Delete(key string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	err := os.Remove(s.path(key))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,45 @@
+package state
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestFileStore(t *testing.T) {
+	dir, err := ioutil.TempDir("", "nightwatch")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	s, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var v map[string]int
+	if err := s.Load("monitor/1", &v); err != ErrNotFound {
+		t.Error(`err != ErrNotFound`)
+	}
+
+	if err := s.Save("monitor/1", map[string]int{"times": 3}); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Load("monitor/1", &v); err != nil {
+		t.Fatal(err)
+	}
+	if v["times"] != 3 {
+		t.Error(`v["times"] != 3`)
+	}
+
+	if err := s.Delete("monitor/1"); err != nil {
+		t.Error(err)
+	}
+	if err := s.Delete("monitor/1"); err != nil {
+		t.Error(err)
+	}
+	if err := s.Load("monitor/1", &v); err != ErrNotFound {
+		t.Error(`err != ErrNotFound`)
+	}
+}